@@ -0,0 +1,85 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var ErrContentTypeNotAllowed = errors.New("gcsenhancer: content type not allowed")
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// WithAllowedContentTypes restricts uploads to the given content types, e.g.
+// "image/png" or "image/*" for any image. The content type is sniffed from
+// the first bytes of each upload, and, along with UploadOptions.ContentType
+// when set, checked against the list. Anything else, like HTML or
+// executables, is rejected with ErrContentTypeNotAllowed before writing.
+// Sniffing follows http.DetectContentType, which tells text formats like SVG
+// or JSON apart from HTML only as text, e.g. "text/plain" or "text/xml".
+func WithAllowedContentTypes(types ...string) Option {
+	return func(e *GCSEnhancer) {
+		e.allowedContentTypes = types
+	}
+}
+
+// checkContentType sniffs the content type of r and checks it, along with
+// declared, against the allowlist. The returned reader yields the whole
+// content, and is r rewound when r is an io.ReadSeeker.
+func (e *GCSEnhancer) checkContentType(r io.Reader, declared string) (io.Reader, error) {
+	if declared != "" && !contentTypeAllowed(e.allowedContentTypes, declared) {
+		return nil, fmt.Errorf("%w: %s", ErrContentTypeNotAllowed, declared)
+	}
+
+	head := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(r, head)
+
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	head = head[:n]
+
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		if _, err := seeker.Seek(int64(-n), io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	} else {
+		r = io.MultiReader(bytes.NewReader(head), r)
+	}
+
+	if sniffed := http.DetectContentType(head); !contentTypeAllowed(e.allowedContentTypes, sniffed) {
+		return nil, fmt.Errorf("%w: content sniffed as %s", ErrContentTypeNotAllowed, sniffed)
+	}
+
+	return r, nil
+}
+
+// contentTypeAllowed tells whether contentType matches an entry of allowed.
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return false
+	}
+
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+
+		if a == mediaType {
+			return true
+		}
+
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,58 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestAllowedContentTypes(t *testing.T) {
+	exe := []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00")
+
+	for _, tt := range []struct {
+		name        string
+		content     []byte
+		contentType string
+		allowed     bool
+	}{
+		{"image.png", pngBytes, "", true},
+		{"declared.png", pngBytes, "image/png", true},
+		{"page.html", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), "", false},
+		{"disguised.png", []byte("<html><body>hi</body></html>"), "image/png", false},
+		{"setup.exe", exe, "application/x-msdownload", false},
+		{"setup.png", exe, "", false},
+	} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithAllowedContentTypes("image/*"))
+
+		_, err := e.Upload(context.Background(), bytes.NewReader(tt.content), tt.name, gcsenhancer.UploadOptions{
+			ContentType: tt.contentType,
+		})
+
+		obj, stored := fake.Object("bucket", tt.name)
+
+		if tt.allowed {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+
+			if !bytes.Equal(obj.Content, tt.content) {
+				t.Errorf("%s: stored content differs from the source", tt.name)
+			}
+
+			continue
+		}
+
+		if !errors.Is(err, gcsenhancer.ErrContentTypeNotAllowed) {
+			t.Errorf("%s: err = %v, want ErrContentTypeNotAllowed", tt.name, err)
+		}
+
+		if stored {
+			t.Errorf("%s: rejected upload written", tt.name)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// maxAnimationPixels bounds the pixels of all the frames of an animated GIF,
+// decoded at once at a byte per pixel. Larger animations are handled like
+// still images, from their first frame.
+const maxAnimationPixels = 64 << 20
+
+// decodeAnimatedGIF decodes every frame of the GIF b. ok is false when b is
+// not a GIF, has a single frame, or exceeds the pixel budget: its logical
+// screen, or the frames altogether, see maxAnimationPixels.
+func (e *GCSEnhancer) decodeAnimatedGIF(b []byte) (*gif.GIF, bool) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(b))
+
+	if err != nil || e.checkPixels(cfg.Width, cfg.Height) != nil {
+		return nil, false
+	}
+
+	// Frames are counted from their descriptors, before any is decoded.
+	if pixels, ok := gifFramePixels(b); !ok || pixels > maxAnimationPixels {
+		return nil, false
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(b))
+
+	if err != nil || len(g.Image) < 2 {
+		return nil, false
+	}
+
+	return g, true
+}
+
+// gifFramePixels sums the areas of the frames of the GIF b, walking its
+// blocks without decompressing them. ok is false when b is malformed.
+func gifFramePixels(b []byte) (pixels int64, ok bool) {
+	// Header and logical screen descriptor, followed by the global color
+	// table if any.
+	if len(b) < 13 {
+		return 0, false
+	}
+
+	i := 13
+
+	if b[10]&0x80 != 0 {
+		i += 3 << (b[10]&0x07 + 1)
+	}
+
+	for i < len(b) {
+		switch b[i] {
+		case 0x3b: // trailer
+			return pixels, true
+		case 0x21: // extension: label and data sub-blocks
+			if i+2 > len(b) {
+				return 0, false
+			}
+
+			if i, ok = skipSubBlocks(b, i+2); !ok {
+				return 0, false
+			}
+		case 0x2c: // image descriptor, color table, LZW code size and data
+			if i+10 > len(b) {
+				return 0, false
+			}
+
+			w := int64(b[i+5]) | int64(b[i+6])<<8
+			h := int64(b[i+7]) | int64(b[i+8])<<8
+			pixels += w * h
+
+			flags := b[i+9]
+			i += 10
+
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+
+			if i, ok = skipSubBlocks(b, i+1); !ok {
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+	}
+
+	return 0, false
+}
+
+// skipSubBlocks returns the offset following the data sub-blocks of b
+// starting at i, up to their zero-length terminator.
+func skipSubBlocks(b []byte, i int) (int, bool) {
+	for {
+		if i >= len(b) {
+			return 0, false
+		}
+
+		n := int(b[i])
+		i++
+
+		if n == 0 {
+			return i, true
+		}
+
+		i += n
+	}
+}
+
+// animatedThumbnail shapes every frame of g to the thumbnail box, keeping
+// the frame delays and the loop count. Frames are composited, honoring their
+// disposal, before being scaled, so the thumbnail frames are self-contained.
+func (e *GCSEnhancer) animatedThumbnail(g *gif.GIF) *gif.GIF {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+
+	out := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(g.Image)),
+		Delay:     g.Delay,
+		Disposal:  make([]byte, 0, len(g.Image)),
+		LoopCount: g.LoopCount,
+	}
+
+	for i, frame := range g.Image {
+		var disposal byte
+
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			draw.Draw(previous, previous.Bounds(), canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		thumb := e.frameThumbnail(canvas)
+
+		// Crops keep the bounds of the canvas, frames are moved to the origin.
+		size := thumb.Bounds().Size()
+
+		dst := image.NewPaletted(image.Rect(0, 0, size.X, size.Y), frame.Palette)
+		draw.FloydSteinberg.Draw(dst, dst.Bounds(), thumb, thumb.Bounds().Min)
+
+		out.Image = append(out.Image, dst)
+		out.Disposal = append(out.Disposal, gif.DisposalNone)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return out
+}
+
+// frameThumbnail is thumbnail for frames of an animation. ThumbnailSmart
+// crops the center like ThumbnailFill, a crop window moving from frame to
+// frame would make the thumbnail jitter.
+func (e *GCSEnhancer) frameThumbnail(img image.Image) image.Image {
+	if e.thumbMode == ThumbnailSmart {
+		return e.fill(img, e.thumbWidth, e.thumbHeight, false)
+	}
+
+	return e.thumbnail(img)
+}
+
+// animationObject prepares the upload of the animated GIF g.
+func animationObject(g *gif.GIF, size ImageSize, name string) *ObjectInfo {
+	frame := g.Image[0].Bounds()
+
+	return &ObjectInfo{
+		Size:   size,
+		Name:   name,
+		Format: "image/gif",
+		encode: func(w io.Writer) error {
+			return gif.EncodeAll(w, g)
+		},
+		pixels: int64(frame.Dx()) * int64(frame.Dy()) * int64(len(g.Image)),
+	}
+}
@@ -0,0 +1,136 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// animatedGIF encodes a w×h GIF of frames frames.
+func animatedGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+
+	g := &gif.GIF{LoopCount: 3}
+
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9)
+
+		for x := 0; x < w; x++ {
+			frame.Set(x, i%h, color.White)
+		}
+
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10*(i+1))
+	}
+
+	var buf bytes.Buffer
+
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestAnimatedThumbnail(t *testing.T) {
+	for _, mode := range []ThumbnailMode{ThumbnailFit, ThumbnailFill, ThumbnailSmart} {
+		e := NewWithStorage(nil, "bucket", WithThumbnailSize(50, 50), WithThumbnailMode(mode))
+
+		g, ok := e.decodeAnimatedGIF(animatedGIF(t, 300, 200, 4))
+
+		if !ok {
+			t.Fatal("animated GIF not detected")
+		}
+
+		var buf bytes.Buffer
+
+		if err := animationObject(e.animatedThumbnail(g), Thumbnail, "t.gif").encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		thumb, err := gif.DecodeAll(&buf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(thumb.Image) != 4 {
+			t.Errorf("mode %d: %d frames, want 4", mode, len(thumb.Image))
+		}
+
+		if thumb.LoopCount != 3 || thumb.Delay[3] != 40 {
+			t.Errorf("mode %d: loop count %d, delays %v, want 3 and the source delays", mode, thumb.LoopCount, thumb.Delay)
+		}
+
+		want := image.Pt(50, 50)
+
+		if mode == ThumbnailFit {
+			want = image.Pt(50, 33)
+		}
+
+		if got := image.Pt(thumb.Config.Width, thumb.Config.Height); got != want {
+			t.Errorf("mode %d: canvas %v, want %v", mode, got, want)
+		}
+
+		for i, frame := range thumb.Image {
+			if frame.Bounds() != image.Rect(0, 0, want.X, want.Y) {
+				t.Errorf("mode %d: frame %d bounds %v, want origin-aligned %v", mode, i, frame.Bounds(), want)
+			}
+		}
+	}
+}
+
+// repeatedFrameGIF builds a GIF repeating a single w×h frame frames times,
+// without encoding the frames again.
+func repeatedFrameGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	start := 13
+
+	if b[10]&0x80 != 0 {
+		start += 3 << (b[10]&0x07 + 1)
+	}
+
+	// The frame runs up to the trailer.
+	frame := b[start : len(b)-1]
+
+	out := append([]byte(nil), b[:start]...)
+
+	for i := 0; i < frames; i++ {
+		out = append(out, frame...)
+	}
+
+	return append(out, 0x3b)
+}
+
+func TestDecodeAnimatedGIFFrameBudget(t *testing.T) {
+	e := NewWithStorage(nil, "bucket")
+
+	if pixels, ok := gifFramePixels(animatedGIF(t, 300, 200, 4)); !ok || pixels != 4*300*200 {
+		t.Errorf("gifFramePixels = %d, %v, want %d", pixels, ok, 4*300*200)
+	}
+
+	if _, ok := e.decodeAnimatedGIF(repeatedFrameGIF(t, 1000, 1000, 3)); !ok {
+		t.Fatal("GIF of 3 frames not decoded")
+	}
+
+	// 80 frames of a megapixel exceed maxAnimationPixels, though the
+	// logical screen is within any limit.
+	if _, ok := e.decodeAnimatedGIF(repeatedFrameGIF(t, 1000, 1000, 80)); ok {
+		t.Error("GIF of 80 megapixel frames decoded")
+	}
+
+	if _, ok := gifFramePixels([]byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x2c")); ok {
+		t.Error("truncated GIF walked")
+	}
+}
@@ -0,0 +1,61 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+)
+
+var ErrUnsupportedArchive = errors.New("gcsenhancer: unsupported archive format")
+
+var archiveTypes = []struct {
+	ext         string
+	contentType string
+}{
+	// Longest extensions first, ".tar.gz" must not be matched as ".gz".
+	{".tar.gz", "application/gzip"},
+	{".tgz", "application/gzip"},
+	{".zip", "application/zip"},
+	{".tar", "application/x-tar"},
+	{".gz", "application/gzip"},
+}
+
+// archiveContentType returns the content type of the archive name by its
+// extension, ok is false for unknown archives.
+func archiveContentType(name string) (string, bool) {
+	lower := strings.ToLower(name)
+
+	for _, t := range archiveTypes {
+		if strings.HasSuffix(lower, t.ext) {
+			return t.contentType, true
+		}
+	}
+
+	return "", false
+}
+
+// UploadArchive uploads a zip, tar or tar.gz archive with the content type of
+// its extension and a Content-Disposition making browsers download it under
+// its base name rather than displaying it. Other extensions are rejected with
+// ErrUnsupportedArchive.
+func (e *GCSEnhancer) UploadArchive(ctx context.Context, file io.Reader, uploadFilename string, opts UploadOptions) (*UploadedFileInfo, error) {
+	contentType, ok := archiveContentType(uploadFilename)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedArchive, uploadFilename)
+	}
+
+	opts.ContentType = contentType
+
+	if opts.ContentDisposition == "" {
+		opts.ContentDisposition = mime.FormatMediaType("attachment", map[string]string{
+			"filename": path.Base(uploadFilename),
+		})
+	}
+
+	return e.Upload(ctx, file, uploadFilename, opts)
+}
@@ -0,0 +1,66 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadArchive(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		disposition string
+	}{
+		{"exports/2022.zip", "application/zip", `attachment; filename=2022.zip`},
+		{"exports/2022.tar.gz", "application/gzip", `attachment; filename=2022.tar.gz`},
+		{"exports/DUMP.TGZ", "application/gzip", `attachment; filename=DUMP.TGZ`},
+		{"exports/2022.tar", "application/x-tar", `attachment; filename=2022.tar`},
+	} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		if _, err := e.UploadArchive(context.Background(), strings.NewReader("PK"), tt.name, gcsenhancer.UploadOptions{}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		obj, _ := fake.Object("bucket", tt.name)
+
+		if obj.Attrs.ContentType != tt.contentType {
+			t.Errorf("%s: content type = %q, want %q", tt.name, obj.Attrs.ContentType, tt.contentType)
+		}
+
+		if obj.Attrs.ContentDisposition != tt.disposition {
+			t.Errorf("%s: disposition = %q, want %q", tt.name, obj.Attrs.ContentDisposition, tt.disposition)
+		}
+	}
+}
+
+func TestUploadArchiveKeepsDisposition(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.UploadArchive(context.Background(), strings.NewReader("PK"), "a.zip", gcsenhancer.UploadOptions{
+		ContentDisposition: `attachment; filename="export.zip"`,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, _ := fake.Object("bucket", "a.zip"); obj.Attrs.ContentDisposition != `attachment; filename="export.zip"` {
+		t.Errorf("disposition = %q, want the caller's", obj.Attrs.ContentDisposition)
+	}
+}
+
+func TestUploadArchiveRejectsUnknownExtensions(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	if _, err := e.UploadArchive(context.Background(), strings.NewReader("x"), "a.rar", gcsenhancer.UploadOptions{}); !errors.Is(err, gcsenhancer.ErrUnsupportedArchive) {
+		t.Errorf("err = %v, want ErrUnsupportedArchive", err)
+	}
+}
@@ -0,0 +1,147 @@
+package gcsenhancer
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultConcurrency is the number of objects transferred in parallel by the
+// batch operations unless configured otherwise with WithConcurrency.
+const DefaultConcurrency = 8
+
+// rollbackTimeout bounds the deletion of the objects of a failed batch.
+const rollbackTimeout = 30 * time.Second
+
+// WithConcurrency caps the number of objects transferred in parallel by the
+// batch operations.
+func WithConcurrency(n int) Option {
+	return func(e *GCSEnhancer) {
+		if n > 0 {
+			e.concurrency = n
+		}
+	}
+}
+
+type UploadItem struct {
+	Name        string
+	Reader      io.Reader
+	ContentType string
+}
+
+// UploadBatch uploads arbitrary files in parallel and returns their links in
+// the same order as items. It stops at the first failure and returns its error.
+func (e *GCSEnhancer) UploadBatch(ctx context.Context, items []UploadItem) ([]string, error) {
+	links := make([]string, len(items))
+
+	err := e.runBounded(ctx, len(items), func(ctx context.Context, i int) error {
+		item := items[i]
+
+		info, err := e.Upload(ctx, item.Reader, item.Name, UploadOptions{
+			ContentType: item.ContentType,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		links[i] = info.PublicLink
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// runBounded calls fn for indexes 0..n-1 with at most e.concurrency calls in
+// flight. The first error cancels the context passed to the remaining calls,
+// stops spawning new ones and is returned.
+func (e *GCSEnhancer) runBounded(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	return runLimited(ctx, e.concurrency, n, fn)
+}
+
+// runLimited is runBounded with at most limit calls in flight, or
+// DefaultConcurrency when limit isn't positive.
+func runLimited(ctx context.Context, limit, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	if limit <= 0 {
+		limit = DefaultConcurrency
+	}
+
+	sem := make(chan struct{}, limit)
+
+L:
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			break L
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// WithBatchRollback makes UploadImages delete the objects of a batch already
+// uploaded when the batch fails, e.g. when its context is cancelled, instead
+// of returning their links along with the error. Failing deletions are only
+// logged.
+func WithBatchRollback() Option {
+	return func(e *GCSEnhancer) {
+		e.batchRollback = true
+	}
+}
+
+// rollback deletes the objects of a failed batch that were uploaded, stored
+// under the given names, skipping empty ones. A fresh context is used since
+// the one of the batch may be done.
+func (e *GCSEnhancer) rollback(names []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	e.runBounded(ctx, len(names), func(ctx context.Context, i int) error {
+		if names[i] == "" {
+			return nil
+		}
+
+		if err := e.bucket(e.bucketName).Object(names[i]).Delete(ctx); err != nil {
+			log.Printf("gcsenhancer: failed to roll back %s: %v", names[i], err)
+		}
+
+		return nil
+	})
+}
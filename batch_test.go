@@ -0,0 +1,136 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func batchItems(n int) []gcsenhancer.UploadItem {
+	items := make([]gcsenhancer.UploadItem, n)
+
+	for i := range items {
+		items[i] = gcsenhancer.UploadItem{
+			Name:        fmt.Sprintf("files/%02d.txt", i),
+			Reader:      strings.NewReader(fmt.Sprint(i)),
+			ContentType: "text/plain",
+		}
+	}
+
+	return items
+}
+
+func TestUploadBatchKeepsOrder(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(4))
+
+	// Earlier items take longer, so they complete last.
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite {
+			var i int
+			fmt.Sscanf(c.Object, "files/%02d.txt", &i)
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+		}
+
+		return nil
+	})
+
+	links, err := e.UploadBatch(context.Background(), batchItems(10))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, link := range links {
+		if want := fmt.Sprintf("files/%02d.txt", i); !strings.HasSuffix(link, want) {
+			t.Errorf("link %d = %s, want the link of %s", i, link, want)
+		}
+	}
+
+	if obj, _ := fake.Object("bucket", "files/03.txt"); string(obj.Content) != "3" || obj.Attrs.ContentType != "text/plain" {
+		t.Errorf("stored %q as %s", obj.Content, obj.Attrs.ContentType)
+	}
+}
+
+func TestUploadBatchConcurrencyCap(t *testing.T) {
+	const limit = 3
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(limit))
+
+	var (
+		mu            sync.Mutex
+		inFlight, max int
+	)
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpWrite {
+			return nil
+		}
+
+		mu.Lock()
+		inFlight++
+
+		if inFlight > max {
+			max = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return nil
+	})
+
+	if _, err := e.UploadBatch(context.Background(), batchItems(20)); err != nil {
+		t.Fatal(err)
+	}
+
+	if max > limit {
+		t.Errorf("%d uploads in flight, want at most %d", max, limit)
+	}
+
+	if max < 2 {
+		t.Errorf("%d uploads in flight, want them parallel", max)
+	}
+}
+
+func TestUploadBatchFailsFast(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(1))
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && c.Object == "files/02.txt" {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	links, err := e.UploadBatch(context.Background(), batchItems(10))
+
+	if !errors.Is(err, errDenied) {
+		t.Fatalf("err = %v, want the failing upload's", err)
+	}
+
+	if links != nil {
+		t.Errorf("links = %v, want none on failure", links)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 3 {
+		t.Errorf("%d uploads attempted, want the batch stopped at the failure", n)
+	}
+}
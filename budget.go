@@ -0,0 +1,126 @@
+package gcsenhancer
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBudget bounds the bytes held in memory by the uploads of images. It
+// can be shared by several enhancers to bound a whole process.
+type MemoryBudget struct {
+	mu      sync.Mutex
+	size    int64
+	avail   int64
+	waiters []*budgetWaiter
+}
+
+type budgetWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// NewMemoryBudget returns a budget of size bytes.
+func NewMemoryBudget(size int64) *MemoryBudget {
+	return &MemoryBudget{
+		size:  size,
+		avail: size,
+	}
+}
+
+// WithMemoryBudget makes the image uploads of the enhancer, see UploadImages,
+// wait for budget before starting, so concurrent calls don't use more than
+// its size in aggregate. Each upload reserves an estimate of its buffers, the
+// raw size of the image up to the chunk size of the writer.
+func WithMemoryBudget(b *MemoryBudget) Option {
+	return func(e *GCSEnhancer) {
+		e.budget = b
+	}
+}
+
+// acquire reserves n bytes, waiting for them to be released by others if
+// needed. Reservations larger than the budget are capped to its size, so
+// they run alone rather than never. Waiters are served in order.
+func (b *MemoryBudget) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > b.size {
+		n = b.size
+	}
+
+	b.mu.Lock()
+
+	if len(b.waiters) == 0 && b.avail >= n {
+		b.avail -= n
+		b.mu.Unlock()
+
+		return n, nil
+	}
+
+	w := &budgetWaiter{n: n, ready: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return n, nil
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// Granted meanwhile, given back.
+		b.avail += n
+	default:
+		for i, other := range b.waiters {
+			if other == w {
+				b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+
+				break
+			}
+		}
+	}
+
+	b.grant()
+
+	return 0, ctx.Err()
+}
+
+// release gives back n bytes reserved by acquire.
+func (b *MemoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.avail += n
+	b.grant()
+}
+
+// grant serves the waiters, in order, while the budget allows.
+func (b *MemoryBudget) grant() {
+	for len(b.waiters) > 0 && b.waiters[0].n <= b.avail {
+		w := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.avail -= w.n
+
+		close(w.ready)
+	}
+}
+
+// memoryEstimate is the number of bytes the upload of obj is expected to
+// hold: its raw pixels when encoded, its length otherwise, up to the buffer
+// of the writer.
+func (obj *ObjectInfo) memoryEstimate() int64 {
+	n := int64(defaultChunkSize)
+
+	if obj.pixels > 0 {
+		n = obj.pixels * 4
+	} else if l, ok := obj.Reader.(interface{ Len() int }); ok {
+		n = int64(l.Len())
+	}
+
+	if n > defaultChunkSize {
+		n = defaultChunkSize
+	}
+
+	return n
+}
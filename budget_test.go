@@ -0,0 +1,133 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestMemoryBudgetSharedByEnhancers(t *testing.T) {
+	// Each 16x16 RGBA image, and its thumbnail, is estimated at 1KiB: the
+	// budget lets two uploads run at once across both enhancers.
+	budget := gcsenhancer.NewMemoryBudget(2 * 16 * 16 * 4)
+
+	var (
+		mu             sync.Mutex
+		inFlight, peak int
+	)
+
+	fake := gcstest.New()
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpWrite {
+			return nil
+		}
+
+		mu.Lock()
+		inFlight++
+
+		if inFlight > peak {
+			peak = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return nil
+	})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 2; i++ {
+		e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(), gcsenhancer.WithMemoryBudget(budget))
+
+		imgs := make([]gcsenhancer.Images, 4)
+
+		for j := range imgs {
+			imgs[j] = gcsenhancer.Images{
+				Name:      fmt.Sprintf("e%d/%d.png", i, j),
+				Mime:      "image/png",
+				OrigImage: image.NewRGBA(image.Rect(0, 0, 16, 16)),
+			}
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := e.UploadImages(context.Background(), imgs); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := len(fake.Objects("bucket")); n != 16 {
+		t.Errorf("%d objects stored, want 16", n)
+	}
+
+	if peak > 2 {
+		t.Errorf("%d uploads in flight, want at most 2 within the budget", peak)
+	}
+}
+
+func TestMemoryBudgetWaitCancelled(t *testing.T) {
+	budget := gcsenhancer.NewMemoryBudget(16 * 16 * 4)
+
+	held, release := make(chan struct{}), make(chan struct{})
+	fake := gcstest.New()
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && c.Object == "a.png" {
+			close(held)
+			<-release
+		}
+
+		return nil
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(), gcsenhancer.WithMemoryBudget(budget))
+	holder := gcsenhancer.Images{
+		Name:      "a.png",
+		Mime:      "image/png",
+		OrigImage: image.NewRGBA(image.Rect(0, 0, 16, 16)),
+	}
+
+	done := make(chan error)
+
+	go func() {
+		_, err := e.UploadImages(context.Background(), []gcsenhancer.Images{holder})
+		done <- err
+	}()
+
+	// a.png holds the whole budget until released.
+	<-held
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := e.UploadImages(ctx, pngImages("b.png")); err != context.DeadlineExceeded {
+		t.Errorf("err = %v, want the wait for budget to time out", err)
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.UploadImages(context.Background(), pngImages("c.png")); err != nil {
+		t.Errorf("budget not released: %v", err)
+	}
+}
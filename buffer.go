@@ -0,0 +1,95 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// DefaultBufferThreshold is the number of bytes buffered in memory before
+// spilling a non-seekable upload body to disk.
+const DefaultBufferThreshold int64 = 8 << 20
+
+// WithTempDir sets the directory non-seekable upload bodies spill to when
+// they are buffered to disk. Defaults to os.TempDir().
+func WithTempDir(dir string) Option {
+	return func(e *GCSEnhancer) {
+		e.tempDir = dir
+	}
+}
+
+// replayable returns a reader of r that can be rewound. Seekable readers are
+// returned as is, otherwise r is buffered into memory or, when it exceeds
+// threshold, into a temp file under tempDir. The returned func releases the
+// buffer and removes the temp file.
+func replayable(r io.Reader, threshold int64, tempDir string) (io.ReadSeeker, func(), error) {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		return rs, func() {}, nil
+	}
+
+	if threshold <= 0 {
+		threshold = DefaultBufferThreshold
+	}
+
+	buf := new(bytes.Buffer)
+
+	n, err := io.CopyN(buf, r, threshold+1)
+
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	if n <= threshold {
+		return bytes.NewReader(buf.Bytes()), func() {}, nil
+	}
+
+	// ------------------- spill large inputs to disk -------------------
+	f, err := os.CreateTemp(tempDir, "gcsenhancer-*")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	if _, err := io.Copy(f, io.MultiReader(buf, r)); err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+
+		return nil, nil, err
+	}
+
+	return f, cleanup, nil
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumCRC32C computes the CRC32C of the rest of rs and rewinds it.
+func checksumCRC32C(rs io.ReadSeeker) (uint32, error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return 0, err
+	}
+
+	h := crc32.New(crc32cTable)
+
+	if _, err := io.Copy(h, rs); err != nil {
+		return 0, err
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	return h.Sum32(), nil
+}
@@ -0,0 +1,102 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// onlyReader hides every method of r but Read.
+type onlyReader struct {
+	r io.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func readTwice(t *testing.T, rs io.ReadSeeker) (string, string) {
+	t.Helper()
+
+	first, err := ioutil.ReadAll(rs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := ioutil.ReadAll(rs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(first), string(second)
+}
+
+func TestReplayableInMemory(t *testing.T) {
+	dir := t.TempDir()
+
+	rs, cleanup, err := replayable(onlyReader{strings.NewReader("small body")}, 64, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cleanup()
+
+	if _, ok := rs.(*os.File); ok {
+		t.Error("small body spilled to disk")
+	}
+
+	if first, second := readTwice(t, rs); first != "small body" || second != first {
+		t.Errorf("read %q then %q, want the body twice", first, second)
+	}
+}
+
+func TestReplayableSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	body := bytes.Repeat([]byte("0123456789"), 100)
+
+	rs, cleanup, err := replayable(onlyReader{bytes.NewReader(body)}, 64, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := rs.(*os.File); !ok {
+		t.Errorf("large body buffered as %T, want a temp file", rs)
+	}
+
+	if first, second := readTwice(t, rs); first != string(body) || second != first {
+		t.Errorf("read %d then %d bytes, want the %d of the body twice", len(first), len(second), len(body))
+	}
+
+	cleanup()
+
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d temp files left after cleanup", len(entries))
+	}
+}
+
+func TestReplayableKeepsSeekers(t *testing.T) {
+	r := strings.NewReader("seekable")
+
+	rs, cleanup, err := replayable(r, 1, t.TempDir())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cleanup()
+
+	if rs != io.ReadSeeker(r) {
+		t.Error("seekable reader buffered")
+	}
+}
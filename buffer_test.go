@@ -0,0 +1,133 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+// failWrites fails the first n writes to the fake with a 503.
+func failWrites(fake *gcstest.Storage, n int) {
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && n > 0 {
+			n--
+
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		}
+
+		return nil
+	})
+}
+
+func TestUploadRetriesNonSeekableBody(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 100)
+
+	for name, threshold := range map[string]int64{"in memory": 4096, "spilled to disk": 64} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			fake := gcstest.New()
+			e := gcsenhancer.NewWithStorage(fake, "bucket",
+				gcsenhancer.WithTempDir(dir),
+				gcsenhancer.WithRetryPolicy(gcsenhancer.ExponentialBackoff{BaseDelay: time.Millisecond}),
+			)
+
+			failWrites(fake, 2)
+
+			// io.MultiReader hides the Seek of the bytes.Reader.
+			_, err := e.Upload(context.Background(), io.MultiReader(bytes.NewReader(body)), "a.bin", gcsenhancer.UploadOptions{
+				Retries:         2,
+				BufferThreshold: threshold,
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := len(fake.CallsTo(gcstest.OpWrite)); n != 3 {
+				t.Errorf("%d writes, want 3", n)
+			}
+
+			if obj, _ := fake.Object("bucket", "a.bin"); !bytes.Equal(obj.Content, body) {
+				t.Errorf("stored %d bytes, want the whole body replayed", len(obj.Content))
+			}
+
+			if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("%d temp files left", len(entries))
+			}
+		})
+	}
+}
+
+func TestUploadGivesUpAfterRetries(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket",
+		gcsenhancer.WithRetryPolicy(gcsenhancer.ExponentialBackoff{BaseDelay: time.Millisecond}))
+
+	failWrites(fake, 3)
+
+	_, err := e.Upload(context.Background(), io.MultiReader(bytes.NewReader([]byte("x"))), "a.bin", gcsenhancer.UploadOptions{Retries: 2})
+
+	if err == nil {
+		t.Fatal("upload succeeded despite every attempt failing")
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 3 {
+		t.Errorf("%d writes, want 3", n)
+	}
+}
+
+func TestUploadSpillsToTempDir(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		dir := t.TempDir()
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket",
+			gcsenhancer.WithTempDir(dir),
+			gcsenhancer.WithRetryPolicy(gcsenhancer.ExponentialBackoff{BaseDelay: time.Millisecond}))
+
+		var spilled []string
+
+		fake.Intercept(func(c gcstest.Call) error {
+			if c.Op != gcstest.OpWrite {
+				return nil
+			}
+
+			entries, _ := ioutil.ReadDir(dir)
+
+			for _, entry := range entries {
+				spilled = append(spilled, entry.Name())
+			}
+
+			if fail {
+				return &googleapi.Error{Code: http.StatusServiceUnavailable}
+			}
+
+			return nil
+		})
+
+		_, err := e.Upload(context.Background(), io.MultiReader(bytes.NewReader(bytes.Repeat([]byte("x"), 1024))), "a.bin", gcsenhancer.UploadOptions{
+			Retries:         1,
+			BufferThreshold: 16,
+		})
+
+		if fail != (err != nil) {
+			t.Fatalf("fail %v: err = %v", fail, err)
+		}
+
+		if len(spilled) == 0 || !strings.HasPrefix(spilled[0], "gcsenhancer-") {
+			t.Errorf("fail %v: body spilled as %v under the temp dir, want a gcsenhancer- file", fail, spilled)
+		}
+
+		if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("fail %v: %d temp files left", fail, len(entries))
+		}
+	}
+}
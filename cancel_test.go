@@ -0,0 +1,115 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadImagesCancelled(t *testing.T) {
+	for _, rollback := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// The completion of the first object cancels the batch.
+		opts := []gcsenhancer.Option{
+			gcsenhancer.WithStableKeys(),
+			gcsenhancer.WithConcurrency(1),
+			gcsenhancer.WithOnObjectComplete(func(gcsenhancer.ObjectResult) { cancel() }),
+		}
+
+		if rollback {
+			opts = append(opts, gcsenhancer.WithBatchRollback())
+		}
+
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket", opts...)
+
+		start := time.Now()
+
+		links, err := e.UploadImages(ctx, pngImages("a.png", "b.png", "c.png"))
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("rollback %v: err = %v, want context.Canceled", rollback, err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("rollback %v: returned after %v", rollback, elapsed)
+		}
+
+		// The callback runs once the first object is done, by then the next
+		// one may have been started with the concurrency of 1.
+		if n := len(fake.CallsTo(gcstest.OpWrite)); n > 2 {
+			t.Errorf("rollback %v: %d writes, want none started after the cancellation", rollback, n)
+		}
+
+		stored := fake.Objects("bucket")
+		returned := len(links.Original) + len(links.Thumbnails)
+
+		if rollback {
+			if len(stored) != 0 || returned != 0 {
+				t.Errorf("rollback: %v stored and %d links returned, want the batch rolled back", stored, returned)
+			}
+
+			continue
+		}
+
+		if len(stored) == 0 || returned != len(stored) {
+			t.Errorf("%v stored and %d links returned, want the links of the completed objects", stored, returned)
+		}
+	}
+}
+
+func TestUploadImagesRollbackRoutedObjects(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && c.Object == "images/c.png" {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket",
+		gcsenhancer.WithStableKeys(),
+		gcsenhancer.WithConcurrency(1),
+		gcsenhancer.WithBatchRollback(),
+		gcsenhancer.WithContentTypeFolders(map[string]string{"image/*": "images/"}, ""))
+
+	if _, err := e.UploadImages(context.Background(), pngImages("a.png", "b.png", "c.png")); !errors.Is(err, errDenied) {
+		t.Fatalf("err = %v, want the write failure", err)
+	}
+
+	if stored := fake.Objects("bucket"); len(stored) != 0 {
+		t.Errorf("%v stored, want the routed objects rolled back", stored)
+	}
+
+	for _, c := range fake.CallsTo(gcstest.OpDelete) {
+		if !strings.HasPrefix(c.Object, "images/") {
+			t.Errorf("rollback deleted %s, want the routed key", c.Object)
+		}
+	}
+}
+
+func TestUploadImagesCancelledBeforeEncoding(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := e.UploadImages(ctx, pngImages("a.png", "b.png")); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("%d calls made, want none", len(calls))
+	}
+}
@@ -0,0 +1,89 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+var ErrNoFreeName = errors.New("gcsenhancer: no free object name")
+
+// CollisionStrategy decides what an upload does when an object already
+// exists under its name.
+type CollisionStrategy string
+
+const (
+	// CollisionOverwrite replaces the existing object. It is the default.
+	CollisionOverwrite CollisionStrategy = ""
+
+	// CollisionSkip leaves the existing object as is and returns its link.
+	CollisionSkip CollisionStrategy = "skip"
+
+	// CollisionSuffix stores the upload under the first free name suffixed
+	// with a counter, e.g. "report (1).pdf", then "report (2).pdf".
+	CollisionSuffix CollisionStrategy = "suffix"
+)
+
+// maxCollisionSuffix bounds the names tried by CollisionSuffix.
+const maxCollisionSuffix = 1000
+
+// UploadCollision sets the collision strategy of the upload.
+func UploadCollision(strategy CollisionStrategy) UploadOption {
+	return func(o *UploadOptions) {
+		o.Collision = strategy
+	}
+}
+
+// resolveCollision applies the collision strategy of opts to name. It returns
+// the name to write and, for CollisionSkip, the attributes of the existing
+// object the write is skipped for.
+func (e *GCSEnhancer) resolveCollision(ctx context.Context, bucket BucketHandle, name string, strategy CollisionStrategy) (string, *storage.ObjectAttrs, error) {
+	switch strategy {
+	case CollisionOverwrite:
+		return name, nil, nil
+	case CollisionSkip:
+		attr, err := bucket.Object(name).Attrs(ctx)
+
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return name, nil, nil
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		return name, attr, nil
+	case CollisionSuffix:
+		candidate := name
+
+		for i := 1; i <= maxCollisionSuffix; i++ {
+			_, err := bucket.Object(candidate).Attrs(ctx)
+
+			if errors.Is(err, storage.ErrObjectNotExist) {
+				return candidate, nil, nil
+			}
+
+			if err != nil {
+				return "", nil, err
+			}
+
+			candidate = suffixedName(name, i)
+		}
+
+		return "", nil, fmt.Errorf("%w: %s", ErrNoFreeName, name)
+	}
+
+	return "", nil, fmt.Errorf("gcsenhancer: unknown collision strategy %q", strategy)
+}
+
+// suffixedName inserts the counter n before the extension of name, e.g.
+// "docs/report (2).pdf".
+func suffixedName(name string, n int) string {
+	ext := path.Ext(name)
+
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+}
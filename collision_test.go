@@ -0,0 +1,85 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadCollision(t *testing.T) {
+	for _, tt := range []struct {
+		strategy gcsenhancer.CollisionStrategy
+		filename string
+		objects  []string
+		content  string
+	}{
+		{gcsenhancer.CollisionOverwrite, "docs/report.pdf", []string{"docs/report (1).pdf", "docs/report.pdf"}, "new"},
+		{gcsenhancer.CollisionSkip, "docs/report.pdf", []string{"docs/report (1).pdf", "docs/report.pdf"}, "old"},
+		{gcsenhancer.CollisionSuffix, "docs/report (2).pdf", []string{"docs/report (1).pdf", "docs/report (2).pdf", "docs/report.pdf"}, "new"},
+	} {
+		fake := gcstest.New()
+		fake.Put("bucket", "docs/report.pdf", []byte("old"), storage.ObjectAttrs{})
+		fake.Put("bucket", "docs/report (1).pdf", []byte("old"), storage.ObjectAttrs{})
+
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		info, err := e.Upload(context.Background(), strings.NewReader("new"), "docs/report.pdf", gcsenhancer.UploadOptions{},
+			gcsenhancer.UploadCollision(tt.strategy),
+		)
+
+		if err != nil {
+			t.Fatalf("%q: %v", tt.strategy, err)
+		}
+
+		if info.Filename != tt.filename {
+			t.Errorf("%q: uploaded as %s, want %s", tt.strategy, info.Filename, tt.filename)
+		}
+
+		if got := fake.Objects("bucket"); !reflect.DeepEqual(got, tt.objects) {
+			t.Errorf("%q: objects = %v, want %v", tt.strategy, got, tt.objects)
+		}
+
+		if obj, _ := fake.Object("bucket", tt.filename); string(obj.Content) != tt.content {
+			t.Errorf("%q: %s holds %q, want %q", tt.strategy, tt.filename, obj.Content, tt.content)
+		}
+
+		if n := len(fake.CallsTo(gcstest.OpWrite)); tt.strategy == gcsenhancer.CollisionSkip && n != 0 {
+			t.Errorf("%d writes, want the upload skipped", n)
+		}
+	}
+}
+
+func TestUploadCollisionFreeName(t *testing.T) {
+	for _, strategy := range []gcsenhancer.CollisionStrategy{gcsenhancer.CollisionSkip, gcsenhancer.CollisionSuffix} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		info, err := e.Upload(context.Background(), strings.NewReader("new"), "report.pdf", gcsenhancer.UploadOptions{Collision: strategy})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Filename != "report.pdf" {
+			t.Errorf("%q: uploaded as %s, want the free report.pdf", strategy, info.Filename)
+		}
+	}
+}
+
+func TestUploadCollisionUnknownStrategy(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{Collision: "rename"}); err == nil {
+		t.Error("upload with an unknown strategy succeeded")
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 0 {
+		t.Errorf("%d writes, want none", n)
+	}
+}
@@ -0,0 +1,51 @@
+package gcsenhancer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidContentLanguage = errors.New("gcsenhancer: invalid content language")
+
+// validateContentLanguage checks that tag is well-formed as a BCP 47 language
+// tag, e.g. "en", "zh-TW" or "sr-Latn-RS": a primary language of 2 to 8
+// letters followed by subtags of 1 to 8 letters or digits. Whether the
+// subtags are registered is not checked.
+func validateContentLanguage(tag string) error {
+	subtags := strings.Split(tag, "-")
+
+	primary := subtags[0]
+
+	if len(primary) < 2 || len(primary) > 8 || !isAlpha(primary) {
+		return fmt.Errorf("%w: %q", ErrInvalidContentLanguage, tag)
+	}
+
+	for _, sub := range subtags[1:] {
+		if len(sub) < 1 || len(sub) > 8 || !isAlphanumeric(sub) {
+			return fmt.Errorf("%w: %q", ErrInvalidContentLanguage, tag)
+		}
+	}
+
+	return nil
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,49 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadContentLanguage(t *testing.T) {
+	for _, lang := range []string{"en", "zh-TW", "sr-Latn-RS", "de-CH-1901"} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{ContentLanguage: lang}); err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+
+		attrs, err := fake.Bucket("bucket").Object("a.txt").Attrs(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attrs.ContentLanguage != lang {
+			t.Errorf("content language = %q, want %q", attrs.ContentLanguage, lang)
+		}
+	}
+}
+
+func TestUploadRejectsMalformedContentLanguage(t *testing.T) {
+	for _, lang := range []string{"e", "englishlanguage", "zh_TW", "en-", "-en", "1en", "en-toolongsubtag"} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{ContentLanguage: lang})
+
+		if !errors.Is(err, gcsenhancer.ErrInvalidContentLanguage) {
+			t.Errorf("%q: err = %v, want ErrInvalidContentLanguage", lang, err)
+		}
+
+		if len(fake.CallsTo(gcstest.OpWrite)) != 0 {
+			t.Errorf("%q: written despite the malformed tag", lang)
+		}
+	}
+}
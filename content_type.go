@@ -0,0 +1,20 @@
+package gcsenhancer
+
+import (
+	"mime"
+	"path/filepath"
+)
+
+// DefaultContentType is used when the content type of an object can not be
+// determined.
+const DefaultContentType = "application/octet-stream"
+
+// ContentTypeByExtension returns the content type of the extension of name,
+// e.g. "image/png" for "photo.png", or DefaultContentType when unknown.
+func ContentTypeByExtension(name string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+
+	return DefaultContentType
+}
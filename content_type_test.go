@@ -0,0 +1,51 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestContentTypeFromExt(t *testing.T) {
+	for name, want := range map[string]string{
+		"photo.png":       "image/png",
+		"data.json":       "application/json",
+		"blob.unknownext": gcsenhancer.DefaultContentType,
+	} {
+		if got := gcsenhancer.ContentTypeByExtension(name); got != want {
+			t.Errorf("ContentTypeByExtension(%q) = %q, want %q", name, got, want)
+		}
+
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		if _, err := e.Upload(context.Background(), strings.NewReader("{}"), name, gcsenhancer.UploadOptions{ContentTypeFromExt: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		if obj, _ := fake.Object("bucket", name); obj.Attrs.ContentType != want {
+			t.Errorf("%s uploaded as %q, want %q", name, obj.Attrs.ContentType, want)
+		}
+	}
+}
+
+func TestContentTypeFromExtKeepsExplicitType(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.png", gcsenhancer.UploadOptions{
+		ContentType:        "image/x-custom",
+		ContentTypeFromExt: true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, _ := fake.Object("bucket", "a.png"); obj.Attrs.ContentType != "image/x-custom" {
+		t.Errorf("uploaded as %q, want the explicit image/x-custom", obj.Attrs.ContentType)
+	}
+}
@@ -0,0 +1,48 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+)
+
+// CopyToBucket copies the object srcName to dstName in the bucket dstBucket,
+// e.g. to migrate objects between buckets, and returns the link of the copy.
+// The content type and metadata are carried over. The destination bucket has
+// to be writable with the credentials of the client.
+//
+// Like Upload, copies are private unless made public by extra or the
+// context, see UploadPublic, UploadACL and ContextWithPublicAccess. Public
+// copies need fine-grained ACLs, buckets with uniform bucket-level access
+// reject them.
+func (e *GCSEnhancer) CopyToBucket(ctx context.Context, srcName, dstBucket, dstName string, extra ...UploadOption) (string, error) {
+	opts := UploadOptions{}.apply(extra)
+
+	src := e.bucket(e.bucketName).Object(srcName)
+	dst := e.bucket(dstBucket).Object(dstName)
+
+	if opts.Conditions != nil {
+		dst = dst.If(*opts.Conditions)
+	}
+
+	copier := dst.CopierFrom(src)
+	copier.Settings().PredefinedACL = opts.PredefinedACL
+
+	if e.public && publicAccess(ctx, opts) && opts.PredefinedACL == "" {
+		copier.Settings().PredefinedACL = PredefinedACLPublicRead
+	}
+
+	attr, err := copier.Run(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrObjectNotFound, srcName)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return e.objectLink(attr, opts.Host).PublicLink, nil
+}
@@ -0,0 +1,92 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestCopyToBucket(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "src")
+
+	fake.Put("src", "a.png", []byte("png"), storage.ObjectAttrs{
+		ContentType: "image/png",
+		Metadata:    map[string]string{"owner": "42"},
+	})
+
+	if _, err := e.CopyToBucket(context.Background(), "a.png", "dst", "b/a.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, ok := fake.Object("dst", "b/a.png")
+
+	if !ok {
+		t.Fatal("copy not stored in the destination bucket")
+	}
+
+	if string(obj.Content) != "png" {
+		t.Errorf("content = %q, want png", obj.Content)
+	}
+
+	if obj.Attrs.ContentType != "image/png" {
+		t.Errorf("content type = %q, want image/png", obj.Attrs.ContentType)
+	}
+
+	if obj.Attrs.Metadata["owner"] != "42" {
+		t.Errorf("metadata = %v, want owner=42", obj.Attrs.Metadata)
+	}
+
+	if len(obj.Attrs.ACL) != 0 {
+		t.Errorf("ACL = %v, want private", obj.Attrs.ACL)
+	}
+}
+
+func TestCopyToBucketUniformAccess(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "src")
+
+	fake.Put("src", "a.txt", []byte("x"), storage.ObjectAttrs{})
+	fake.SetBucketAttrs("dst", storage.BucketAttrs{
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+	})
+
+	if _, err := e.CopyToBucket(context.Background(), "a.txt", "dst", "a.txt"); err != nil {
+		t.Fatalf("private copy into a uniform bucket: %v", err)
+	}
+
+	if _, err := e.CopyToBucket(context.Background(), "a.txt", "dst", "b.txt", gcsenhancer.UploadPublic(true)); err == nil {
+		t.Error("public copy into a uniform bucket succeeded")
+	}
+}
+
+func TestCopyToBucketPublic(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "src")
+
+	fake.Put("src", "a.txt", []byte("x"), storage.ObjectAttrs{})
+
+	if _, err := e.CopyToBucket(context.Background(), "a.txt", "dst", "a.txt", gcsenhancer.UploadPublic(true)); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("dst", "a.txt")
+
+	if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers {
+		t.Errorf("ACL = %v, want AllUsers reader", obj.Attrs.ACL)
+	}
+}
+
+func TestCopyToBucketMissingSource(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "src")
+
+	_, err := e.CopyToBucket(context.Background(), "missing", "dst", "missing")
+
+	if !errors.Is(err, gcsenhancer.ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrObjectNotFound", err)
+	}
+}
@@ -0,0 +1,72 @@
+package gcsenhancer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+var corsMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"PUT":     true,
+	"POST":    true,
+	"DELETE":  true,
+	"PATCH":   true,
+	"OPTIONS": true,
+}
+
+// SetCORS replaces the CORS configuration of the bucket so browsers are able to
+// upload to / download from the bucket directly.
+func (e *GCSEnhancer) SetCORS(ctx context.Context, cors []storage.CORS) error {
+	for _, c := range cors {
+		if err := validateCORS(c); err != nil {
+			return err
+		}
+	}
+
+	bucket := e.bucket(e.bucketName)
+
+	_, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{
+		CORS: cors,
+	})
+
+	return err
+}
+
+func validateCORS(c storage.CORS) error {
+	if len(c.Origins) == 0 {
+		return fmt.Errorf("cors: at least one origin is required")
+	}
+
+	for _, origin := range c.Origins {
+		if origin == "*" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("cors: invalid origin %q", origin)
+		}
+	}
+
+	if len(c.Methods) == 0 {
+		return fmt.Errorf("cors: at least one method is required")
+	}
+
+	for _, method := range c.Methods {
+		if !corsMethods[strings.ToUpper(method)] {
+			return fmt.Errorf("cors: invalid method %q", method)
+		}
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors: max age must not be negative")
+	}
+
+	return nil
+}
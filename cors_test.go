@@ -0,0 +1,66 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestSetCORS(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	cors := []storage.CORS{{
+		Origins:         []string{"https://app.example.com", "*"},
+		Methods:         []string{"GET", "put"},
+		ResponseHeaders: []string{"Content-Type"},
+		MaxAge:          time.Hour,
+	}}
+
+	if err := e.SetCORS(ctx, cors); err != nil {
+		t.Fatal(err)
+	}
+
+	attrs, err := fake.Bucket("bucket").Attrs(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attrs.CORS) != 1 {
+		t.Fatalf("CORS = %+v, want the configuration set", attrs.CORS)
+	}
+
+	got := attrs.CORS[0]
+
+	if len(got.Origins) != 2 || got.Origins[0] != "https://app.example.com" || len(got.Methods) != 2 || got.MaxAge != time.Hour {
+		t.Errorf("CORS = %+v, want %+v", got, cors[0])
+	}
+}
+
+func TestSetCORSValidates(t *testing.T) {
+	for name, c := range map[string]storage.CORS{
+		"no origin":       {Methods: []string{"GET"}},
+		"relative origin": {Origins: []string{"example.com"}, Methods: []string{"GET"}},
+		"ftp origin":      {Origins: []string{"ftp://example.com"}, Methods: []string{"GET"}},
+		"no method":       {Origins: []string{"*"}},
+		"unknown method":  {Origins: []string{"*"}, Methods: []string{"FETCH"}},
+		"negative max":    {Origins: []string{"*"}, Methods: []string{"GET"}, MaxAge: -time.Second},
+	} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		if err := e.SetCORS(context.Background(), []storage.CORS{c}); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+
+		if n := len(fake.CallsTo(gcstest.OpBucketUpdate)); n != 0 {
+			t.Errorf("%s: bucket updated %d times, want never", name, n)
+		}
+	}
+}
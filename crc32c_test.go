@@ -0,0 +1,104 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func crc32c(s string) uint32 {
+	return crc32.Checksum([]byte(s), crc32.MakeTable(crc32.Castagnoli))
+}
+
+func TestUploadCRC32C(t *testing.T) {
+	const content = "hello, checksum"
+
+	for _, tt := range []struct {
+		name    string
+		opts    gcsenhancer.UploadOptions
+		file    func() io.Reader
+		wantCRC uint32
+		wantErr bool
+	}{
+		{
+			name:    "supplied",
+			opts:    gcsenhancer.UploadOptions{SendCRC32C: true, CRC32C: crc32c(content)},
+			wantCRC: crc32c(content),
+		},
+		{
+			name:    "wrong",
+			opts:    gcsenhancer.UploadOptions{SendCRC32C: true, CRC32C: crc32c(content) + 1},
+			wantCRC: crc32c(content) + 1,
+			wantErr: true,
+		},
+		{
+			name:    "computed",
+			opts:    gcsenhancer.UploadOptions{ComputeCRC32C: true},
+			wantCRC: crc32c(content),
+		},
+		{
+			name: "computed from a non-seekable reader",
+			opts: gcsenhancer.UploadOptions{ComputeCRC32C: true},
+			file: func() io.Reader {
+				return ioutil.NopCloser(strings.NewReader(content))
+			},
+			wantCRC: crc32c(content),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gcstest.New()
+			e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+			var (
+				sendCRC bool
+				sentCRC uint32
+			)
+
+			opts := tt.opts
+			opts.WriterFunc = func(w *storage.Writer) {
+				sendCRC, sentCRC = w.SendCRC32C, w.CRC32C
+			}
+
+			var file io.Reader = strings.NewReader(content)
+
+			if tt.file != nil {
+				file = tt.file()
+			}
+
+			_, err := e.Upload(context.Background(), file, "a.txt", opts)
+
+			if !sendCRC || sentCRC != tt.wantCRC {
+				t.Errorf("sent CRC32C %08x (SendCRC32C %v), want %08x", sentCRC, sendCRC, tt.wantCRC)
+			}
+
+			_, stored := fake.Object("bucket", "a.txt")
+
+			if tt.wantErr {
+				if err == nil {
+					t.Error("upload with a wrong CRC32C succeeded")
+				}
+
+				if stored {
+					t.Error("corrupted upload stored")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !stored {
+				t.Error("object not stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadCustomTime(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+	expiry := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := e.Upload(ctx, strings.NewReader("x"), "a.pdf", gcsenhancer.UploadOptions{CustomTime: expiry}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Upload(ctx, strings.NewReader("x"), "b.pdf", gcsenhancer.UploadOptions{}, gcsenhancer.UploadCustomTime(expiry)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.Upload(ctx, strings.NewReader("x"), "c.pdf", gcsenhancer.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]time.Time{
+		"a.pdf": expiry,
+		"b.pdf": expiry,
+		"c.pdf": {},
+	} {
+		if obj, _ := fake.Object("bucket", name); !obj.Attrs.CustomTime.Equal(want) {
+			t.Errorf("%s custom time = %v, want %v", name, obj.Attrs.CustomTime, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gcsenhancer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultMaxPixels is the default pixel budget of decoded images, 100 megapixels.
+const DefaultMaxPixels int64 = 100_000_000
+
+var ErrImageTooLarge = errors.New("gcsenhancer: image too large")
+
+// WithMaxPixels sets the maximum width * height of images decoded by the
+// enhancer. Zero disables the guard.
+func WithMaxPixels(n int64) Option {
+	return func(e *GCSEnhancer) {
+		e.maxPixels = n
+	}
+}
+
+// DecodeImage decodes an image, guarding against decode bombs: the
+// dimensions declared in the header are checked against the pixel budget,
+// see WithMaxPixels, before any pixel memory is allocated.
+func (e *GCSEnhancer) DecodeImage(r io.Reader) (image.Image, string, error) {
+	head := new(bytes.Buffer)
+
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, head))
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := e.checkPixels(cfg.Width, cfg.Height); err != nil {
+		return nil, "", err
+	}
+
+	return image.Decode(io.MultiReader(head, r))
+}
+
+func (e *GCSEnhancer) checkPixels(width, height int) error {
+	if e.maxPixels > 0 && int64(width)*int64(height) > e.maxPixels {
+		return fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrImageTooLarge, width, height, e.maxPixels)
+	}
+
+	return nil
+}
+
+// imageMagics are the signatures of the image formats SniffImageFormat
+// detects, "?" matching any byte.
+var imageMagics = []struct {
+	magic  string
+	format string
+}{
+	{"\x89PNG\r\n\x1a\n", "image/png"},
+	{"\xff\xd8\xff", "image/jpeg"},
+	{"GIF87a", "image/gif"},
+	{"GIF89a", "image/gif"},
+	{"RIFF????WEBP", "image/webp"},
+}
+
+// SniffImageFormat detects the format of the encoded image read from r, e.g.
+// "image/png", from its header, without consuming r: the returned reader
+// yields every byte of r, header included. Formats other than PNG, JPEG, GIF
+// and WebP are rejected with ErrUnsupportedFormat, along with the reader.
+func SniffImageFormat(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	// Peek returns less on short input, along with the error of the read.
+	head, err := br.Peek(12)
+
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", br, err
+	}
+
+	for _, m := range imageMagics {
+		if matchMagic(head, m.magic) {
+			return m.format, br, nil
+		}
+	}
+
+	return "", br, ErrUnsupportedFormat
+}
+
+func matchMagic(b []byte, magic string) bool {
+	if len(b) < len(magic) {
+		return false
+	}
+
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,128 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+)
+
+// pngHeader returns the signature and IHDR chunk of a width x height RGBA
+// PNG, without any pixel data.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 6 // RGBA
+
+	var b bytes.Buffer
+
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&b, binary.BigEndian, uint32(len(ihdr)-4))
+	b.Write(ihdr)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+
+	return b.Bytes()
+}
+
+func TestDecodeImageRejectsDecodeBombs(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(nil, "bucket", gcsenhancer.WithMaxPixels(1_000_000))
+
+	// Only the header is there: decoding past it would fail on the missing
+	// pixel data rather than with ErrImageTooLarge.
+	_, _, err := e.DecodeImage(bytes.NewReader(pngHeader(100000, 100000)))
+
+	if !errors.Is(err, gcsenhancer.ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+}
+
+func TestDecodeImageWithinBudget(t *testing.T) {
+	var b bytes.Buffer
+
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, max := range []int64{10000, 0} {
+		e := gcsenhancer.NewWithStorage(nil, "bucket", gcsenhancer.WithMaxPixels(max))
+
+		img, format, err := e.DecodeImage(bytes.NewReader(b.Bytes()))
+
+		if err != nil {
+			t.Fatalf("max %d: %v", max, err)
+		}
+
+		if format != "png" || img.Bounds().Dx() != 100 {
+			t.Errorf("max %d: decoded a %dpx %s, want the 100px png", max, img.Bounds().Dx(), format)
+		}
+	}
+
+	e := gcsenhancer.NewWithStorage(nil, "bucket", gcsenhancer.WithMaxPixels(9999))
+
+	if _, _, err := e.DecodeImage(bytes.NewReader(b.Bytes())); !errors.Is(err, gcsenhancer.ErrImageTooLarge) {
+		t.Errorf("err = %v, want ErrImageTooLarge one pixel over budget", err)
+	}
+}
+
+func TestSniffImageFormat(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	var pngBuf, jpegBuf, gifBuf bytes.Buffer
+
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jpeg.Encode(&jpegBuf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gif.Encode(&gifBuf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		content []byte
+		format  string
+		err     error
+	}{
+		{"png", pngBuf.Bytes(), "image/png", nil},
+		{"jpeg", jpegBuf.Bytes(), "image/jpeg", nil},
+		{"gif", gifBuf.Bytes(), "image/gif", nil},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), "image/webp", nil},
+		{"riff without webp", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "", gcsenhancer.ErrUnsupportedFormat},
+		{"bmp", []byte("BM\x36\x00\x00\x00\x00\x00"), "", gcsenhancer.ErrUnsupportedFormat},
+		{"short", []byte("GI"), "", gcsenhancer.ErrUnsupportedFormat},
+		{"empty", nil, "", gcsenhancer.ErrUnsupportedFormat},
+	} {
+		// One byte at a time, so the header takes several reads.
+		format, r, err := gcsenhancer.SniffImageFormat(iotest.OneByteReader(bytes.NewReader(tt.content)))
+
+		if format != tt.format || !errors.Is(err, tt.err) {
+			t.Errorf("%s: sniffed %q, %v, want %q, %v", tt.name, format, err, tt.format, tt.err)
+		}
+
+		got, err := ioutil.ReadAll(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, tt.content) {
+			t.Errorf("%s: the returned reader yields %d bytes, want all %d", tt.name, len(got), len(tt.content))
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"cloud.google.com/go/storage"
+)
+
+var (
+	ErrEmptyPrefix = errors.New("gcsenhancer: empty prefix")
+	ErrNotImageKey = errors.New("gcsenhancer: not an image key")
+)
+
+// DeletePrefix deletes every object under prefix, e.g. "tenants/42/", in
+// parallel and returns the number of deleted objects. An empty prefix is
+// rejected with ErrEmptyPrefix rather than wiping the whole bucket.
+func (e *GCSEnhancer) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+
+	objects, err := e.List(ctx, prefix, true)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+
+	err = e.runBounded(ctx, len(objects), func(ctx context.Context, i int) error {
+		if err := e.deleteObject(ctx, objects[i]); err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&deleted, 1)
+
+		return nil
+	})
+
+	return int(deleted), err
+}
+
+// DeleteWithCompanions deletes the original image stored under originalName
+// along with its thumbnail, the key of which is derived the way UploadImages
+// generates it. A missing thumbnail is ignored. The enhancer must be
+// configured with the key options the images were uploaded with, names it
+// can't pair are rejected with ErrNotImageKey before anything is deleted.
+func (e *GCSEnhancer) DeleteWithCompanions(ctx context.Context, originalName string) error {
+	thumbnailName, ok := e.thumbnailKey(originalName)
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotImageKey, originalName)
+	}
+
+	if err := e.Delete(ctx, originalName); err != nil {
+		return err
+	}
+
+	err := e.Delete(ctx, thumbnailName)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+type DeleteOptions struct {
+	// Concurrency caps the number of objects deleted in parallel. Defaults
+	// to the cap of the enhancer, see WithConcurrency.
+	Concurrency int
+
+	// StopOnError stops at the first failure: deletions in flight are
+	// cancelled, no new one is started, and the error is returned as is.
+	// Otherwise every name is attempted and the failures are returned in a
+	// DeleteErrors.
+	StopOnError bool
+}
+
+// DeleteErrors maps the names DeleteMany failed to delete to their error.
+type DeleteErrors map[string]error
+
+func (errs DeleteErrors) Error() string {
+	names := make([]string, 0, len(errs))
+
+	for name := range errs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return fmt.Sprintf("gcsenhancer: failed to delete %d objects, first %s: %v", len(errs), names[0], errs[names[0]])
+}
+
+// DeleteMany deletes the named objects in parallel and returns the number of
+// deleted objects. The order in which the objects are deleted is
+// unspecified. Held objects fail with ErrObjectHeld, see Delete.
+func (e *GCSEnhancer) DeleteMany(ctx context.Context, names []string, opts DeleteOptions) (int, error) {
+	limit := opts.Concurrency
+
+	if limit <= 0 {
+		limit = e.concurrency
+	}
+
+	var deleted int64
+
+	errs := make([]error, len(names))
+
+	err := runLimited(ctx, limit, len(names), func(ctx context.Context, i int) error {
+		if err := e.Delete(ctx, names[i]); err != nil {
+			if opts.StopOnError {
+				return err
+			}
+
+			errs[i] = err
+
+			return nil
+		}
+
+		atomic.AddInt64(&deleted, 1)
+
+		return nil
+	})
+
+	if err != nil {
+		return int(deleted), err
+	}
+
+	failed := DeleteErrors{}
+
+	for i, name := range names {
+		if errs[i] != nil {
+			failed[name] = errs[i]
+		}
+	}
+
+	if len(failed) > 0 {
+		return int(deleted), failed
+	}
+
+	return int(deleted), nil
+}
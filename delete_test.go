@@ -0,0 +1,238 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestDeletePrefix(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(3))
+
+	for _, name := range []string{
+		"tenants/42/a.txt",
+		"tenants/42/docs/b.txt",
+		"tenants/42/docs/c.txt",
+		"tenants/420/d.txt",
+		"tenants/7/e.txt",
+	} {
+		fake.Put("bucket", name, []byte("x"), storage.ObjectAttrs{})
+	}
+
+	deleted, err := e.DeletePrefix(context.Background(), "tenants/42/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted != 3 {
+		t.Errorf("deleted %d, want 3", deleted)
+	}
+
+	if got, want := fake.Objects("bucket"), []string{"tenants/420/d.txt", "tenants/7/e.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+}
+
+func TestDeletePrefixRejectsEmptyPrefix(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("x"), storage.ObjectAttrs{})
+
+	deleted, err := e.DeletePrefix(context.Background(), "")
+
+	if !errors.Is(err, gcsenhancer.ErrEmptyPrefix) {
+		t.Fatalf("err = %v, want ErrEmptyPrefix", err)
+	}
+
+	if deleted != 0 || len(fake.Objects("bucket")) != 1 {
+		t.Errorf("deleted %d objects with an empty prefix", deleted)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpList)); n != 0 {
+		t.Errorf("listed the bucket %d times, want never", n)
+	}
+}
+
+func TestDeleteWithCompanions(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithClock(fixedClock))
+
+	if _, err := e.UploadImages(context.Background(), pngImages("cat.png", "dog.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.DeleteWithCompanions(context.Background(), "cat_20220501120000.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fake.Objects("bucket"), []string{"dog_20220501120000.png", "dog_thumbnail_20220501120000.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("left %v, want %v", got, want)
+	}
+}
+
+func TestDeleteWithCompanionsMissingThumbnail(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "cat_20220501120000.png", []byte("png"), storage.ObjectAttrs{})
+
+	if err := e.DeleteWithCompanions(context.Background(), "cat_20220501120000.png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := fake.Objects("bucket"); len(names) != 0 {
+		t.Errorf("left %v", names)
+	}
+}
+
+func TestDeleteWithCompanionsRejectsForeignKeys(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "cat.png", []byte("png"), storage.ObjectAttrs{})
+
+	if err := e.DeleteWithCompanions(context.Background(), "cat.png"); !errors.Is(err, gcsenhancer.ErrNotImageKey) {
+		t.Fatalf("err = %v, want ErrNotImageKey", err)
+	}
+
+	if names := fake.Objects("bucket"); len(names) != 1 {
+		t.Errorf("deleted an unpaired key")
+	}
+}
+
+func TestDeleteManyBestEffort(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	for _, name := range []string{"a", "b", "c"} {
+		fake.Put("bucket", name, []byte("x"), storage.ObjectAttrs{})
+	}
+
+	fake.Put("bucket", "held1", []byte("x"), storage.ObjectAttrs{TemporaryHold: true})
+	fake.Put("bucket", "held2", []byte("x"), storage.ObjectAttrs{EventBasedHold: true})
+
+	deleted, err := e.DeleteMany(context.Background(), []string{"held1", "a", "missing", "b", "held2", "c"}, gcsenhancer.DeleteOptions{})
+
+	if deleted != 3 {
+		t.Errorf("deleted %d objects, want 3", deleted)
+	}
+
+	var failed gcsenhancer.DeleteErrors
+
+	if !errors.As(err, &failed) {
+		t.Fatalf("err = %v, want DeleteErrors", err)
+	}
+
+	for name, want := range map[string]error{
+		"held1":   gcsenhancer.ErrObjectHeld,
+		"held2":   gcsenhancer.ErrObjectHeld,
+		"missing": storage.ErrObjectNotExist,
+	} {
+		if !errors.Is(failed[name], want) {
+			t.Errorf("%s err = %v, want %v", name, failed[name], want)
+		}
+	}
+
+	if len(failed) != 3 {
+		t.Errorf("%d failures, want 3: %v", len(failed), failed)
+	}
+
+	if got := fake.Objects("bucket"); !reflect.DeepEqual(got, []string{"held1", "held2"}) {
+		t.Errorf("objects left = %v, want the held ones", got)
+	}
+}
+
+func TestDeleteManyStopOnError(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "held", []byte("x"), storage.ObjectAttrs{TemporaryHold: true})
+
+	for _, name := range []string{"a", "b", "c"} {
+		fake.Put("bucket", name, []byte("x"), storage.ObjectAttrs{})
+	}
+
+	deleted, err := e.DeleteMany(context.Background(), []string{"held", "a", "b", "c"}, gcsenhancer.DeleteOptions{
+		Concurrency: 1,
+		StopOnError: true,
+	})
+
+	if !errors.Is(err, gcsenhancer.ErrObjectHeld) {
+		t.Errorf("err = %v, want ErrObjectHeld as is", err)
+	}
+
+	var failed gcsenhancer.DeleteErrors
+
+	if errors.As(err, &failed) {
+		t.Errorf("err = %v, want the first error only", err)
+	}
+
+	if deleted != 0 || len(fake.CallsTo(gcstest.OpDelete)) != 0 {
+		t.Errorf("deleted %d objects after the failure, want none", deleted)
+	}
+
+	if n := len(fake.Objects("bucket")); n != 4 {
+		t.Errorf("%d objects left, want all 4", n)
+	}
+}
+
+func TestDeleteManyConcurrency(t *testing.T) {
+	var (
+		mu             sync.Mutex
+		inFlight, peak int
+	)
+
+	fake := gcstest.New()
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpDelete {
+			return nil
+		}
+
+		mu.Lock()
+		inFlight++
+
+		if inFlight > peak {
+			peak = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return nil
+	})
+
+	names := make([]string, 20)
+
+	for i := range names {
+		names[i] = fmt.Sprintf("obj%02d", i)
+		fake.Put("bucket", names[i], []byte("x"), storage.ObjectAttrs{})
+	}
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	deleted, err := e.DeleteMany(context.Background(), names, gcsenhancer.DeleteOptions{Concurrency: 3})
+
+	if err != nil || deleted != len(names) {
+		t.Fatalf("deleted %d, %v, want all %d", deleted, err, len(names))
+	}
+
+	if peak > 3 {
+		t.Errorf("%d deletions in flight, want at most 3", peak)
+	}
+}
@@ -0,0 +1,107 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+type DownloadOptions struct {
+	// ContentType overrides the content type reported for the object, e.g.
+	// when the stored one is wrong. The stored object is left untouched.
+	ContentType string
+
+	// Conditions are the preconditions of the read, e.g. MetagenerationMatch.
+	Conditions *storage.Conditions
+}
+
+// Download opens the object for reading and returns its file info. The
+// caller must close the returned body. The content of full reads is verified
+// against the stored CRC32C by the storage client.
+func (e *GCSEnhancer) Download(ctx context.Context, name string, opts DownloadOptions, extra ...DownloadOption) (io.ReadCloser, FileInfo, error) {
+	for _, opt := range extra {
+		opt(&opts)
+	}
+
+	object := e.bucket(e.bucketName).Object(name)
+
+	if opts.Conditions != nil {
+		object = object.If(*opts.Conditions)
+	}
+
+	attr, err := object.Attrs(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, FileInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+	}
+
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	// Pin the generation so the body matches the returned info.
+	r, err := object.Generation(attr.Generation).NewReader(ctx)
+
+	if err != nil {
+		return nil, FileInfo{}, err
+	}
+
+	info := e.fileInfo(attr)
+
+	if opts.ContentType != "" {
+		info.ContentType = opts.ContentType
+	}
+
+	return r, info, nil
+}
+
+// DownloadIfChanged downloads the object unless its generation is still
+// knownGen, e.g. the generation of a cached copy. changed is false, and no
+// body is returned, when the object is unchanged. Otherwise the caller must
+// close the returned body. A zero knownGen, i.e. nothing cached, always
+// downloads the object.
+func (e *GCSEnhancer) DownloadIfChanged(ctx context.Context, name string, knownGen int64) (body io.ReadCloser, attr *storage.ObjectAttrs, changed bool, err error) {
+	object := e.bucket(e.bucketName).Object(name)
+	read := object
+
+	// Zero conditions are rejected by the client as empty.
+	if knownGen != 0 {
+		read = object.If(storage.Conditions{GenerationNotMatch: knownGen})
+	}
+
+	r, err := read.NewReader(ctx)
+
+	if isNotModified(err) {
+		return nil, nil, false, nil
+	}
+
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// Attributes of the very generation being read.
+	attr, err = object.Generation(r.Attrs().Generation).Attrs(ctx)
+
+	if err != nil {
+		r.Close()
+
+		return nil, nil, false, err
+	}
+
+	return r, attr, true, nil
+}
+
+func isNotModified(err error) bool {
+	var apiErr *googleapi.Error
+
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.Code == http.StatusNotModified || apiErr.Code == http.StatusPreconditionFailed
+}
@@ -0,0 +1,120 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestDownloadIfChanged(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	attrs := fake.Put("bucket", "a.txt", []byte("v1"), storage.ObjectAttrs{})
+
+	body, attr, changed, err := e.DownloadIfChanged(ctx, "a.txt", attrs.Generation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed || body != nil || attr != nil {
+		t.Errorf("unchanged object returned changed=%v body=%v attrs=%v", changed, body, attr)
+	}
+
+	fake.Put("bucket", "a.txt", []byte("v2"), storage.ObjectAttrs{})
+
+	body, attr, changed, err = e.DownloadIfChanged(ctx, "a.txt", attrs.Generation)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer body.Close()
+
+	b, _ := ioutil.ReadAll(body)
+
+	if !changed || string(b) != "v2" {
+		t.Errorf("changed=%v body=%q, want true v2", changed, b)
+	}
+
+	if attr.Generation == attrs.Generation {
+		t.Errorf("attrs of generation %d, want the new one", attr.Generation)
+	}
+}
+
+func TestDownloadIfChangedWithoutKnownGeneration(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("v1"), storage.ObjectAttrs{})
+
+	body, _, changed, err := e.DownloadIfChanged(context.Background(), "a.txt", 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer body.Close()
+
+	if !changed {
+		t.Error("changed = false, want true with nothing cached")
+	}
+}
+
+func TestDownloadContentTypeOverride(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	fake.Put("bucket", "report.pdf", []byte("%PDF"), storage.ObjectAttrs{ContentType: "application/octet-stream"})
+
+	for _, tt := range []struct {
+		opts  gcsenhancer.DownloadOptions
+		extra []gcsenhancer.DownloadOption
+		want  string
+	}{
+		{gcsenhancer.DownloadOptions{}, nil, "application/octet-stream"},
+		{gcsenhancer.DownloadOptions{ContentType: "application/pdf"}, nil, "application/pdf"},
+		{gcsenhancer.DownloadOptions{}, []gcsenhancer.DownloadOption{gcsenhancer.DownloadContentType("application/pdf")}, "application/pdf"},
+	} {
+		body, info, err := e.Download(ctx, "report.pdf", tt.opts, tt.extra...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := ioutil.ReadAll(body)
+		body.Close()
+
+		if string(b) != "%PDF" {
+			t.Errorf("body = %q", b)
+		}
+
+		if info.ContentType != tt.want {
+			t.Errorf("reported %q, want %q", info.ContentType, tt.want)
+		}
+	}
+
+	if obj, _ := fake.Object("bucket", "report.pdf"); obj.Attrs.ContentType != "application/octet-stream" {
+		t.Errorf("stored content type changed to %q", obj.Attrs.ContentType)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpUpdate)); n != 0 {
+		t.Errorf("%d updates, want the object untouched", n)
+	}
+}
+
+func TestDownloadNotFound(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	if _, _, err := e.Download(context.Background(), "missing.txt", gcsenhancer.DownloadOptions{}); !errors.Is(err, gcsenhancer.ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrObjectNotFound", err)
+	}
+}
@@ -0,0 +1,49 @@
+package gcsenhancer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrDuplicateNames = errors.New("gcsenhancer: duplicate image names")
+
+// WithDuplicateNameCheck makes UploadImages reject batches in which several
+// images would be stored under the same key, e.g. two "avatar.png" stamped
+// within the same second, with ErrDuplicateNames listing the keys and the
+// names of the images, before anything is uploaded. The keys generated for
+// the batch are compared, so every key option is accounted for.
+func WithDuplicateNameCheck() Option {
+	return func(e *GCSEnhancer) {
+		e.checkDuplicates = true
+	}
+}
+
+// duplicateNames returns an error listing the keys shared by several of imgs,
+// objsPerImage being the objects prepared for each of them.
+func duplicateNames(imgs []Images, objsPerImage [][]*ObjectInfo) error {
+	owners := make(map[string][]string)
+
+	for i, objs := range objsPerImage {
+		for _, obj := range objs {
+			owners[obj.Name] = append(owners[obj.Name], imgs[i].Name)
+		}
+	}
+
+	var dups []string
+
+	for key, names := range owners {
+		if len(names) > 1 {
+			dups = append(dups, fmt.Sprintf("%s (%s)", key, strings.Join(names, ", ")))
+		}
+	}
+
+	if len(dups) == 0 {
+		return nil
+	}
+
+	sort.Strings(dups)
+
+	return fmt.Errorf("%w: %s", ErrDuplicateNames, strings.Join(dups, "; "))
+}
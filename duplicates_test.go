@@ -0,0 +1,93 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func fixedClock() time.Time {
+	return time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func pngImages(names ...string) []gcsenhancer.Images {
+	imgs := make([]gcsenhancer.Images, len(names))
+
+	for i, name := range names {
+		imgs[i] = gcsenhancer.Images{
+			Name:      name,
+			Mime:      "image/png",
+			OrigImage: image.NewRGBA(image.Rect(0, 0, 4, 4)),
+		}
+	}
+
+	return imgs
+}
+
+func TestDuplicateNameCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		opts  []gcsenhancer.Option
+		files []string
+		dup   bool
+	}{
+		{"same name", nil, []string{"a/avatar.png", "b/avatar.png"}, true},
+		{"distinct names", nil, []string{"a.png", "b.png"}, false},
+		{"same stamped key", nil, []string{"a.b.png", "a.c.png"}, true},
+		{"stable keys", []gcsenhancer.Option{gcsenhancer.WithStableKeys()}, []string{"a/avatar.png", "b/avatar.png"}, false},
+		{"sequential keys", []gcsenhancer.Option{gcsenhancer.WithSequentialKeys()}, []string{"avatar.png", "avatar.png"}, false},
+		{"lowercase keys", []gcsenhancer.Option{gcsenhancer.WithLowercaseKeys()}, []string{"A.png", "a.png"}, true},
+		{"uuid template", []gcsenhancer.Option{gcsenhancer.WithKeyTemplate(mustTemplate(t, "{uuid}{ext}"))}, []string{"a.png", "a.png"}, false},
+		{"date template", []gcsenhancer.Option{gcsenhancer.WithKeyTemplate(mustTemplate(t, "{yyyy}/{base}{ext}"))}, []string{"x/a.png", "y/a.png"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := gcstest.New()
+			opts := append([]gcsenhancer.Option{gcsenhancer.WithClock(fixedClock), gcsenhancer.WithDuplicateNameCheck()}, tc.opts...)
+			e := gcsenhancer.NewWithStorage(fake, "bucket", opts...)
+
+			_, err := e.UploadImages(context.Background(), pngImages(tc.files...))
+
+			if tc.dup {
+				if !errors.Is(err, gcsenhancer.ErrDuplicateNames) {
+					t.Fatalf("err = %v, want ErrDuplicateNames", err)
+				}
+
+				for _, name := range tc.files {
+					if !strings.Contains(err.Error(), name) {
+						t.Errorf("error %q doesn't list %s", err, name)
+					}
+				}
+
+				if n := len(fake.CallsTo(gcstest.OpWrite)); n != 0 {
+					t.Errorf("%d objects written, want none", n)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n := len(fake.Objects("bucket")); n != 2*len(tc.files) {
+				t.Errorf("%d objects stored, want %d", n, 2*len(tc.files))
+			}
+		})
+	}
+}
+
+func mustTemplate(t *testing.T, tmpl string) *gcsenhancer.KeyTemplate {
+	kt, err := gcsenhancer.ParseKeyTemplate(tmpl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return kt
+}
@@ -0,0 +1,248 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var ErrUnsupportedFormat = errors.New("gcsenhancer: unsupported image format")
+
+// encodeError is the failure of an encoder while streaming an image upload.
+type encodeError struct {
+	index int
+	name  string
+	err   error
+}
+
+func (e *encodeError) Error() string {
+	return fmt.Sprintf("encoding image %d (%s): %v", e.index, e.name, e.err)
+}
+
+func (e *encodeError) Unwrap() error {
+	return e.err
+}
+
+// EncodeFunc encodes img into w. size tells whether the original or the
+// thumbnail is being encoded so the encoder can pick a suitable quality.
+type EncodeFunc func(w io.Writer, img image.Image, size ImageSize) error
+
+func (e *GCSEnhancer) defaultEncoders() map[string]EncodeFunc {
+	return map[string]EncodeFunc{
+		"image/png":  encodePNG,
+		"image/jpeg": e.encodeJPEG,
+		"image/gif":  encodeGIF,
+	}
+}
+
+func encodePNG(w io.Writer, img image.Image, size ImageSize) error {
+	enc := png.Encoder{
+		CompressionLevel: png.BestCompression,
+	}
+
+	return enc.Encode(w, img)
+}
+
+// QualityFunc returns the JPEG quality, 1 to 100, of an image of the given
+// size and dimensions.
+type QualityFunc func(size ImageSize, width, height int) int
+
+// defaultQuality encodes originals at jpeg.DefaultQuality and thumbnails at 40.
+func defaultQuality(size ImageSize, width, height int) int {
+	if size == Thumbnail {
+		return 40
+	}
+
+	return jpeg.DefaultQuality
+}
+
+// WithJPEGQuality sets the function picking the quality of the JPEG encoded
+// images from their dimensions, e.g. to lower the quality of the smallest
+// thumbnails further. Defaults to 75 for originals and 40 for thumbnails.
+func WithJPEGQuality(fn QualityFunc) Option {
+	return func(e *GCSEnhancer) {
+		e.quality = fn
+	}
+}
+
+func (e *GCSEnhancer) encodeJPEG(w io.Writer, img image.Image, size ImageSize) error {
+	b := img.Bounds()
+
+	return jpeg.Encode(w, img, &jpeg.Options{
+		Quality: e.quality(size, b.Dx(), b.Dy()),
+	})
+}
+
+func encodeGIF(w io.Writer, img image.Image, size ImageSize) error {
+	return gif.Encode(w, img, &gif.Options{})
+}
+
+// WithEncodeWorkers caps the number of images prepared and encoded in
+// parallel. Encoding is CPU bound, the default is runtime.GOMAXPROCS(0).
+func WithEncodeWorkers(n int) Option {
+	return func(e *GCSEnhancer) {
+		if n > 0 {
+			e.encodeWorkers = n
+		}
+	}
+}
+
+// prepareImages prepares the objects of every image in parallel, on at most
+// encodeWorkers goroutines. The objects and the error of each image are
+// returned at the index of the image.
+func (e *GCSEnhancer) prepareImages(ctx context.Context, imgs []Images) ([][]*ObjectInfo, []error) {
+	objs := make([][]*ObjectInfo, len(imgs))
+	errs := make([]error, len(imgs))
+
+	var wg sync.WaitGroup
+
+	sem := make(chan struct{}, e.encodeWorkers)
+
+	for i := range imgs {
+		// Images left once the context is done are not prepared.
+		select {
+		case <-ctx.Done():
+			for j := i; j < len(imgs); j++ {
+				errs[j] = ctx.Err()
+			}
+
+			wg.Wait()
+
+			return objs, errs
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			objs[i], errs[i] = e.imageObjects(i, imgs[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	return objs, errs
+}
+
+// imageObject prepares the upload of img encoded with the encoder registered
+// for format. Encoding is deferred to the upload, which streams the encoder
+// output so the encoded bytes are never held in memory as a whole.
+func (e *GCSEnhancer) imageObject(img image.Image, format string, size ImageSize, name string) (*ObjectInfo, error) {
+	enc, ok := e.encoders[format]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	b := img.Bounds()
+
+	return &ObjectInfo{
+		Size:   size,
+		Name:   name,
+		Format: format,
+		encode: func(w io.Writer) error {
+			return enc(w, img, size)
+		},
+		pixels: int64(b.Dx()) * int64(b.Dy()),
+	}, nil
+}
+
+// reader returns the content of obj. Lazily encoded objects are streamed
+// through a pipe, the encoder holding a slot of sem while running. The
+// returned func must be called once the upload is done to stop the encoder.
+func (obj *ObjectInfo) reader(sem chan struct{}) (io.Reader, func()) {
+	if obj.encode == nil {
+		return obj.Reader, func() {}
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+
+		pw.CloseWithError(obj.encode(pw))
+	}()
+
+	return pr, func() {
+		pr.Close()
+	}
+}
+
+// WithMimeSniffing makes UploadImages detect the mime type of an image from
+// Images.OrigBytes rather than trusting Images.Mime. The detected mime picks
+// the encoder and the content type of the uploaded objects.
+func WithMimeSniffing() Option {
+	return func(e *GCSEnhancer) {
+		e.sniffMime = true
+	}
+}
+
+// WithPreserveOriginal makes UploadImages store Images.OrigBytes as the
+// original, byte for byte, instead of re-encoding OrigImage. This avoids
+// quality loss and keeps ICC profiles and EXIF. Only the thumbnail, and
+// originals of other output formats, are encoded.
+func WithPreserveOriginal() Option {
+	return func(e *GCSEnhancer) {
+		e.preserveOriginal = true
+	}
+}
+
+// sniffImageMime detects the mime type of the encoded image b. It falls back
+// to declared when b is not a recognized image.
+func sniffImageMime(b []byte, declared string) string {
+	detected := http.DetectContentType(b)
+
+	if !strings.HasPrefix(detected, "image/") {
+		return declared
+	}
+
+	if detected != declared {
+		log.Printf("gcsenhancer: image declared as %s is actually %s", declared, detected)
+	}
+
+	return detected
+}
+
+var formatExts = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// formatExt returns the file extension, without the leading dot, of a mime type.
+func formatExt(format string) string {
+	if ext, ok := formatExts[format]; ok {
+		return ext
+	}
+
+	if exts, _ := mime.ExtensionsByType(format); len(exts) > 0 {
+		return strings.TrimPrefix(exts[0], ".")
+	}
+
+	return strings.TrimPrefix(format, "image/")
+}
+
+func replaceExt(filename, ext string) string {
+	secs := strings.Split(filename, ".")
+
+	if len(secs) == 1 {
+		return fmt.Sprintf("%s.%s", filename, ext)
+	}
+
+	return fmt.Sprintf("%s.%s", strings.Join(secs[:len(secs)-1], "."), ext)
+}
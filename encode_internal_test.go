@@ -0,0 +1,101 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestObjectInfoReaderStreamsEncoding(t *testing.T) {
+	want := bytes.Repeat([]byte("pixel"), 100000)
+
+	obj := &ObjectInfo{encode: func(w io.Writer) error {
+		for i := 0; i < len(want); i += 4096 {
+			end := i + 4096
+
+			if end > len(want) {
+				end = len(want)
+			}
+
+			if _, err := w.Write(want[i:end]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}}
+
+	r, done := obj.reader(make(chan struct{}, 1))
+	defer done()
+
+	got, err := ioutil.ReadAll(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("read %d bytes, want the %d encoded", len(got), len(want))
+	}
+}
+
+func TestObjectInfoReaderPropagatesEncodeError(t *testing.T) {
+	errEncode := errors.New("encoder failed")
+
+	obj := &ObjectInfo{encode: func(w io.Writer) error {
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+
+		return errEncode
+	}}
+
+	obj.wrapEncodeErr(3, "cat.png")
+
+	r, done := obj.reader(make(chan struct{}, 1))
+	defer done()
+
+	got, err := ioutil.ReadAll(r)
+
+	if string(got) != "partial" {
+		t.Errorf("read %q, want the bytes written before the failure", got)
+	}
+
+	if !errors.Is(err, errEncode) {
+		t.Fatalf("err = %v, want the encoder error", err)
+	}
+
+	var encErr *encodeError
+
+	if !errors.As(err, &encErr) || encErr.index != 3 || encErr.name != "cat.png" {
+		t.Errorf("err = %v, want it to name image 3 cat.png", err)
+	}
+}
+
+func TestObjectInfoReaderStopsEncoder(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	obj := &ObjectInfo{encode: func(w io.Writer) error {
+		for {
+			if _, err := w.Write(make([]byte, 1024)); err != nil {
+				stopped <- err
+
+				return err
+			}
+		}
+	}}
+
+	r, done := obj.reader(make(chan struct{}, 1))
+
+	if _, err := r.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	done()
+
+	if err := <-stopped; !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("encoder stopped with %v, want io.ErrClosedPipe", err)
+	}
+}
@@ -0,0 +1,323 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadImagesEncodeFailure(t *testing.T) {
+	errEncode := errors.New("encoder failed")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithEncoder("image/png", func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+		if _, err := w.Write(make([]byte, 64<<10)); err != nil {
+			return err
+		}
+
+		return errEncode
+	}))
+
+	_, err := e.UploadImages(context.Background(), pngImages("cat.png"))
+
+	if !errors.Is(err, errEncode) {
+		t.Fatalf("err = %v, want the encoder error", err)
+	}
+
+	if names := fake.Objects("bucket"); len(names) != 0 {
+		t.Errorf("objects %v stored from a failed encoding", names)
+	}
+}
+
+func TestUploadImagesEncodeErrorNamesImage(t *testing.T) {
+	errEncode := errors.New("encoder failed")
+
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithEncoder("image/png", func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+		// Only the second image is 8 pixels wide.
+		if img.Bounds().Dx() == 8 {
+			return errEncode
+		}
+
+		_, err := w.Write([]byte("png"))
+
+		return err
+	}))
+
+	imgs := pngImages("first.png", "second.png")
+	imgs[1].OrigImage = image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	_, err := e.UploadImages(context.Background(), imgs)
+
+	if !errors.Is(err, errEncode) {
+		t.Fatalf("err = %v, want the encoder error", err)
+	}
+
+	if msg := err.Error(); !strings.Contains(msg, "image 1") || !strings.Contains(msg, "second.png") {
+		t.Errorf("error %q doesn't name image 1 second.png", msg)
+	}
+}
+
+func TestUploadImagesMimeSniffing(t *testing.T) {
+	for _, sniff := range []bool{true, false} {
+		fake := gcstest.New()
+
+		marker := func(format string) gcsenhancer.EncodeFunc {
+			return func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+				_, err := io.WriteString(w, format)
+
+				return err
+			}
+		}
+
+		opts := []gcsenhancer.Option{
+			gcsenhancer.WithEncoder("image/png", marker("png")),
+			gcsenhancer.WithEncoder("image/jpeg", marker("jpeg")),
+		}
+
+		if sniff {
+			opts = append(opts, gcsenhancer.WithMimeSniffing())
+		}
+
+		e := gcsenhancer.NewWithStorage(fake, "bucket", opts...)
+
+		// A PNG mislabeled as JPEG.
+		imgs := pngImages("cat.jpg")
+		imgs[0].Mime = "image/jpeg"
+		imgs[0].OrigBytes = pngBytes
+
+		if _, err := e.UploadImages(context.Background(), imgs); err != nil {
+			t.Fatal(err)
+		}
+
+		want, wantType := "jpeg", "image/jpeg"
+
+		if sniff {
+			want, wantType = "png", "image/png"
+		}
+
+		for _, name := range fake.Objects("bucket") {
+			obj, _ := fake.Object("bucket", name)
+
+			if string(obj.Content) != want || obj.Attrs.ContentType != wantType {
+				t.Errorf("sniff %v: %s encoded by %s as %s, want %s as %s", sniff, name, obj.Content, obj.Attrs.ContentType, want, wantType)
+			}
+		}
+	}
+}
+
+func TestUploadImagesPreserveOriginal(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+
+	var orig bytes.Buffer
+
+	if err := jpeg.Encode(&orig, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Trailing bytes, like an ICC profile, a re-encoding would drop.
+	orig.WriteString("trailing")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithPreserveOriginal(), gcsenhancer.WithThumbnailSize(16, 16))
+
+	_, err := e.UploadImages(context.Background(), []gcsenhancer.Images{{
+		Name:      "photo.jpg",
+		Mime:      "image/jpeg",
+		OrigImage: img,
+		OrigBytes: orig.Bytes(),
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := fake.Objects("bucket")
+
+	if len(names) != 2 {
+		t.Fatalf("stored %v, want an original and a thumbnail", names)
+	}
+
+	for _, name := range names {
+		obj, _ := fake.Object("bucket", name)
+
+		if strings.Contains(name, "thumbnail") {
+			thumb, err := jpeg.DecodeConfig(bytes.NewReader(obj.Content))
+
+			if err != nil || thumb.Width != 16 {
+				t.Errorf("thumbnail %s: %dpx wide, err %v, want an encoded 16px thumbnail", name, thumb.Width, err)
+			}
+
+			continue
+		}
+
+		if !bytes.Equal(obj.Content, orig.Bytes()) {
+			t.Errorf("original %s is not byte-identical to OrigBytes", name)
+		}
+	}
+}
+
+func TestEncodeWorkers(t *testing.T) {
+	const workers = 2
+
+	var (
+		mu            sync.Mutex
+		inFlight, max int
+	)
+
+	encode := func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+		mu.Lock()
+		inFlight++
+
+		if inFlight > max {
+			max = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return png.Encode(w, img)
+	}
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket",
+		gcsenhancer.WithEncoder("image/png", encode),
+		gcsenhancer.WithEncodeWorkers(workers),
+		gcsenhancer.WithConcurrency(8))
+
+	names := make([]string, 8)
+
+	for i := range names {
+		names[i] = fmt.Sprintf("%d.png", i)
+	}
+
+	if _, err := e.UploadImages(context.Background(), pngImages(names...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if max > workers {
+		t.Errorf("%d encodes in flight, want at most %d", max, workers)
+	}
+
+	if max < 2 {
+		t.Errorf("%d encodes in flight, want them parallel", max)
+	}
+
+	stored := fake.Objects("bucket")
+
+	if len(stored) != 2*len(names) {
+		t.Fatalf("%d objects stored, want %d", len(stored), 2*len(names))
+	}
+
+	for _, name := range stored {
+		obj, _ := fake.Object("bucket", name)
+
+		if _, err := png.Decode(bytes.NewReader(obj.Content)); err != nil {
+			t.Errorf("%s is not a valid PNG: %v", name, err)
+		}
+	}
+}
+
+func TestJPEGQualityFunc(t *testing.T) {
+	type call struct {
+		size          gcsenhancer.ImageSize
+		width, height int
+	}
+
+	var (
+		mu    sync.Mutex
+		calls = make(map[call]bool)
+	)
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(), gcsenhancer.WithThumbnailSize(100, 100),
+		gcsenhancer.WithJPEGQuality(func(size gcsenhancer.ImageSize, width, height int) int {
+			mu.Lock()
+			calls[call{size, width, height}] = true
+			mu.Unlock()
+
+			return 50
+		}),
+	)
+
+	_, err := e.UploadImages(context.Background(), []gcsenhancer.Images{{
+		Name:      "photo.jpg",
+		Mime:      "image/jpeg",
+		OrigImage: image.NewRGBA(image.Rect(0, 0, 400, 200)),
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[call]bool{
+		{gcsenhancer.Original, 400, 200}: true,
+		{gcsenhancer.Thumbnail, 100, 50}: true,
+	}
+
+	if len(calls) != len(want) {
+		t.Errorf("quality asked for %v, want %v", calls, want)
+	}
+
+	for c := range want {
+		if !calls[c] {
+			t.Errorf("quality not asked for %v, asked for %v", c, calls)
+		}
+	}
+}
+
+// BenchmarkEncodeWorkers compares encoding a batch with PNG BestCompression
+// serially and on GOMAXPROCS workers.
+func BenchmarkEncodeWorkers(b *testing.B) {
+	enc := &png.Encoder{CompressionLevel: png.BestCompression}
+	imgs := make([]gcsenhancer.Images, 8)
+
+	for i := range imgs {
+		img := image.NewRGBA(image.Rect(0, 0, 512, 512))
+
+		for j := range img.Pix {
+			img.Pix[j] = byte(j * (i + 7))
+		}
+
+		imgs[i] = gcsenhancer.Images{Name: fmt.Sprintf("%d.png", i), Mime: "image/png", OrigImage: img}
+	}
+
+	for name, workers := range map[string]int{"serial": 1, "parallel": 0} {
+		b.Run(name, func(b *testing.B) {
+			opts := []gcsenhancer.Option{
+				gcsenhancer.WithEncoder("image/png", func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+					return enc.Encode(w, img)
+				}),
+				gcsenhancer.WithConcurrency(len(imgs) * 2),
+			}
+
+			if workers > 0 {
+				opts = append(opts, gcsenhancer.WithEncodeWorkers(workers))
+			}
+
+			for i := 0; i < b.N; i++ {
+				e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", opts...)
+
+				if _, err := e.UploadImages(context.Background(), imgs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package gcsenhancer
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"cloud.google.com/go/storage"
+)
+
+// RotateEncryption rewrites every object under prefix encrypted with another
+// key than the Cloud KMS key newKeyName, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k", so it is encrypted with
+// newKeyName, and returns the number of objects rewritten. Objects are
+// rewritten in parallel, guarded by their generation. Objects encrypted with
+// customer-supplied keys can't be read without their key and fail the
+// rotation.
+//
+// Like ChangeStorageClass, rewriting changes the generation of the objects
+// and keeps public objects public.
+func (e *GCSEnhancer) RotateEncryption(ctx context.Context, prefix, newKeyName string) (int, error) {
+	objects, err := e.listWithACL(ctx, prefix)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+
+	err = e.runBounded(ctx, len(objects), func(ctx context.Context, i int) error {
+		attr := objects[i]
+
+		// The key of an object is reported along with its version.
+		if attr.KMSKeyName == newKeyName || strings.HasPrefix(attr.KMSKeyName, newKeyName+"/cryptoKeyVersions/") {
+			return nil
+		}
+
+		object := e.bucket(e.bucketName).Object(attr.Name)
+
+		copier := object.
+			If(storage.Conditions{GenerationMatch: attr.Generation}).
+			CopierFrom(object.Generation(attr.Generation))
+		copier.Settings().DestinationKMSKeyName = newKeyName
+		copier.Settings().PredefinedACL = rewriteACL(attr)
+
+		if _, err := copier.Run(ctx); err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&count, 1)
+
+		return nil
+	})
+
+	return int(count), err
+}
@@ -0,0 +1,50 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestRotateEncryption(t *testing.T) {
+	const (
+		oldKey = "projects/p/locations/l/keyRings/r/cryptoKeys/old"
+		newKey = "projects/p/locations/l/keyRings/r/cryptoKeys/new"
+	)
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("a"), storage.ObjectAttrs{KMSKeyName: oldKey + "/cryptoKeyVersions/1", ACL: publicRead})
+	fake.Put("bucket", "b.txt", []byte("b"), storage.ObjectAttrs{KMSKeyName: newKey + "/cryptoKeyVersions/2"})
+	fake.Put("bucket", "c.txt", []byte("c"), storage.ObjectAttrs{})
+
+	n, err := e.RotateEncryption(context.Background(), "", newKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("rewrote %d objects, want 2", n)
+	}
+
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if obj, _ := fake.Object("bucket", name); obj.Attrs.KMSKeyName != newKey {
+			t.Errorf("%s encrypted with %q, want %q", name, obj.Attrs.KMSKeyName, newKey)
+		}
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpCopy)); n != 2 {
+		t.Errorf("%d rewrites, want 2, b.txt already uses the key", n)
+	}
+
+	a, _ := fake.Object("bucket", "a.txt")
+
+	if len(a.Attrs.ACL) != 1 || a.Attrs.ACL[0].Entity != storage.AllUsers {
+		t.Errorf("ACL = %v, want public kept", a.Attrs.ACL)
+	}
+}
@@ -0,0 +1,46 @@
+package gcsenhancer
+
+// ObjectResult is the outcome of the upload of a single object of a batch.
+type ObjectResult struct {
+	Name  string
+	Link  string
+	Bytes int64
+	Err   error
+}
+
+// WithOnObjectComplete sets a callback invoked as each object uploaded by
+// UploadImages completes, successfully or not, e.g. to report live progress.
+// Calls are serialized, fn is never called concurrently, and all of them
+// return before UploadImages does. Objects never started, once the batch
+// failed or its context is done, are not reported.
+func WithOnObjectComplete(fn func(ObjectResult)) Option {
+	return func(e *GCSEnhancer) {
+		e.onObjectComplete = fn
+	}
+}
+
+// objectEvents starts delivering the events sent on the returned channel to
+// the completion callback, from a single goroutine. wait closes the channel
+// and waits for the delivery of the pending events. The channel is nil when
+// no callback is set.
+func (e *GCSEnhancer) objectEvents() (chan<- ObjectResult, func()) {
+	if e.onObjectComplete == nil {
+		return nil, func() {}
+	}
+
+	events := make(chan ObjectResult)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for ev := range events {
+			e.onObjectComplete(ev)
+		}
+	}()
+
+	return events, func() {
+		close(events)
+		<-done
+	}
+}
@@ -0,0 +1,90 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestOnObjectComplete(t *testing.T) {
+	var (
+		running int32
+		results = make(map[string]gcsenhancer.ObjectResult)
+	)
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(),
+		gcsenhancer.WithOnObjectComplete(func(r gcsenhancer.ObjectResult) {
+			if atomic.AddInt32(&running, 1) != 1 {
+				t.Error("callback called concurrently")
+			}
+
+			defer atomic.AddInt32(&running, -1)
+
+			if _, ok := results[r.Name]; ok {
+				t.Errorf("%s reported twice", r.Name)
+			}
+
+			results[r.Name] = r
+		}),
+	)
+
+	if _, err := e.UploadImages(context.Background(), pngImages("a.png", "b.png", "c.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	names := fake.Objects("bucket")
+
+	if len(results) != len(names) {
+		t.Fatalf("%d events, want one per object of %v", len(results), names)
+	}
+
+	for _, name := range names {
+		r, ok := results[name]
+
+		if !ok {
+			t.Errorf("%s not reported", name)
+
+			continue
+		}
+
+		obj, _ := fake.Object("bucket", name)
+
+		if r.Err != nil || r.Bytes != obj.Attrs.Size || !strings.Contains(r.Link, name) {
+			t.Errorf("%s reported as %+v, want its link and %d bytes", name, r, obj.Attrs.Size)
+		}
+	}
+}
+
+func TestOnObjectCompleteReportsFailures(t *testing.T) {
+	errDenied := errors.New("denied")
+	errs := make(map[string]error)
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(),
+		gcsenhancer.WithOnObjectComplete(func(r gcsenhancer.ObjectResult) {
+			errs[r.Name] = r.Err
+		}),
+	)
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && c.Object == "a_thumbnail.png" {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	if _, err := e.UploadImages(context.Background(), pngImages("a.png")); err == nil {
+		t.Fatal("upload succeeded despite the failed write")
+	}
+
+	if err, ok := errs["a_thumbnail.png"]; !ok || !errors.Is(err, errDenied) {
+		t.Errorf("a_thumbnail.png reported with %v, want the write error", err)
+	}
+}
@@ -0,0 +1,231 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const exifTagOrientation = 0x0112
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiffReader reads IFD entries of the TIFF structure embedded in an EXIF block.
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// exifTIFF locates the EXIF APP1 segment of a JPEG and returns a reader of
+// its TIFF structure. ok is false when the bytes carry no EXIF block.
+func exifTIFF(b []byte) (*tiffReader, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, false
+	}
+
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return nil, false
+		}
+
+		marker := b[i+1]
+
+		// Start of scan / end of image, no more metadata segments follow.
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, false
+		}
+
+		length := int(binary.BigEndian.Uint16(b[i+2 : i+4]))
+
+		if length < 2 || i+2+length > len(b) {
+			return nil, false
+		}
+
+		seg := b[i+4 : i+2+length]
+
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return newTIFFReader(seg[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return nil, false
+}
+
+func newTIFFReader(data []byte) (*tiffReader, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+
+	var order binary.ByteOrder
+
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, false
+	}
+
+	return &tiffReader{data: data, order: order}, true
+}
+
+// firstIFD returns the offset of IFD0.
+func (t *tiffReader) firstIFD() uint32 {
+	return t.order.Uint32(t.data[4:8])
+}
+
+// readIFD reads the entries of the IFD located at offset.
+func (t *tiffReader) readIFD(offset uint32) map[uint16]tiffEntry {
+	entries := make(map[uint16]tiffEntry)
+
+	if int(offset)+2 > len(t.data) {
+		return entries
+	}
+
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+
+	for i := 0; i < n; i++ {
+		pos := start + i*12
+
+		if pos+12 > len(t.data) {
+			break
+		}
+
+		typ := t.order.Uint16(t.data[pos+2:])
+		count := t.order.Uint32(t.data[pos+4:])
+		size := tiffTypeSize(typ) * int(count)
+
+		if size <= 0 {
+			continue
+		}
+
+		// Values up to 4 bytes are stored inline, larger ones at an offset.
+		value := t.data[pos+8 : pos+12]
+
+		if size > 4 {
+			valOffset := int(t.order.Uint32(t.data[pos+8:]))
+
+			if valOffset+size > len(t.data) {
+				continue
+			}
+
+			value = t.data[valOffset : valOffset+size]
+		}
+
+		entries[t.order.Uint16(t.data[pos:])] = tiffEntry{
+			typ:   typ,
+			count: count,
+			value: value,
+		}
+	}
+
+	return entries
+}
+
+func (t *tiffReader) uint(entry tiffEntry) (uint32, bool) {
+	switch entry.typ {
+	case 3:
+		return uint32(t.order.Uint16(entry.value)), true
+	case 4:
+		return t.order.Uint32(entry.value), true
+	}
+
+	return 0, false
+}
+
+func tiffTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+
+	return 0
+}
+
+// exifOrientation returns the EXIF orientation (1-8) of an encoded image.
+// It returns 1, the identity, when the orientation is missing or invalid.
+func exifOrientation(b []byte) int {
+	t, ok := exifTIFF(b)
+
+	if !ok {
+		return 1
+	}
+
+	entry, ok := t.readIFD(t.firstIFD())[exifTagOrientation]
+
+	if !ok {
+		return 1
+	}
+
+	o, ok := t.uint(entry)
+
+	if !ok || o < 1 || o > 8 {
+		return 1
+	}
+
+	return int(o)
+}
+
+// applyOrientation rotates / flips img so it displays upright according to
+// the given EXIF orientation.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+
+	// Orientations 5-8 swap the axes.
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,142 @@
+package gcsenhancer
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagExifIFD          = 0x8769
+	exifTagGPSIFD           = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	exifTagLensModel        = 0xA434
+
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+)
+
+// exifTimeLayout is the layout of EXIF date times, in the local time of the
+// camera.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// ExifData is the metadata of a photo read from its EXIF block. Fields
+// missing from the block are left zero.
+type ExifData struct {
+	Make  string
+	Model string
+	Lens  string
+
+	// Taken is the original date time of the photo. EXIF doesn't record the
+	// time zone, it is parsed as UTC.
+	Taken time.Time
+
+	// HasGPS tells whether Latitude and Longitude, in decimal degrees, are set.
+	HasGPS    bool
+	Latitude  float64
+	Longitude float64
+}
+
+// ParseExif reads the EXIF metadata of the encoded JPEG b. ok is false when b
+// carries no EXIF block.
+func ParseExif(b []byte) (*ExifData, bool) {
+	t, ok := exifTIFF(b)
+
+	if !ok {
+		return nil, false
+	}
+
+	ifd0 := t.readIFD(t.firstIFD())
+
+	data := &ExifData{
+		Make:  t.string(ifd0[exifTagMake]),
+		Model: t.string(ifd0[exifTagModel]),
+	}
+
+	if entry, ok := ifd0[exifTagExifIFD]; ok {
+		if offset, ok := t.uint(entry); ok {
+			sub := t.readIFD(offset)
+
+			data.Lens = t.string(sub[exifTagLensModel])
+
+			if taken, err := time.Parse(exifTimeLayout, t.string(sub[exifTagDateTimeOriginal])); err == nil {
+				data.Taken = taken
+			}
+		}
+	}
+
+	if entry, ok := ifd0[exifTagGPSIFD]; ok {
+		if offset, ok := t.uint(entry); ok {
+			gps := t.readIFD(offset)
+
+			lat, latOK := t.degrees(gps[gpsTagLatitude], t.string(gps[gpsTagLatitudeRef]) == "S")
+			lon, lonOK := t.degrees(gps[gpsTagLongitude], t.string(gps[gpsTagLongitudeRef]) == "W")
+
+			if latOK && lonOK {
+				data.HasGPS = true
+				data.Latitude = lat
+				data.Longitude = lon
+			}
+		}
+	}
+
+	return data, true
+}
+
+// string reads an ASCII entry, trimmed of its NUL terminator and padding.
+func (t *tiffReader) string(entry tiffEntry) string {
+	if entry.typ != 2 {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+// rational reads the i-th unsigned rational of entry.
+func (t *tiffReader) rational(entry tiffEntry, i int) (float64, bool) {
+	if entry.typ != 5 || len(entry.value) < (i+1)*8 {
+		return 0, false
+	}
+
+	num := t.order.Uint32(entry.value[i*8:])
+	den := t.order.Uint32(entry.value[i*8+4:])
+
+	if den == 0 {
+		return 0, false
+	}
+
+	return float64(num) / float64(den), true
+}
+
+// degrees reads a GPS coordinate stored as degrees, minutes and seconds.
+func (t *tiffReader) degrees(entry tiffEntry, negative bool) (float64, bool) {
+	d, ok1 := t.rational(entry, 0)
+	m, ok2 := t.rational(entry, 1)
+	s, ok3 := t.rational(entry, 2)
+
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+
+	deg := d + m/60 + s/3600
+
+	if negative {
+		deg = -deg
+	}
+
+	return deg, true
+}
+
+// WithExifExtraction makes UploadImagesWithResults parse the EXIF metadata
+// of each image from Images.OrigBytes into ImageResult.Exif, e.g. to index
+// photos by camera or location. Re-encoded originals don't carry the EXIF
+// block, the metadata is only kept in the stored object with
+// WithPreserveOriginal.
+func WithExifExtraction() Option {
+	return func(e *GCSEnhancer) {
+		e.extractExif = true
+	}
+}
@@ -0,0 +1,169 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// tiffField is an entry of an IFD, value being count items of type typ.
+type tiffField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func asciiField(tag uint16, s string) tiffField {
+	return tiffField{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func degreesField(tag uint16, d, m, s uint32) tiffField {
+	value := make([]byte, 24)
+
+	for i, v := range []uint32{d, 1, m, 1, s * 100, 100} {
+		binary.BigEndian.PutUint32(value[i*4:], v)
+	}
+
+	return tiffField{tag, 5, 3, value}
+}
+
+// sampleExifJPEG returns the head of a JPEG taken by a camera with a GPS,
+// its EXIF block holding IFD0, the Exif IFD and the GPS IFD in a row.
+func sampleExifJPEG() []byte {
+	exif := []tiffField{
+		asciiField(0x9003, "2022:05:01 09:30:15"),
+		asciiField(0xA434, "XF23mmF1.4 R"),
+	}
+
+	gps := []tiffField{
+		asciiField(0x0001, "N"),
+		degreesField(0x0002, 25, 2, 0),
+		asciiField(0x0003, "E"),
+		degreesField(0x0004, 121, 33, 36),
+	}
+
+	ifdSize := func(fields []tiffField) uint32 { return 2 + 12*uint32(len(fields)) + 4 }
+	pointer := func(tag uint16, offset uint32) tiffField {
+		value := make([]byte, 4)
+		binary.BigEndian.PutUint32(value, offset)
+
+		return tiffField{tag, 4, 1, value}
+	}
+
+	ifd0 := []tiffField{
+		asciiField(0x010F, "FUJIFILM"),
+		asciiField(0x0110, "X-T4"),
+		{}, {},
+	}
+
+	exifOffset := 8 + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exif)
+	ifd0[2] = pointer(0x8769, exifOffset)
+	ifd0[3] = pointer(0x8825, gpsOffset)
+
+	var tiff, data bytes.Buffer
+
+	dataOffset := gpsOffset + ifdSize(gps)
+
+	tiff.WriteString("MM\x00\x2a\x00\x00\x00\x08")
+
+	for _, fields := range [][]tiffField{ifd0, exif, gps} {
+		binary.Write(&tiff, binary.BigEndian, uint16(len(fields)))
+
+		for _, f := range fields {
+			binary.Write(&tiff, binary.BigEndian, f.tag)
+			binary.Write(&tiff, binary.BigEndian, f.typ)
+			binary.Write(&tiff, binary.BigEndian, f.count)
+
+			// Values of up to 4 bytes are stored inline, others in the data area.
+			if len(f.value) <= 4 {
+				tiff.Write(append(f.value, make([]byte, 4-len(f.value))...))
+
+				continue
+			}
+
+			binary.Write(&tiff, binary.BigEndian, dataOffset+uint32(data.Len()))
+			data.Write(f.value)
+		}
+
+		binary.Write(&tiff, binary.BigEndian, uint32(0))
+	}
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg = append(seg, data.Bytes()...)
+
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	b = append(b, byte((len(seg)+2)>>8), byte(len(seg)+2))
+	b = append(b, seg...)
+
+	return append(b, 0xFF, 0xD9)
+}
+
+func TestParseExif(t *testing.T) {
+	data, ok := gcsenhancer.ParseExif(sampleExifJPEG())
+
+	if !ok {
+		t.Fatal("no EXIF block found")
+	}
+
+	if data.Make != "FUJIFILM" || data.Model != "X-T4" || data.Lens != "XF23mmF1.4 R" {
+		t.Errorf("camera = %q %q %q, want FUJIFILM X-T4 XF23mmF1.4 R", data.Make, data.Model, data.Lens)
+	}
+
+	if want := time.Date(2022, 5, 1, 9, 30, 15, 0, time.UTC); !data.Taken.Equal(want) {
+		t.Errorf("taken = %v, want %v", data.Taken, want)
+	}
+
+	if !data.HasGPS || math.Abs(data.Latitude-25.0333) > 1e-3 || math.Abs(data.Longitude-121.56) > 1e-3 {
+		t.Errorf("GPS = %v %f %f, want 25.0333 121.56", data.HasGPS, data.Latitude, data.Longitude)
+	}
+
+	if _, ok := gcsenhancer.ParseExif([]byte("\x89PNG\r\n\x1a\n")); ok {
+		t.Error("EXIF found in a PNG")
+	}
+}
+
+func TestUploadImagesExifExtraction(t *testing.T) {
+	for _, extract := range []bool{true, false} {
+		opts := []gcsenhancer.Option{gcsenhancer.WithStableKeys()}
+
+		if extract {
+			opts = append(opts, gcsenhancer.WithExifExtraction())
+		}
+
+		e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", opts...)
+
+		results := e.UploadImagesWithResults(context.Background(), []gcsenhancer.Images{{
+			Name:      "photo.jpg",
+			Mime:      "image/jpeg",
+			OrigImage: image.NewRGBA(image.Rect(0, 0, 4, 4)),
+			OrigBytes: sampleExifJPEG(),
+		}})
+
+		if results[0].Err != nil {
+			t.Fatal(results[0].Err)
+		}
+
+		exif := results[0].Exif
+
+		if !extract {
+			if exif != nil {
+				t.Errorf("EXIF %+v returned without WithExifExtraction", exif)
+			}
+
+			continue
+		}
+
+		if exif == nil || exif.Model != "X-T4" || !exif.HasGPS {
+			t.Errorf("EXIF = %+v, want the sample's", exif)
+		}
+	}
+}
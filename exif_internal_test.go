@@ -0,0 +1,139 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// exifJPEG returns the head of a JPEG carrying an EXIF block with the given
+// IFD0 entries, tag to SHORT value.
+func exifJPEG(order binary.ByteOrder, entries map[uint16]uint16) []byte {
+	var tiff bytes.Buffer
+
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	binary.Write(&tiff, order, uint16(len(entries)))
+
+	for tag, value := range entries {
+		binary.Write(&tiff, order, tag)
+		binary.Write(&tiff, order, uint16(3))
+		binary.Write(&tiff, order, uint32(1))
+		binary.Write(&tiff, order, value)
+		binary.Write(&tiff, order, uint16(0))
+	}
+
+	binary.Write(&tiff, order, uint32(0))
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	b := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	b = append(b, byte((len(seg)+2)>>8), byte(len(seg)+2))
+	b = append(b, seg...)
+
+	return append(b, 0xFF, 0xD9)
+}
+
+func TestExifOrientation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    []byte
+		want int
+	}{
+		{"big endian", exifJPEG(binary.BigEndian, map[uint16]uint16{exifTagOrientation: 6}), 6},
+		{"little endian", exifJPEG(binary.LittleEndian, map[uint16]uint16{exifTagOrientation: 8}), 8},
+		{"missing", exifJPEG(binary.BigEndian, map[uint16]uint16{0x010F: 1}), 1},
+		{"out of range", exifJPEG(binary.BigEndian, map[uint16]uint16{exifTagOrientation: 9}), 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"truncated", exifJPEG(binary.BigEndian, map[uint16]uint16{exifTagOrientation: 3})[:12], 1},
+	} {
+		if got := exifOrientation(tc.b); got != tc.want {
+			t.Errorf("%s: orientation %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// grid builds an image from rows of pixel labels, each label a gray level.
+func grid(rows ...string) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+
+	for y, row := range rows {
+		for x, label := range row {
+			img.Set(x, y, color.Gray{Y: uint8(label)})
+		}
+	}
+
+	return img
+}
+
+func labels(img image.Image) []string {
+	b := img.Bounds()
+	rows := make([]string, 0, b.Dy())
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := make([]byte, 0, b.Dx())
+
+		for x := b.Min.X; x < b.Max.X; x++ {
+			row = append(row, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+
+		rows = append(rows, string(row))
+	}
+
+	return rows
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// Offset bounds, like those of a sub image, must not matter.
+	src := grid("xxxx", "xABC", "xDEF").(*image.NRGBA).SubImage(image.Rect(1, 1, 4, 3))
+
+	for orientation, want := range map[int][]string{
+		1: {"ABC", "DEF"},
+		2: {"CBA", "FED"},
+		3: {"FED", "CBA"},
+		4: {"DEF", "ABC"},
+		5: {"AD", "BE", "CF"},
+		6: {"DA", "EB", "FC"},
+		7: {"FC", "EB", "DA"},
+		8: {"CF", "BE", "AD"},
+	} {
+		got := labels(applyOrientation(src, orientation))
+
+		if len(got) != len(want) {
+			t.Errorf("orientation %d: %v, want %v", orientation, got, want)
+
+			continue
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("orientation %d: %v, want %v", orientation, got, want)
+
+				break
+			}
+		}
+	}
+}
+
+func TestAutoOrient(t *testing.T) {
+	e := NewWithStorage(nil, "bucket", WithAutoOrient())
+
+	img := e.prepareImage(Images{
+		Name:      "phone.jpg",
+		Mime:      "image/jpeg",
+		OrigImage: grid("ABC", "DEF"),
+		OrigBytes: exifJPEG(binary.BigEndian, map[uint16]uint16{exifTagOrientation: 6}),
+	})
+
+	if got := labels(img.OrigImage); got[0] != "DA" {
+		t.Errorf("original %v, want it rotated clockwise", got)
+	}
+}
@@ -0,0 +1,52 @@
+package gcsenhancer
+
+import (
+	"mime"
+	"strings"
+)
+
+// WithContentTypeFolders routes uploads into a folder by content type, e.g.
+//
+//	WithContentTypeFolders(map[string]string{
+//		"image/*":         "images/",
+//		"video/*":         "videos/",
+//		"application/pdf": "docs/",
+//	}, "files/")
+//
+// Keys are content types or, ending with "/*", whole top-level types. Exact
+// types take precedence over wildcards. Uploads matching no key, or of an
+// unknown content type, go to defaultFolder, which may be empty. The folder is
+// prefixed to the object name unless the name already starts with it.
+// Objects the enhancer addresses by name, like the targets of JSONLAppender
+// and PublishAtomic, are not routed.
+func WithContentTypeFolders(folders map[string]string, defaultFolder string) Option {
+	return func(e *GCSEnhancer) {
+		e.typeFolders = folders
+		e.defaultFolder = defaultFolder
+	}
+}
+
+// routeByContentType prefixes name with the folder of its content type.
+func (e *GCSEnhancer) routeByContentType(name, contentType string) string {
+	if e.typeFolders == nil {
+		return name
+	}
+
+	folder := e.defaultFolder
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if f, ok := e.typeFolders[mediaType]; ok {
+			folder = f
+		} else if i := strings.Index(mediaType, "/"); i > 0 {
+			if f, ok := e.typeFolders[mediaType[:i]+"/*"]; ok {
+				folder = f
+			}
+		}
+	}
+
+	if strings.HasPrefix(name, folder) {
+		return name
+	}
+
+	return folder + name
+}
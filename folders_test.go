@@ -0,0 +1,67 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func newFolderEnhancer(fake *gcstest.Storage) *gcsenhancer.GCSEnhancer {
+	return gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithContentTypeFolders(map[string]string{
+		"image/*":         "images/",
+		"application/pdf": "docs/",
+	}, "files/"))
+}
+
+func TestContentTypeFolders(t *testing.T) {
+	fake := gcstest.New()
+	e := newFolderEnhancer(fake)
+
+	for name, want := range map[string]string{
+		"cat.png":        "images/cat.png",
+		"report.pdf":     "docs/report.pdf",
+		"notes.txt":      "files/notes.txt",
+		"images/dog.jpg": "images/dog.jpg",
+	} {
+		info, err := e.Upload(context.Background(), strings.NewReader("x"), name, gcsenhancer.UploadOptions{
+			ContentTypeFromExt: true,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Filename != want {
+			t.Errorf("%s stored as %s, want %s", name, info.Filename, want)
+		}
+	}
+}
+
+func TestContentTypeFoldersSkipStagedObjects(t *testing.T) {
+	fake := gcstest.New()
+	e := newFolderEnhancer(fake)
+	ctx := context.Background()
+
+	a := e.NewJSONLAppender("logs/events.jsonl")
+
+	if err := a.Append(map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	if _, err := e.PublishAtomic(ctx, strings.NewReader("<html>"), "site/index.html"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	got := strings.Join(fake.Objects("bucket"), ",")
+
+	if want := "logs/events.jsonl,site/index.html"; got != want {
+		t.Errorf("objects = %s, want %s", got, want)
+	}
+}
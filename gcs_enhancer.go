@@ -3,89 +3,524 @@ package gcsenhancer
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"image/gif"
-	"image/jpeg"
-	"image/png"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
-	"path/filepath"
-	"strings"
+	"os"
+	"runtime"
 	"time"
 
 	"image"
+	"image/gif"
 
 	"cloud.google.com/go/storage"
+	"golang.org/x/image/draw"
 )
 
 const GCSPublicHost = "storage.googleapis.com"
 
+var ErrEmptyObject = errors.New("gcsenhancer: object is empty")
+
 type GCSEnhancerInterface interface {
 	Upload(ctx context.Context, file io.Reader, uploadFilename string) (string, error)
 }
 
+// GCSEnhancer is safe for concurrent use. Its configuration is only written by
+// NewGCSEnhancer, or NewWithStorage, and the options passed to it, then stays
+// read-only.
 type GCSEnhancer struct {
-	client     *storage.Client
+	client     Storage
 	bucketName string
+
+	encoders      map[string]EncodeFunc
+	outputFormats []string
+	autoOrient    bool
+	sniffMime     bool
+	extractExif   bool
+
+	preserveOriginal bool
+	maxPixels        int64
+
+	encodeWorkers int
+	encodeSem     chan struct{}
+	budget        *MemoryBudget
+
+	quality      QualityFunc
+	interpolator draw.Interpolator
+	thumbWidth   int
+	thumbHeight  int
+	thumbMode    ThumbnailMode
+
+	frameExtractor FrameExtractor
+
+	keySeparator  string
+	lowercaseKeys bool
+	stableKeys    bool
+	keyTemplate   *KeyTemplate
+
+	typeFolders   map[string]string
+	defaultFolder string
+
+	now             func() time.Time
+	sequentialKeys  bool
+	checkDuplicates bool
+	generateNames   bool
+
+	concurrency  int
+	retryPolicy  RetryPolicy
+	retryOptions []storage.RetryOption
+
+	cacheBusting bool
+	public       bool
+
+	stats *stats
+
+	onObjectComplete func(ObjectResult)
+	batchRollback    bool
+
+	requestID func(ctx context.Context) string
+
+	tempDir string
+
+	aclTimeout    time.Duration
+	lenientACL    bool
+	predefinedACL bool
+
+	allowedContentTypes []string
+
+	skipHidden      bool
+	excludePatterns []string
+
+	authorizedClient *http.Client
+	httpClient       *http.Client
+	maxRemoteSize    int64
+	remoteTimeout    time.Duration
+}
+
+// Option configures optional behaviour of GCSEnhancer.
+type Option func(*GCSEnhancer)
+
+// WithEncoder registers an image encoder for the given mime type, e.g. a WebP
+// encoder for "image/webp". It replaces the builtin encoder of the same mime.
+func WithEncoder(mime string, enc EncodeFunc) Option {
+	return func(e *GCSEnhancer) {
+		e.encoders[mime] = enc
+	}
+}
+
+// WithOutputFormats makes UploadImages encode every image into each of the
+// given mime types instead of the mime of the source image. Each format must
+// have an encoder, see WithEncoder.
+func WithOutputFormats(mimes ...string) Option {
+	return func(e *GCSEnhancer) {
+		e.outputFormats = mimes
+	}
 }
 
-func NewGCSEnhancer(client *storage.Client, bucketName string) *GCSEnhancer {
-	return &GCSEnhancer{
+// WithAutoOrient makes UploadImages read the EXIF orientation from
+// Images.OrigBytes and rotate / flip both original and thumbnail accordingly
+// before encoding them.
+func WithAutoOrient() Option {
+	return func(e *GCSEnhancer) {
+		e.autoOrient = true
+	}
+}
+
+func NewGCSEnhancer(client *storage.Client, bucketName string, opts ...Option) *GCSEnhancer {
+	return NewWithStorage(gcsStorage{client}, bucketName, opts...)
+}
+
+// NewWithStorage is NewGCSEnhancer over another implementation of Storage,
+// e.g. the fake of package gcstest in tests.
+func NewWithStorage(client Storage, bucketName string, opts ...Option) *GCSEnhancer {
+	e := &GCSEnhancer{
 		client:     client,
 		bucketName: bucketName,
+
+		quality:      defaultQuality,
+		interpolator: draw.CatmullRom,
+		thumbWidth:   DefaultThumbnailSize,
+		thumbHeight:  DefaultThumbnailSize,
+		maxPixels:    DefaultMaxPixels,
+
+		encodeWorkers: runtime.GOMAXPROCS(0),
+
+		keySeparator: defaultKeySeparator,
+		now:          time.Now,
+		concurrency:  DefaultConcurrency,
+		stats:        &stats{},
+		public:       true,
+		tempDir:      os.TempDir(),
+		aclTimeout:   DefaultACLTimeout,
+
+		httpClient:    http.DefaultClient,
+		maxRemoteSize: DefaultMaxRemoteSize,
+		remoteTimeout: DefaultRemoteTimeout,
+
+		retryPolicy: ExponentialBackoff{BaseDelay: retryBaseDelay},
 	}
+
+	e.encoders = e.defaultEncoders()
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	e.encodeSem = make(chan struct{}, e.encodeWorkers)
+
+	return e
 }
 
 type UploadedFileInfo struct {
 	Filename   string
 	PublicLink string
+
+	// ETag and the hex encoded MD5 of the object let clients validate their
+	// copy, e.g. with If-None-Match. MD5 is empty for composite objects.
+	ETag string
+	MD5  string
+
+	// RetentionExpiration is the time until which the object can't be
+	// deleted or replaced, under the retention policy of the bucket, see
+	// SetRetention, or of its own, see UploadOptions.RetainFor, whichever is
+	// later. Zero when the object isn't retained.
+	RetentionExpiration time.Time
 }
 
 func ObjectLink(attr *storage.ObjectAttrs) *UploadedFileInfo {
-	u := url.URL{
+	u := objectURL(attr)
+
+	return uploadedFileInfo(attr, u.String())
+}
+
+// ObjectLinkWithHost is ObjectLink served from host, e.g. a CDN in front of
+// the bucket, rather than GCSPublicHost. The host serves the bucket at its
+// root, the link is thus "https://<host>/<object>". An empty host is
+// GCSPublicHost.
+func ObjectLinkWithHost(attr *storage.ObjectAttrs, host string) *UploadedFileInfo {
+	u := hostURL(attr, host)
+
+	return uploadedFileInfo(attr, u.String())
+}
+
+func uploadedFileInfo(attr *storage.ObjectAttrs, link string) *UploadedFileInfo {
+	return &UploadedFileInfo{
+		Filename:   attr.Name,
+		PublicLink: link,
+		ETag:       attr.Etag,
+		MD5:        hex.EncodeToString(attr.MD5),
+
+		RetentionExpiration: retentionExpiration(attr),
+	}
+}
+
+func objectURL(attr *storage.ObjectAttrs) *url.URL {
+	return &url.URL{
 		Scheme: "https",
 		Host:   GCSPublicHost,
 		Path:   fmt.Sprintf("%s/%s", attr.Bucket, attr.Name),
 	}
+}
 
-	return &UploadedFileInfo{
-		Filename:   attr.Name,
-		PublicLink: u.String(),
+func hostURL(attr *storage.ObjectAttrs, host string) *url.URL {
+	if host == "" {
+		return objectURL(attr)
+	}
+
+	return &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   attr.Name,
 	}
 }
 
+// NewObjectWriter returns a writer of the object filename. It is nil unless
+// the enhancer was created by NewGCSEnhancer, use Upload otherwise.
 func (e *GCSEnhancer) NewObjectWriter(ctx context.Context, filename string) *storage.Writer {
-	bucket := e.client.Bucket(e.bucketName)
+	bucket := e.bucket(e.bucketName)
 	object := bucket.Object(filename)
 
-	return object.NewWriter(ctx)
+	w, ok := object.NewWriter(ctx).(gcsWriter)
+
+	if !ok {
+		return nil
+	}
+
+	return w.Writer
 }
 
 type UploadOptions struct {
+	// PublicAccess grants AllUsers read access to the object. It is ignored
+	// when the enhancer is configured as private, see WithPublic, and
+	// overridden by ContextWithPublicAccess.
 	PublicAccess bool
+	ContentType  string
+
+	// ContentTypeFromExt sets ContentType, when empty, from the extension of
+	// the object name, see ContentTypeByExtension.
+	ContentTypeFromExt bool
+
+	// Retries is the number of times a write failing with a transient error,
+	// e.g. a 503 or a network error, is retried. Readers that
+	// can not seek are buffered so the body can be replayed, see BufferThreshold.
+	Retries int
+
+	// BufferThreshold is the number of bytes kept in memory when buffering a
+	// non-seekable reader for retries. Larger inputs spill to a temp file.
+	// Defaults to DefaultBufferThreshold.
+	BufferThreshold int64
+
+	// TemporaryHold and EventBasedHold place the respective hold on the
+	// object, preventing it from being deleted or replaced until released.
+	TemporaryHold  bool
+	EventBasedHold bool
+
+	// RetainFor, when positive, retains the object for that long after the
+	// upload, under object retention: GCS rejects its deletion and
+	// replacement until then. RetentionLocked locks the retention, which can
+	// then be extended but never shortened or removed, e.g. for WORM
+	// compliance. Object retention has to be enabled on the bucket, which is
+	// only possible when creating it.
+	RetainFor       time.Duration
+	RetentionLocked bool
+
+	// RetainUntil, when set, retains the object until then, e.g. the hard
+	// expiry of a temporary share, like RetainFor does for a period. Setting
+	// both fails the upload with ErrConflictingRetention.
+	RetainUntil time.Time
+
+	// ChunkSize overrides the chunk size of the writer, see storage.Writer.
+	ChunkSize int
+
+	// RejectEmpty aborts the upload with ErrEmptyObject when the file is
+	// empty instead of creating a zero-byte object.
+	RejectEmpty bool
+
+	// PredefinedACL applies a predefined ACL, e.g. PredefinedACLPublicRead,
+	// atomically with the write. PublicAccess doesn't make an extra ACL call
+	// when it is set.
+	PredefinedACL string
+
+	// SendCRC32C sends CRC32C, the Castagnoli CRC32 of the content, along
+	// with the upload. GCS rejects the upload when the content doesn't match.
+	// ComputeCRC32C computes it from the file instead, which requires the
+	// file to be read twice, see BufferThreshold for non-seekable readers.
+	SendCRC32C    bool
+	CRC32C        uint32
+	ComputeCRC32C bool
+
+	// WaitForPublic, when positive, makes a public upload poll its link until
+	// it is readable, or fail once the duration elapses.
+	WaitForPublic time.Duration
+
+	// ContentLanguage is the BCP 47 language tag of the content, e.g.
+	// "zh-TW". Malformed tags are rejected with ErrInvalidContentLanguage.
+	ContentLanguage string
+
+	// ContentDisposition is served as the Content-Disposition header, e.g.
+	// `attachment; filename="export.zip"` to have browsers download the file.
+	ContentDisposition string
+
+	// Host overrides the host of the returned public link, see
+	// ObjectLinkWithHost. Signed links of private objects always target GCS.
+	Host string
+
+	// Gzip stores the content gzip compressed with a "gzip" Content-Encoding,
+	// GCS transparently decompresses it for clients not accepting gzip.
+	// Content types already compressed, like JPEG, PNG or zip, are stored
+	// as is. SendCRC32C is ignored for compressed content, as the checksum
+	// is computed on the uncompressed file.
+	Gzip bool
+
+	// GzipLevel is the compression level of Gzip, from gzip.BestSpeed to
+	// gzip.BestCompression, or gzip.HuffmanOnly. Zero, like
+	// gzip.DefaultCompression, is the default level.
+	GzipLevel int
+
+	// Metadata is stored as the custom metadata of the object.
+	Metadata map[string]string
+
+	// Conditions are the preconditions of the write, e.g. DoesNotExist to
+	// never overwrite an existing object.
+	Conditions *storage.Conditions
+
+	// WriterFunc, when set, is called with the writer right before the
+	// content is written, after every other option is applied, so any field
+	// of storage.Writer, e.g. CacheControl or KMSKeyName, can be set. Fields
+	// changed once the write has started are ignored by the storage client.
+	WriterFunc func(w *storage.Writer)
+
+	// SkipUnchanged skips the write when the object already holds the same
+	// content, compared by size and checksums, and returns the link of the
+	// existing object. Its generation, timestamps and cached copies are thus
+	// kept. The file is read twice, see BufferThreshold for non-seekable
+	// readers. The ACL and metadata of the existing object are left as is.
+	SkipUnchanged bool
+
+	// CustomTime is set as the custom time of the object, lifecycle rules
+	// can act on, e.g. the expiry of a document. The zero time leaves it
+	// unset. Once set, the custom time of an object can't be moved back.
+	CustomTime time.Time
+
+	// Collision decides what happens when an object already exists under the
+	// name, see CollisionStrategy. Strategies other than CollisionOverwrite
+	// check the name first, and write on the condition that it is still
+	// free, so an object created in between fails the upload.
+	Collision CollisionStrategy
 }
 
-func (e *GCSEnhancer) Upload(ctx context.Context, file io.Reader, uploadFilename string, opts UploadOptions) (*UploadedFileInfo, error) {
-	bucket := e.client.Bucket(e.bucketName)
-	object := bucket.Object(uploadFilename)
-	objwriter := object.NewWriter(ctx)
+func (e *GCSEnhancer) Upload(ctx context.Context, file io.Reader, uploadFilename string, opts UploadOptions, extra ...UploadOption) (*UploadedFileInfo, error) {
+	return e.upload(ctx, e.bucketName, file, uploadFilename, opts.apply(extra), true)
+}
+
+// UploadTo uploads the file to the given bucket rather than the configured
+// one. The bucket has to be accessible with the credentials of the client.
+func (e *GCSEnhancer) UploadTo(ctx context.Context, bucketName string, file io.Reader, uploadFilename string, opts UploadOptions, extra ...UploadOption) (*UploadedFileInfo, error) {
+	return e.upload(ctx, bucketName, file, uploadFilename, opts.apply(extra), true)
+}
+
+// stage uploads an internal object the enhancer addresses by name afterwards,
+// e.g. a chunk to compose, so it is stored under name as is, bypassing
+// WithContentTypeFolders.
+func (e *GCSEnhancer) stage(ctx context.Context, file io.Reader, name string, opts UploadOptions) (*UploadedFileInfo, error) {
+	return e.upload(ctx, e.bucketName, file, name, opts, false)
+}
+
+// upload uploads file under uploadFilename, routed by content type if route
+// is set.
+func (e *GCSEnhancer) upload(ctx context.Context, bucketName string, file io.Reader, uploadFilename string, opts UploadOptions, route bool) (info *UploadedFileInfo, err error) {
+	defer func() {
+		e.stats.record(err)
+	}()
 
-	if _, err := io.Copy(objwriter, file); err != nil {
+	if opts.ContentType == "" && opts.ContentTypeFromExt {
+		opts.ContentType = ContentTypeByExtension(uploadFilename)
+	}
+
+	uploadFilename, err = e.objectName(uploadFilename, opts.ContentType)
+
+	if err != nil {
 		return nil, err
 	}
 
-	if err := objwriter.Close(); err != nil {
+	if route {
+		uploadFilename = e.routeByContentType(uploadFilename, opts.ContentType)
+	}
+
+	bucket := e.bucket(bucketName)
+
+	// ------------------- resolve name collisions -------------------
+	if opts.Collision != CollisionOverwrite {
+		name, existing, err := e.resolveCollision(ctx, bucket, uploadFilename, opts.Collision)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			return e.objectLink(existing, opts.Host), nil
+		}
+
+		uploadFilename = name
+
+		// Lose a race for the name rather than overwrite the winner.
+		if opts.Conditions == nil {
+			opts.Conditions = &storage.Conditions{DoesNotExist: true}
+		}
+	}
+
+	object := bucket.Object(uploadFilename)
+
+	if opts.Gzip {
+		if err := validateGzipLevel(opts.GzipLevel); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.RetainFor > 0 && !opts.RetainUntil.IsZero() {
+		return nil, ErrConflictingRetention
+	}
+
+	if opts.ContentLanguage != "" {
+		if err := validateContentLanguage(opts.ContentLanguage); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(e.allowedContentTypes) > 0 {
+		if file, err = e.checkContentType(file, opts.ContentType); err != nil {
+			return nil, err
+		}
+	}
+
+	// ------------------- buffer the body so it can be replayed -------------------
+	if opts.Retries > 0 || opts.ComputeCRC32C || opts.SkipUnchanged {
+		body, cleanup, err := replayable(file, opts.BufferThreshold, e.tempDir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer cleanup()
+
+		file = body
+	}
+
+	// ------------------- skip the write of unchanged content -------------------
+	if opts.SkipUnchanged {
+		attr, same, err := unchanged(ctx, object, file.(io.ReadSeeker))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if same {
+			return e.objectLink(attr, opts.Host), nil
+		}
+	}
+
+	// ------------------- checksum the body for server-side validation -------------------
+	if opts.ComputeCRC32C {
+		crc, err := checksumCRC32C(file.(io.ReadSeeker))
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts.CRC32C = crc
+		opts.SendCRC32C = true
+	}
+
+	public := e.public && publicAccess(ctx, opts)
+
+	// Grant public access along with the write, saving the ACL call.
+	if public && e.predefinedACL && opts.PredefinedACL == "" {
+		opts.PredefinedACL = PredefinedACLPublicRead
+	}
+
+	// The conditions only guard the write, not the calls following it.
+	target := object
+
+	if opts.Conditions != nil {
+		target = object.If(*opts.Conditions)
+	}
+
+	n, err := e.writeWithRetry(ctx, target, file, opts)
+
+	if err != nil {
 		return nil, err
 	}
 
-	// ------------------- make the object publicly accessible -------------------
-	if opts.PublicAccess {
-		if err := object.ACL().Set(ctx,
-			storage.AllUsers,
-			storage.RoleReader); err != nil {
+	e.stats.addBytes(n)
 
+	// ------------------- make the object publicly accessible -------------------
+	if public && opts.PredefinedACL == "" {
+		if public, err = e.makePublic(ctx, object); err != nil {
 			return nil, err
 		}
 	}
@@ -98,27 +533,117 @@ func (e *GCSEnhancer) Upload(ctx context.Context, file io.Reader, uploadFilename
 	}
 
 	// ------------------- combine object link -------------------
-	return ObjectLink(attr), nil
+	info = e.objectLink(attr, opts.Host)
+
+	if public && opts.WaitForPublic > 0 {
+		if err := e.waitForPublic(ctx, info.PublicLink, opts.WaitForPublic); err != nil {
+			return nil, err
+		}
+	}
+
+	return info, nil
 }
 
-func AppendUnixTimeStampToFilename(filename string) string {
-	secs := strings.Split(filename, ".")
-	timeFactor := time.Now().Format("20060102150405")
+func (e *GCSEnhancer) writeObject(ctx context.Context, object ObjectHandle, r io.Reader, opts UploadOptions) (int64, error) {
+	// Cancelling the context is the only way to abort a started write.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := object.NewWriter(ctx)
+
+	objwriter := w.Settings()
+	objwriter.ContentType = opts.ContentType
+	objwriter.ContentLanguage = opts.ContentLanguage
+	objwriter.ContentDisposition = opts.ContentDisposition
+	objwriter.CustomTime = opts.CustomTime
+	objwriter.TemporaryHold = opts.TemporaryHold
+	objwriter.EventBasedHold = opts.EventBasedHold
+
+	if until := e.retainUntil(opts); !until.IsZero() {
+		objwriter.Retention = &storage.ObjectRetention{
+			Mode:        retentionMode(opts.RetentionLocked),
+			RetainUntil: until,
+		}
+	}
+	objwriter.PredefinedACL = opts.PredefinedACL
+	objwriter.CRC32C = opts.CRC32C
+	objwriter.SendCRC32C = opts.SendCRC32C
+
+	if opts.ChunkSize > 0 {
+		objwriter.ChunkSize = opts.ChunkSize
+	}
 
-	return fmt.Sprintf("%s_%s.%s", secs[0], timeFactor, secs[len(secs)-1])
+	// The source is counted, the written bytes being compressed when gzipping.
+	src := &countingReader{r: r}
+	r = src
+
+	if opts.Gzip && compressible(opts.ContentType) {
+		gz := gzipReader(src, opts.GzipLevel)
+		defer gz.Close()
+
+		r = gz
+		objwriter.ContentEncoding = "gzip"
+		objwriter.SendCRC32C = false
+	}
+
+	if len(opts.Metadata) > 0 {
+		objwriter.Metadata = make(map[string]string, len(opts.Metadata)+1)
+
+		for k, v := range opts.Metadata {
+			objwriter.Metadata[k] = v
+		}
+	}
+
+	if e.requestID != nil {
+		if id := e.requestID(ctx); id != "" {
+			if objwriter.Metadata == nil {
+				objwriter.Metadata = make(map[string]string, 1)
+			}
+
+			objwriter.Metadata[RequestIDMetadataKey] = id
+		}
+	}
+
+	if opts.WriterFunc != nil {
+		opts.WriterFunc(objwriter)
+	}
+
+	n, err := io.Copy(w, r)
+
+	if err != nil {
+		return n, err
+	}
+
+	// Returning before Close cancels the write, no object is created.
+	if src.n == 0 && opts.RejectEmpty {
+		return 0, ErrEmptyObject
+	}
+
+	return n, w.Close()
 }
 
-func appendThumbnailStamp(filename string) string {
-	secs := strings.Split(filename, ".")
+func AppendUnixTimeStampToFilename(filename string) string {
+	return appendStamp(filename, time.Now().Format(timestampLayout), defaultKeySeparator)
+}
 
-	return fmt.Sprintf("%s_thumbnail.%s", secs[0], secs[len(secs)-1])
+func appendThumbnailStamp(filename string) string {
+	return appendStamp(filename, "thumbnail", defaultKeySeparator)
 }
 
 type Images struct {
 	Name      string
 	Mime      string
 	OrigImage image.Image
+
+	// Thumbnail is generated from OrigImage when nil, see WithThumbnailSize.
 	Thumbnail image.Image
+
+	// OrigBytes is the encoded source the images are decoded from. It is
+	// optional and used to read metadata like the EXIF orientation or the
+	// actual mime type, or stored as is, see WithPreserveOriginal. The frames
+	// of animated GIFs are read from it so the GIF original and thumbnail
+	// stay animated.
+	OrigBytes []byte
 }
 
 // UploadImages uploads original and thumbnail of the image.
@@ -129,103 +654,145 @@ func (e *GCSEnhancer) UploadImages(ctx context.Context, imgs []Images) (SortedLi
 		sl  SortedLinks
 	)
 
-	for _, img := range imgs {
-		// Upload both orginal / thumbnail images.
-		origName := AppendUnixTimeStampToFilename(filepath.Base(img.Name))
-		thumbnailName := AppendUnixTimeStampToFilename(appendThumbnailStamp(filepath.Base(img.Name)))
+	objsPerImage, errs := e.prepareImages(ctx, imgs)
 
-		origBuf := new(bytes.Buffer)
-		thumbBuf := new(bytes.Buffer)
+	if err := ctx.Err(); err != nil {
+		return sl, err
+	}
 
-		var (
-			origObj  *ObjectInfo
-			thumbObj *ObjectInfo
-		)
+	for i, objs := range objsPerImage {
+		if errs[i] != nil {
+			return sl, errs[i]
+		}
 
-		switch img.Mime {
-		case "image/png":
-			enc := png.Encoder{
-				CompressionLevel: png.BestCompression,
-			}
+		ois = append(ois, objs...)
+	}
 
-			if err = enc.Encode(origBuf, img.OrigImage); err != nil {
-				return sl, err
-			}
+	if e.checkDuplicates {
+		if err := duplicateNames(imgs, objsPerImage); err != nil {
+			return sl, err
+		}
+	}
 
-			origObj = &ObjectInfo{
-				Size:   Original,
-				Name:   origName,
-				Reader: origBuf,
-			}
+	sl, err = e.uploadMultiple(ctx, ois...)
 
-			if err = enc.Encode(thumbBuf, img.Thumbnail); err != nil {
-				return sl, err
-			}
+	if err != nil {
+		return sl, err
+	}
 
-			thumbObj = &ObjectInfo{
-				Size:   Thumbnail,
-				Name:   thumbnailName,
-				Reader: thumbBuf,
-			}
-		case "image/jpeg":
-			if err := jpeg.Encode(origBuf, img.OrigImage, &jpeg.Options{
-				Quality: jpeg.DefaultQuality,
-			}); err != nil {
-				return sl, err
-			}
+	return sl, err
+}
 
-			origObj = &ObjectInfo{
-				Size:   Original,
-				Name:   origName,
-				Reader: origBuf,
-			}
+// imageObjects prepares the uploads of both the original and the thumbnail,
+// for each output format, of the i-th image of a batch.
+func (e *GCSEnhancer) imageObjects(i int, img Images) ([]*ObjectInfo, error) {
+	// Upload both orginal / thumbnail images.
+	origName, thumbnailName, err := e.imageKeys(img.Name, i+1)
 
-			if err := jpeg.Encode(thumbBuf, img.Thumbnail, &jpeg.Options{
-				Quality: 40,
-			}); err != nil {
-				return sl, err
-			}
+	if err != nil {
+		return nil, err
+	}
 
-			thumbObj = &ObjectInfo{
-				Size:   Thumbnail,
-				Name:   thumbnailName,
-				Reader: thumbBuf,
-			}
+	img = e.prepareImage(img)
+
+	// Animated GIFs keep their animation, in the thumbnail too unless given.
+	var animation, animatedThumb *gif.GIF
+
+	if img.Mime == "image/gif" && len(img.OrigBytes) > 0 {
+		if g, ok := e.decodeAnimatedGIF(img.OrigBytes); ok {
+			animation = g
 
-		case "image/gif":
-			if err := gif.Encode(origBuf, img.OrigImage, &gif.Options{}); err != nil {
-				return sl, err
+			if img.Thumbnail == nil {
+				animatedThumb = e.animatedThumbnail(g)
 			}
+		}
+	}
+
+	if img.Thumbnail == nil {
+		img.Thumbnail = e.thumbnail(img.OrigImage)
+	}
+
+	formats := e.outputFormats
+
+	if len(formats) == 0 {
+		formats = []string{img.Mime}
+	}
+
+	ois := make([]*ObjectInfo, 0, len(formats)*2)
+
+	for _, format := range formats {
+		origKey, thumbKey := origName, thumbnailName
+
+		// Each format needs its own key when a source is encoded to multiple formats.
+		if len(e.outputFormats) > 0 {
+			origKey = replaceExt(origName, formatExt(format))
+			thumbKey = replaceExt(thumbnailName, formatExt(format))
+		}
 
+		var origObj *ObjectInfo
+
+		if e.preserveOriginal && format == img.Mime && len(img.OrigBytes) > 0 {
 			origObj = &ObjectInfo{
 				Size:   Original,
-				Name:   origName,
-				Reader: origBuf,
+				Name:   origKey,
+				Format: format,
+				Reader: bytes.NewReader(img.OrigBytes),
 			}
+		} else if animation != nil && format == "image/gif" {
+			origObj = animationObject(animation, Original, origKey)
+			origObj.wrapEncodeErr(i, img.Name)
+		} else {
+			var err error
+
+			origObj, err = e.imageObject(img.OrigImage, format, Original, origKey)
 
-			if err := gif.Encode(thumbBuf, img.Thumbnail, &gif.Options{}); err != nil {
-				return sl, err
+			if err != nil {
+				return nil, fmt.Errorf("encoding image %d (%s): %w", i, img.Name, err)
 			}
 
-			origObj = &ObjectInfo{
-				Size:   Thumbnail,
-				Name:   origName,
-				Reader: origBuf,
+			origObj.wrapEncodeErr(i, img.Name)
+		}
+
+		var thumbObj *ObjectInfo
+
+		if animatedThumb != nil && format == "image/gif" {
+			thumbObj = animationObject(animatedThumb, Thumbnail, thumbKey)
+		} else {
+			var err error
+
+			thumbObj, err = e.imageObject(img.Thumbnail, format, Thumbnail, thumbKey)
+
+			if err != nil {
+				return nil, fmt.Errorf("encoding image %d (%s): %w", i, img.Name, err)
 			}
 		}
 
+		thumbObj.wrapEncodeErr(i, img.Name)
+
 		ois = append(ois, origObj)
 		ois = append(ois, thumbObj)
-
 	}
 
-	sl, err = e.uploadMultiple(ctx, ois...)
+	return ois, nil
+}
 
-	if err != nil {
-		return sl, err
+// prepareImage applies the enhancer options, like orientation correction and
+// mime sniffing, that precede the encoding of img.
+func (e *GCSEnhancer) prepareImage(img Images) Images {
+	if e.autoOrient && len(img.OrigBytes) > 0 {
+		orientation := exifOrientation(img.OrigBytes)
+		img.OrigImage = applyOrientation(img.OrigImage, orientation)
+
+		if img.Thumbnail != nil {
+			img.Thumbnail = applyOrientation(img.Thumbnail, orientation)
+		}
 	}
 
-	return sl, err
+	if e.sniffMime && len(img.OrigBytes) > 0 {
+		img.Mime = sniffImageMime(img.OrigBytes, img.Mime)
+	}
+
+	return img
 }
 
 type ImageSize string
@@ -238,76 +805,160 @@ const (
 type ObjectInfo struct {
 	Size   ImageSize
 	Name   string
+	Format string
 	Reader io.Reader
+
+	// encode, when set, produces the content instead of Reader.
+	encode func(w io.Writer) error
+
+	// pixels is the number of pixels of the encoded image.
+	pixels int64
+}
+
+func (obj *ObjectInfo) wrapEncodeErr(i int, name string) {
+	encode := obj.encode
+
+	obj.encode = func(w io.Writer) error {
+		if err := encode(w); err != nil {
+			return &encodeError{index: i, name: name, err: err}
+		}
+
+		return nil
+	}
+}
+
+// FormatLinks holds the links of a single output format.
+type FormatLinks struct {
+	Thumbnails []string `json:"thumbnails"`
+	Original   []string `json:"originals"`
 }
 
 type SortedLinks struct {
 	Thumbnails []string `json:"thumbnails"`
 	Original   []string `json:"originals"`
+
+	// Formats groups the links by mime type when WithOutputFormats is used.
+	Formats map[string]*FormatLinks `json:"formats,omitempty"`
 }
 
-func (e *GCSEnhancer) uploadMultiple(ctx context.Context, objs ...*ObjectInfo) (SortedLinks, error) {
-	quit := make(chan struct{}, 1)
-	errChan := make(chan error, 1)
+func (sl *SortedLinks) add(size ImageSize, link string) {
+	if size == Original {
+		sl.Original = append(sl.Original, link)
+	}
 
-	type LinkInfo struct {
-		Size ImageSize
-		Link string
+	if size == Thumbnail {
+		sl.Thumbnails = append(sl.Thumbnails, link)
 	}
+}
 
-	linkChan := make(chan LinkInfo, 1)
-	sl := SortedLinks{}
+func (sl *SortedLinks) addFormat(format string, size ImageSize, link string) {
+	if sl.Formats == nil {
+		sl.Formats = make(map[string]*FormatLinks)
+	}
+
+	fl, ok := sl.Formats[format]
+
+	if !ok {
+		fl = &FormatLinks{}
+		sl.Formats[format] = fl
+	}
 
-L:
-	for _, obj := range objs {
-		select {
-		case <-quit:
-			break L
-		default:
-			go func(obj *ObjectInfo) {
-				// Test: write to physical file for testing purpose.
-				objectLink, err := e.Upload(
-					ctx,
-					obj.Reader,
-					obj.Name,
-					UploadOptions{},
-				)
-
-				if err != nil {
-					errChan <- err
-					close(quit)
-
-					return
-				}
-
-				errChan <- nil
-				linkChan <- LinkInfo{
-					Size: obj.Size,
-					Link: objectLink.PublicLink,
-				}
-
-			}(obj)
+	if size == Original {
+		fl.Original = append(fl.Original, link)
+	}
+
+	if size == Thumbnail {
+		fl.Thumbnails = append(fl.Thumbnails, link)
+	}
+}
+
+// uploadObject uploads obj and returns its link along with the number of
+// bytes uploaded.
+func (e *GCSEnhancer) uploadObject(ctx context.Context, obj *ObjectInfo) (*UploadedFileInfo, int64, error) {
+	return e.uploadEncoded(ctx, obj, UploadOptions{ContentType: obj.Format}, true)
+}
+
+// uploadEncoded uploads the encoded obj with opts, routed by content type if
+// route is set, and returns the number of bytes written.
+func (e *GCSEnhancer) uploadEncoded(ctx context.Context, obj *ObjectInfo, opts UploadOptions, route bool) (*UploadedFileInfo, int64, error) {
+	if e.budget != nil {
+		reserved, err := e.budget.acquire(ctx, obj.memoryEstimate())
+
+		if err != nil {
+			return nil, 0, err
 		}
+
+		defer e.budget.release(reserved)
 	}
 
-	for range objs {
-		if err := <-errChan; err != nil {
-			close(quit)
+	r, done := obj.reader(e.encodeSem)
+	defer done()
 
-			return sl, err
+	counted := &countingReader{r: r}
+
+	info, err := e.upload(ctx, e.bucketName, counted, obj.Name, opts, route)
+
+	return info, counted.n, err
+}
+
+func (e *GCSEnhancer) uploadMultiple(ctx context.Context, objs ...*ObjectInfo) (SortedLinks, error) {
+	sl := SortedLinks{}
+	links := make([]string, len(objs))
+
+	// names are the keys the objects were stored under, which routing may
+	// have changed, for the rollback.
+	names := make([]string, len(objs))
+
+	events, wait := e.objectEvents()
+
+	err := e.runBounded(ctx, len(objs), func(ctx context.Context, i int) error {
+		objectLink, n, err := e.uploadObject(ctx, objs[i])
+
+		if events != nil {
+			ev := ObjectResult{Name: objs[i].Name, Bytes: n, Err: err}
+
+			if objectLink != nil {
+				ev.Link = objectLink.PublicLink
+			}
+
+			events <- ev
 		}
 
-		li := <-linkChan
+		if err != nil {
+			return err
+		}
+
+		links[i] = objectLink.PublicLink
+		names[i] = objectLink.Filename
+
+		return nil
+	})
+
+	wait()
 
-		if li.Size == Original {
-			sl.Original = append(sl.Original, li.Link)
+	if err != nil && e.batchRollback {
+		e.rollback(names)
+
+		return sl, err
+	}
+
+	// The links of the objects completed before a failure are returned too.
+	for i, obj := range objs {
+		if links[i] == "" {
+			continue
 		}
 
-		if li.Size == Thumbnail {
-			sl.Thumbnails = append(sl.Thumbnails, li.Link)
+		sl.add(obj.Size, links[i])
+
+		if len(e.outputFormats) > 0 {
+			sl.addFormat(obj.Format, obj.Size, links[i])
 		}
 	}
 
+	if err != nil {
+		return sl, err
+	}
+
 	b, err := json.Marshal(sl)
 
 	if err != nil {
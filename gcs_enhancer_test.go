@@ -0,0 +1,281 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// encodeWebP stands in for a WebP encoder, writing a marker.
+func encodeWebP(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+	_, err := io.WriteString(w, "RIFF webp "+string(size))
+
+	return err
+}
+
+func TestUploadImagesOutputFormats(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket",
+		gcsenhancer.WithClock(fixedClock),
+		gcsenhancer.WithEncoder("image/webp", encodeWebP),
+		gcsenhancer.WithOutputFormats("image/webp", "image/jpeg"),
+	)
+
+	sl, err := e.UploadImages(context.Background(), pngImages("cat.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := fake.Objects("bucket")
+
+	if len(names) != 4 {
+		t.Fatalf("objects = %v, want an original and a thumbnail per format", names)
+	}
+
+	exts := map[string]string{".webp": "image/webp", ".jpg": "image/jpeg"}
+
+	for _, name := range names {
+		obj, _ := fake.Object("bucket", name)
+		ext := name[strings.LastIndex(name, "."):]
+
+		if want := exts[ext]; obj.Attrs.ContentType != want {
+			t.Errorf("%s has content type %q, want %q", name, obj.Attrs.ContentType, want)
+		}
+	}
+
+	for _, format := range []string{"image/webp", "image/jpeg"} {
+		fl := sl.Formats[format]
+
+		if fl == nil || len(fl.Original) != 1 || len(fl.Thumbnails) != 1 {
+			t.Errorf("links of %s = %+v, want an original and a thumbnail", format, fl)
+		}
+	}
+
+	if sl.Formats["image/webp"].Original[0] == sl.Formats["image/jpeg"].Original[0] {
+		t.Error("formats share the same link")
+	}
+}
+
+func TestUploadRejectEmpty(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	opts := gcsenhancer.UploadOptions{RejectEmpty: true}
+
+	if _, err := e.Upload(context.Background(), strings.NewReader(""), "empty.txt", opts); !errors.Is(err, gcsenhancer.ErrEmptyObject) {
+		t.Errorf("empty upload err = %v, want ErrEmptyObject", err)
+	}
+
+	if _, ok := fake.Object("bucket", "empty.txt"); ok {
+		t.Error("empty object stored")
+	}
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "one.txt", opts); err != nil {
+		t.Fatalf("one byte upload: %v", err)
+	}
+
+	if obj, _ := fake.Object("bucket", "one.txt"); string(obj.Content) != "x" {
+		t.Errorf("content = %q, want x", obj.Content)
+	}
+}
+
+func TestUploadWriterFunc(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		ContentType: "application/octet-stream",
+		Metadata:    map[string]string{"owner": "42"},
+		WriterFunc: func(w *storage.Writer) {
+			w.ContentType = "text/plain"
+			w.CacheControl = "no-cache"
+			w.Metadata["tenant"] = "acme"
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+
+	if obj.Attrs.ContentType != "text/plain" || obj.Attrs.CacheControl != "no-cache" {
+		t.Errorf("content type = %q, cache control = %q, want the callback's", obj.Attrs.ContentType, obj.Attrs.CacheControl)
+	}
+
+	if obj.Attrs.Metadata["owner"] != "42" || obj.Attrs.Metadata["tenant"] != "acme" {
+		t.Errorf("metadata = %v, want owner=42 and tenant=acme", obj.Attrs.Metadata)
+	}
+}
+
+func TestUploadImagesConcurrencyCap(t *testing.T) {
+	const limit = 2
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(limit))
+
+	var (
+		mu            sync.Mutex
+		inFlight, max int
+	)
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpWrite {
+			return nil
+		}
+
+		mu.Lock()
+		inFlight++
+
+		if inFlight > max {
+			max = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return nil
+	})
+
+	names := make([]string, 8)
+
+	for i := range names {
+		names[i] = fmt.Sprintf("%d.png", i)
+	}
+
+	if _, err := e.UploadImages(context.Background(), pngImages(names...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(fake.Objects("bucket")); n != 2*len(names) {
+		t.Errorf("%d objects stored, want %d", n, 2*len(names))
+	}
+
+	if max > limit {
+		t.Errorf("%d uploads in flight, want at most %d", max, limit)
+	}
+}
+
+// discardWrites is a storage dropping the content written to it, so that
+// benchmarks measure the memory of the enhancer rather than the one of the
+// fake holding the objects.
+type discardWrites struct {
+	gcsenhancer.Storage
+}
+
+func (s discardWrites) Bucket(name string) gcsenhancer.BucketHandle {
+	return discardBucket{s.Storage.Bucket(name)}
+}
+
+type discardBucket struct {
+	gcsenhancer.BucketHandle
+}
+
+func (b discardBucket) Object(name string) gcsenhancer.ObjectHandle {
+	return discardObject{b.BucketHandle.Object(name)}
+}
+
+type discardObject struct {
+	gcsenhancer.ObjectHandle
+}
+
+func (o discardObject) NewWriter(ctx context.Context) gcsenhancer.ObjectWriter {
+	return discardWriter{o.ObjectHandle.NewWriter(ctx)}
+}
+
+// discardWriter stores an empty object, whatever is written.
+type discardWriter struct {
+	gcsenhancer.ObjectWriter
+}
+
+func (discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// peakHeap samples the heap in use until stop is closed, returning the
+// largest sample.
+func peakHeap(stop <-chan struct{}) <-chan uint64 {
+	peak := make(chan uint64, 1)
+
+	go func() {
+		var max uint64
+		var m runtime.MemStats
+
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			runtime.ReadMemStats(&m)
+
+			if m.HeapInuse > max {
+				max = m.HeapInuse
+			}
+
+			select {
+			case <-stop:
+				peak <- max
+
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return peak
+}
+
+// BenchmarkUploadImages reports the peak heap of uploading a batch of large
+// images, which stays flat as encoding is streamed rather than buffered: only
+// the images in flight are encoded at once.
+func BenchmarkUploadImages(b *testing.B) {
+	imgs := make([]gcsenhancer.Images, 16)
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := range imgs {
+		// Noise doesn't compress, the PNGs are as large as the images.
+		img := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+		rnd.Read(img.Pix)
+
+		imgs[i] = gcsenhancer.Images{
+			Name:      fmt.Sprintf("%d.png", i),
+			Mime:      "image/png",
+			OrigImage: img,
+		}
+	}
+
+	b.ReportAllocs()
+
+	runtime.GC()
+
+	stop := make(chan struct{})
+	peak := peakHeap(stop)
+
+	for i := 0; i < b.N; i++ {
+		e := gcsenhancer.NewWithStorage(discardWrites{gcstest.New()}, "bucket", gcsenhancer.WithConcurrency(4))
+
+		if _, err := e.UploadImages(context.Background(), imgs); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	close(stop)
+
+	b.ReportMetric(float64(<-peak)/(1<<20), "peak-MiB")
+}
@@ -0,0 +1,118 @@
+package gcsenhancer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the file, in the root of the directory given to
+// UploadDir, listing patterns of the paths to exclude, one per line.
+const IgnoreFile = ".gcsignore"
+
+var ErrInvalidExcludePattern = errors.New("gcsenhancer: invalid exclude pattern")
+
+// WithExcludePatterns makes UploadDir skip the paths matching any of the
+// patterns, on top of those listed in IgnoreFile. A pattern without a slash,
+// e.g. "node_modules" or "*.tmp", matches the name of a file or directory at
+// any depth. Other patterns, e.g. "build/*.map", match the path relative to
+// the root, see path.Match. A trailing slash only matches directories.
+// Excluded directories are not descended into.
+func WithExcludePatterns(patterns ...string) Option {
+	return func(e *GCSEnhancer) {
+		e.excludePatterns = append(e.excludePatterns, patterns...)
+	}
+}
+
+type excludePattern struct {
+	pattern string
+	dirOnly bool
+	anchor  bool
+}
+
+type excludeRules []excludePattern
+
+// parseExcludePatterns parses the patterns in the syntax of
+// WithExcludePatterns. Blank lines and lines starting with "#" are ignored.
+func parseExcludePatterns(lines []string) (excludeRules, error) {
+	var rules excludeRules
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := excludePattern{pattern: line}
+
+		if strings.HasSuffix(p.pattern, "/") {
+			p.dirOnly = true
+			p.pattern = strings.TrimRight(p.pattern, "/")
+		}
+
+		if strings.Contains(p.pattern, "/") {
+			p.anchor = true
+			p.pattern = strings.TrimPrefix(p.pattern, "/")
+		}
+
+		if _, err := path.Match(p.pattern, ""); err != nil || p.pattern == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidExcludePattern, line)
+		}
+
+		rules = append(rules, p)
+	}
+
+	return rules, nil
+}
+
+// readIgnoreFile returns the lines of the IgnoreFile of dir, if any.
+func readIgnoreFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var lines []string
+
+	sc := bufio.NewScanner(f)
+
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+
+	return lines, sc.Err()
+}
+
+// excluded tells whether the path rel, relative to the root and slash
+// separated, matches any of the rules.
+func (rules excludeRules) excluded(rel string, isDir bool) bool {
+	for _, p := range rules {
+		if p.dirOnly && !isDir {
+			continue
+		}
+
+		name := path.Base(rel)
+
+		if p.anchor {
+			name = rel
+		}
+
+		if ok, _ := path.Match(p.pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package gcsenhancer
+
+import "testing"
+
+func TestExcludeRules(t *testing.T) {
+	rules, err := parseExcludePatterns([]string{"# comment", "", "node_modules", "*.tmp", "/dist", "build/*.map", "cache/"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"a.tmp", false, true},
+		{"deep/dir/b.tmp", false, true},
+		{"a.tmpl", false, false},
+		{"dist", true, true},
+		{"web/dist", true, false},
+		{"build/app.js.map", false, true},
+		{"build/nested/app.js.map", false, false},
+		{"cache", true, true},
+		{"cache", false, false},
+		{"comment", false, false},
+	} {
+		if got := rules.excluded(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("excluded(%q, dir %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package gcstest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// GoogleAccessID is the service account the fake signs URLs and policies as.
+const GoogleAccessID = "gcstest@gcstest.iam.gserviceaccount.com"
+
+type bucketHandle struct {
+	s     *Storage
+	name  string
+	conds *storage.BucketConditions
+}
+
+func (b *bucketHandle) Object(name string) gcsenhancer.ObjectHandle {
+	return &objectHandle{s: b.s, bucket: b.name, name: name}
+}
+
+func (b *bucketHandle) Retryer(opts ...storage.RetryOption) gcsenhancer.BucketHandle {
+	return b
+}
+
+func (b *bucketHandle) If(conds storage.BucketConditions) gcsenhancer.BucketHandle {
+	return &bucketHandle{s: b.s, name: b.name, conds: &conds}
+}
+
+func (b *bucketHandle) checkConditions(attrs storage.BucketAttrs) error {
+	if b.conds == nil {
+		return nil
+	}
+
+	if m := b.conds.MetagenerationMatch; m != 0 && attrs.MetaGeneration != m {
+		return preconditionError()
+	}
+
+	if m := b.conds.MetagenerationNotMatch; m != 0 && attrs.MetaGeneration == m {
+		return preconditionError()
+	}
+
+	return nil
+}
+
+func (b *bucketHandle) Attrs(ctx context.Context) (*storage.BucketAttrs, error) {
+	if err := b.s.begin(Call{Op: OpBucketAttrs, Bucket: b.name}); err != nil {
+		return nil, err
+	}
+
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	attrs := b.s.bucket(b.name).attrs
+
+	if err := b.checkConditions(attrs); err != nil {
+		return nil, err
+	}
+
+	return &attrs, nil
+}
+
+func (b *bucketHandle) Update(ctx context.Context, uattrs storage.BucketAttrsToUpdate) (*storage.BucketAttrs, error) {
+	if err := b.s.begin(Call{Op: OpBucketUpdate, Bucket: b.name}); err != nil {
+		return nil, err
+	}
+
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	bkt := b.s.bucket(b.name)
+
+	if err := b.checkConditions(bkt.attrs); err != nil {
+		return nil, err
+	}
+
+	attrs := bkt.attrs
+
+	if uattrs.CORS != nil {
+		attrs.CORS = append([]storage.CORS(nil), uattrs.CORS...)
+	}
+
+	if uattrs.UniformBucketLevelAccess != nil {
+		attrs.UniformBucketLevelAccess = *uattrs.UniformBucketLevelAccess
+	}
+
+	if p := uattrs.RetentionPolicy; p != nil {
+		current := attrs.RetentionPolicy
+
+		if current != nil && current.IsLocked && p.RetentionPeriod < current.RetentionPeriod {
+			return nil, &googleapi.Error{Code: http.StatusForbidden, Message: "retention policy is locked"}
+		}
+
+		if p.RetentionPeriod == 0 {
+			attrs.RetentionPolicy = nil
+		} else {
+			attrs.RetentionPolicy = &storage.RetentionPolicy{
+				RetentionPeriod: p.RetentionPeriod,
+				IsLocked:        current != nil && current.IsLocked,
+			}
+		}
+	}
+
+	attrs.MetaGeneration++
+	bkt.attrs = attrs
+
+	return &attrs, nil
+}
+
+func (b *bucketHandle) LockRetentionPolicy(ctx context.Context) error {
+	if err := b.s.begin(Call{Op: OpLockRetention, Bucket: b.name}); err != nil {
+		return err
+	}
+
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	bkt := b.s.bucket(b.name)
+
+	if err := b.checkConditions(bkt.attrs); err != nil {
+		return err
+	}
+
+	if bkt.attrs.RetentionPolicy == nil {
+		return &googleapi.Error{Code: http.StatusBadRequest, Message: "bucket has no retention policy"}
+	}
+
+	policy := *bkt.attrs.RetentionPolicy
+	policy.IsLocked = true
+
+	bkt.attrs.RetentionPolicy = &policy
+	bkt.attrs.MetaGeneration++
+
+	return nil
+}
+
+func (b *bucketHandle) IAMPolicy(ctx context.Context) (*iam.Policy, error) {
+	if err := b.s.begin(Call{Op: OpIAMPolicy, Bucket: b.name}); err != nil {
+		return nil, err
+	}
+
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	if p := b.s.bucket(b.name).policy; p != nil {
+		return p, nil
+	}
+
+	return &iam.Policy{}, nil
+}
+
+// SignedURL returns a URL looking like a V4 signed URL, carrying the method,
+// expiry and query parameters of opts. The signature is not verifiable.
+func (b *bucketHandle) SignedURL(object string, opts *storage.SignedURLOptions) (string, error) {
+	if err := b.s.begin(Call{Op: OpSignURL, Bucket: b.name, Object: object}); err != nil {
+		return "", err
+	}
+
+	if opts == nil || opts.Expires.IsZero() {
+		return "", errors.New("storage: missing required expires option")
+	}
+
+	query := url.Values{}
+
+	for k, v := range opts.QueryParameters {
+		query[k] = append([]string(nil), v...)
+	}
+
+	method := opts.Method
+
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	query.Set("X-Goog-Algorithm", "GOOG4-RSA-SHA256")
+	query.Set("X-Goog-Credential", GoogleAccessID)
+	query.Set("X-Goog-Expires", strconv.FormatInt(opts.Expires.Unix(), 10))
+	query.Set("X-Goog-Method", method)
+	query.Set("X-Goog-Signature", "gcstest")
+
+	if opts.ContentType != "" {
+		query.Set("X-Goog-Content-Type", opts.ContentType)
+	}
+
+	u := url.URL{
+		Scheme:   "https",
+		Host:     "storage.googleapis.com",
+		Path:     "/" + b.name + "/" + object,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String(), nil
+}
+
+// GenerateSignedPostPolicyV4 signs the policy with a key of the fake, as
+// GoogleAccessID unless opts sets another signer.
+func (b *bucketHandle) GenerateSignedPostPolicyV4(object string, opts *storage.PostPolicyV4Options) (*storage.PostPolicyV4, error) {
+	if err := b.s.begin(Call{Op: OpSignPostPolicy, Bucket: b.name, Object: object}); err != nil {
+		return nil, err
+	}
+
+	signed := *opts
+
+	if signed.GoogleAccessID == "" {
+		signed.GoogleAccessID = GoogleAccessID
+	}
+
+	if signed.SignBytes == nil && signed.SignRawBytes == nil && len(signed.PrivateKey) == 0 {
+		key, err := b.s.signingKey()
+
+		if err != nil {
+			return nil, err
+		}
+
+		signed.PrivateKey = key
+	}
+
+	return storage.GenerateSignedPostPolicyV4(b.name, object, &signed)
+}
+
+// signingKey returns the PEM encoded key of the fake, generated once.
+func (s *Storage) signingKey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.signer != nil {
+		return s.signer, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.signer = pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	return s.signer, nil
+}
+
+// ------------------- listing -------------------
+
+func (b *bucketHandle) Objects(ctx context.Context, q *storage.Query) gcsenhancer.ObjectIterator {
+	if err := b.s.begin(Call{Op: OpList, Bucket: b.name}); err != nil {
+		return &objectIterator{err: err}
+	}
+
+	if q == nil {
+		q = &storage.Query{}
+	}
+
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+
+	bkt := b.s.bucket(b.name)
+
+	names := make([]string, 0, len(bkt.objects))
+
+	for name := range bkt.objects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	it := &objectIterator{}
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, q.Prefix) {
+			continue
+		}
+
+		if q.StartOffset != "" && name < q.StartOffset {
+			continue
+		}
+
+		if q.EndOffset != "" && name >= q.EndOffset {
+			continue
+		}
+
+		if q.Delimiter != "" {
+			rest := strings.TrimPrefix(name, q.Prefix)
+
+			if i := strings.Index(rest, q.Delimiter); i >= 0 {
+				prefix := q.Prefix + rest[:i+len(q.Delimiter)]
+
+				if !seen[prefix] {
+					seen[prefix] = true
+					it.attrs = append(it.attrs, &storage.ObjectAttrs{Prefix: prefix})
+				}
+
+				continue
+			}
+		}
+
+		attrs := copyAttrs(bkt.objects[name].Attrs)
+
+		// Listings only carry the ACL with the full projection.
+		if q.Projection != storage.ProjectionFull {
+			attrs.ACL = nil
+		}
+
+		it.attrs = append(it.attrs, &attrs)
+	}
+
+	return it
+}
+
+type objectIterator struct {
+	attrs []*storage.ObjectAttrs
+	err   error
+}
+
+func (it *objectIterator) Next() (*storage.ObjectAttrs, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	if len(it.attrs) == 0 {
+		return nil, iterator.Done
+	}
+
+	attrs := it.attrs[0]
+	it.attrs = it.attrs[1:]
+
+	return attrs, nil
+}
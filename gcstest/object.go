@@ -0,0 +1,669 @@
+package gcstest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"google.golang.org/api/googleapi"
+)
+
+type objectHandle struct {
+	s      *Storage
+	bucket string
+	name   string
+	gen    int64
+	conds  *storage.Conditions
+}
+
+func (o *objectHandle) ObjectName() string {
+	return o.name
+}
+
+func (o *objectHandle) BucketName() string {
+	return o.bucket
+}
+
+func (o *objectHandle) If(conds storage.Conditions) gcsenhancer.ObjectHandle {
+	h := *o
+	h.conds = &conds
+
+	return &h
+}
+
+func (o *objectHandle) Generation(gen int64) gcsenhancer.ObjectHandle {
+	h := *o
+	h.gen = gen
+
+	return &h
+}
+
+func (o *objectHandle) call(op Op) Call {
+	return Call{
+		Op:         op,
+		Bucket:     o.bucket,
+		Object:     o.name,
+		Conditions: o.conds,
+		Generation: o.gen,
+	}
+}
+
+// begin validates the handle, records the call and runs the interceptor.
+func (o *objectHandle) begin(ctx context.Context, c Call) error {
+	if err := validateConditions(string(c.Op), o.conds); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return o.s.begin(c)
+}
+
+// lookup returns the object of the handle, nil when missing or when the
+// pinned generation isn't the live one. Called with mu held.
+func (o *objectHandle) lookup() *Object {
+	obj, ok := o.s.bucket(o.bucket).objects[o.name]
+
+	if !ok || (o.gen != 0 && obj.Attrs.Generation != o.gen) {
+		return nil
+	}
+
+	return obj
+}
+
+func (o *objectHandle) Attrs(ctx context.Context) (*storage.ObjectAttrs, error) {
+	if err := o.begin(ctx, o.call(OpAttrs)); err != nil {
+		return nil, err
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	obj := o.lookup()
+
+	if obj == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if err := checkConditions(o.conds, obj); err != nil {
+		return nil, err
+	}
+
+	attrs := copyAttrs(obj.Attrs)
+
+	return &attrs, nil
+}
+
+func (o *objectHandle) Update(ctx context.Context, uattrs storage.ObjectAttrsToUpdate) (*storage.ObjectAttrs, error) {
+	if err := o.begin(ctx, o.call(OpUpdate)); err != nil {
+		return nil, err
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	obj := o.lookup()
+
+	if obj == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if err := checkConditions(o.conds, obj); err != nil {
+		return nil, err
+	}
+
+	attrs := copyAttrs(obj.Attrs)
+
+	for field, v := range map[*string]interface{}{
+		&attrs.ContentType:        uattrs.ContentType,
+		&attrs.ContentLanguage:    uattrs.ContentLanguage,
+		&attrs.ContentEncoding:    uattrs.ContentEncoding,
+		&attrs.ContentDisposition: uattrs.ContentDisposition,
+		&attrs.CacheControl:       uattrs.CacheControl,
+	} {
+		if v != nil {
+			*field = v.(string)
+		}
+	}
+
+	if v := uattrs.TemporaryHold; v != nil {
+		attrs.TemporaryHold = v.(bool)
+	}
+
+	if v := uattrs.EventBasedHold; v != nil {
+		attrs.EventBasedHold = v.(bool)
+	}
+
+	if !uattrs.CustomTime.IsZero() {
+		if uattrs.CustomTime.Before(attrs.CustomTime) {
+			return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "custom time can't be moved back"}
+		}
+
+		attrs.CustomTime = uattrs.CustomTime
+	}
+
+	// Metadata is merged, the empty map clears it.
+	if uattrs.Metadata != nil {
+		if len(uattrs.Metadata) == 0 || attrs.Metadata == nil {
+			attrs.Metadata = make(map[string]string)
+		}
+
+		for k, v := range uattrs.Metadata {
+			attrs.Metadata[k] = v
+		}
+	}
+
+	if uattrs.ACL != nil || uattrs.PredefinedACL != "" {
+		bkt := o.s.bucket(o.bucket)
+
+		if bkt.attrs.UniformBucketLevelAccess.Enabled {
+			return nil, uniformAccessError()
+		}
+
+		attrs.ACL = append([]storage.ACLRule(nil), uattrs.ACL...)
+
+		if uattrs.PredefinedACL != "" {
+			acl, err := bkt.aclOf(uattrs.PredefinedACL)
+
+			if err != nil {
+				return nil, err
+			}
+
+			attrs.ACL = acl
+		}
+	}
+
+	attrs.Metageneration++
+	attrs.Updated = o.s.now()
+	obj.Attrs = attrs
+
+	out := copyAttrs(attrs)
+
+	return &out, nil
+}
+
+func (o *objectHandle) Delete(ctx context.Context) error {
+	if err := o.begin(ctx, o.call(OpDelete)); err != nil {
+		return err
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	obj := o.lookup()
+
+	if obj == nil {
+		return storage.ErrObjectNotExist
+	}
+
+	if err := checkConditions(o.conds, obj); err != nil {
+		return err
+	}
+
+	if err := o.s.checkReplaceable(obj); err != nil {
+		return err
+	}
+
+	delete(o.s.bucket(o.bucket).objects, o.name)
+
+	return nil
+}
+
+// ------------------- ACL -------------------
+
+func (o *objectHandle) ACL() gcsenhancer.ACLHandle {
+	return &aclHandle{o: o}
+}
+
+type aclHandle struct {
+	o *objectHandle
+}
+
+func (a *aclHandle) Set(ctx context.Context, entity storage.ACLEntity, role storage.ACLRole) error {
+	c := a.o.call(OpSetACL)
+	c.Attrs = &storage.ObjectAttrs{ACL: []storage.ACLRule{{Entity: entity, Role: role}}}
+
+	if err := a.o.begin(ctx, c); err != nil {
+		return err
+	}
+
+	a.o.s.mu.Lock()
+	defer a.o.s.mu.Unlock()
+
+	if a.o.s.bucket(a.o.bucket).attrs.UniformBucketLevelAccess.Enabled {
+		return uniformAccessError()
+	}
+
+	obj := a.o.lookup()
+
+	if obj == nil {
+		return storage.ErrObjectNotExist
+	}
+
+	acl := make([]storage.ACLRule, 0, len(obj.Attrs.ACL)+1)
+
+	for _, rule := range obj.Attrs.ACL {
+		if rule.Entity != entity {
+			acl = append(acl, rule)
+		}
+	}
+
+	obj.Attrs.ACL = append(acl, storage.ACLRule{Entity: entity, Role: role})
+	obj.Attrs.Metageneration++
+
+	return nil
+}
+
+func (a *aclHandle) List(ctx context.Context) ([]storage.ACLRule, error) {
+	if err := a.o.begin(ctx, a.o.call(OpListACL)); err != nil {
+		return nil, err
+	}
+
+	a.o.s.mu.Lock()
+	defer a.o.s.mu.Unlock()
+
+	if a.o.s.bucket(a.o.bucket).attrs.UniformBucketLevelAccess.Enabled {
+		return nil, uniformAccessError()
+	}
+
+	obj := a.o.lookup()
+
+	if obj == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	return append([]storage.ACLRule(nil), obj.Attrs.ACL...), nil
+}
+
+// ------------------- reads -------------------
+
+func (o *objectHandle) NewReader(ctx context.Context) (gcsenhancer.ObjectReader, error) {
+	return o.NewRangeReader(ctx, 0, -1)
+}
+
+// NewRangeReader serves gzip encoded objects decompressed, like GCS does for
+// clients not accepting gzip.
+func (o *objectHandle) NewRangeReader(ctx context.Context, offset, length int64) (gcsenhancer.ObjectReader, error) {
+	if err := o.begin(ctx, o.call(OpRead)); err != nil {
+		return nil, err
+	}
+
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+
+	obj := o.lookup()
+
+	if obj == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if err := checkConditions(o.conds, obj); err != nil {
+		if o.conds.GenerationNotMatch != 0 || o.conds.MetagenerationNotMatch != 0 {
+			return nil, &googleapi.Error{Code: http.StatusNotModified}
+		}
+
+		return nil, err
+	}
+
+	content := obj.Content
+
+	if obj.Attrs.ContentEncoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if content, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	size := int64(len(content))
+
+	if offset < 0 {
+		offset += size
+
+		if offset < 0 {
+			offset = 0
+		}
+
+		length = -1
+	}
+
+	if offset > size || (offset == size && size > 0) {
+		return nil, &googleapi.Error{Code: http.StatusRequestedRangeNotSatisfiable, Message: "requested range not satisfiable"}
+	}
+
+	end := size
+
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+
+	return &reader{
+		r: bytes.NewReader(append([]byte(nil), content[offset:end]...)),
+		attrs: storage.ReaderObjectAttrs{
+			Size:            size,
+			StartOffset:     offset,
+			ContentType:     obj.Attrs.ContentType,
+			ContentEncoding: obj.Attrs.ContentEncoding,
+			CacheControl:    obj.Attrs.CacheControl,
+			LastModified:    obj.Attrs.Updated,
+			Generation:      obj.Attrs.Generation,
+			Metageneration:  obj.Attrs.Metageneration,
+		},
+	}, nil
+}
+
+type reader struct {
+	r     *bytes.Reader
+	attrs storage.ReaderObjectAttrs
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (r *reader) Close() error {
+	return nil
+}
+
+func (r *reader) Attrs() storage.ReaderObjectAttrs {
+	return r.attrs
+}
+
+// ------------------- writes -------------------
+
+func (o *objectHandle) NewWriter(ctx context.Context) gcsenhancer.ObjectWriter {
+	return &writer{o: o, ctx: ctx}
+}
+
+// writer stores the object on Close. Like storage.Writer, the write is
+// abandoned when its context is done before Close.
+type writer struct {
+	o   *objectHandle
+	ctx context.Context
+	w   storage.Writer
+	buf bytes.Buffer
+
+	closed bool
+}
+
+func (w *writer) Settings() *storage.Writer {
+	return &w.w
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("storage: Writer is closed")
+	}
+
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return w.buf.Write(p)
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	w.closed = true
+
+	attrs := copyAttrs(w.w.ObjectAttrs)
+	c := w.o.call(OpWrite)
+	c.Attrs = &attrs
+
+	if err := w.o.begin(w.ctx, c); err != nil {
+		return err
+	}
+
+	content := w.buf.Bytes()
+
+	if w.w.SendCRC32C {
+		if got := crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli)); got != w.w.CRC32C {
+			return &googleapi.Error{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Provided CRC32C %d doesn't match calculated CRC32C %d.", w.w.CRC32C, got),
+			}
+		}
+	}
+
+	if attrs.ContentType == "" {
+		attrs.ContentType = http.DetectContentType(content)
+	}
+
+	s := w.o.s
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := w.o.s.bucket(w.o.bucket).objects[w.o.name]
+
+	if err := checkConditions(w.o.conds, existing); err != nil {
+		return err
+	}
+
+	if err := s.checkReplaceable(existing); err != nil {
+		return err
+	}
+
+	if attrs.Retention != nil && s.bucket(w.o.bucket).attrs.ObjectRetentionMode != "Enabled" {
+		return &googleapi.Error{Code: http.StatusBadRequest, Message: "Object retention is not enabled for the bucket."}
+	}
+
+	acl, err := s.bucket(w.o.bucket).aclOf(attrs.PredefinedACL)
+
+	if err != nil {
+		return err
+	}
+
+	attrs.ACL = acl
+	attrs.PredefinedACL = ""
+
+	s.store(w.o.bucket, w.o.name, content, &attrs)
+
+	return nil
+}
+
+// ------------------- copies and composition -------------------
+
+func (o *objectHandle) CopierFrom(src gcsenhancer.ObjectHandle) gcsenhancer.ObjectCopier {
+	return &copier{dst: o, src: src.(*objectHandle)}
+}
+
+type copier struct {
+	dst *objectHandle
+	src *objectHandle
+	c   storage.Copier
+}
+
+func (c *copier) Settings() *storage.Copier {
+	return &c.c
+}
+
+// Run copies the source, of which the attributes set on the copier override
+// those of the source. The copy gets the default object ACL of the bucket
+// unless a predefined ACL is set.
+func (c *copier) Run(ctx context.Context) (*storage.ObjectAttrs, error) {
+	set := copyAttrs(c.c.ObjectAttrs)
+	call := c.dst.call(OpCopy)
+	call.Attrs = &set
+
+	if err := validateConditions("Copy source", c.src.conds); err != nil {
+		return nil, err
+	}
+
+	if err := c.dst.begin(ctx, call); err != nil {
+		return nil, err
+	}
+
+	s := c.dst.s
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src := c.src.lookup()
+
+	if src == nil {
+		return nil, storage.ErrObjectNotExist
+	}
+
+	if err := checkConditions(c.src.conds, src); err != nil {
+		return nil, err
+	}
+
+	existing := s.bucket(c.dst.bucket).objects[c.dst.name]
+
+	if err := checkConditions(c.dst.conds, existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkReplaceable(existing); err != nil {
+		return nil, err
+	}
+
+	attrs := storage.ObjectAttrs{
+		ContentType:        src.Attrs.ContentType,
+		ContentLanguage:    src.Attrs.ContentLanguage,
+		ContentEncoding:    src.Attrs.ContentEncoding,
+		ContentDisposition: src.Attrs.ContentDisposition,
+		CacheControl:       src.Attrs.CacheControl,
+		Metadata:           src.Attrs.Metadata,
+		StorageClass:       src.Attrs.StorageClass,
+		KMSKeyName:         src.Attrs.KMSKeyName,
+		CustomTime:         src.Attrs.CustomTime,
+	}
+
+	for field, v := range map[*string]string{
+		&attrs.ContentType:        set.ContentType,
+		&attrs.ContentLanguage:    set.ContentLanguage,
+		&attrs.ContentEncoding:    set.ContentEncoding,
+		&attrs.ContentDisposition: set.ContentDisposition,
+		&attrs.CacheControl:       set.CacheControl,
+		&attrs.StorageClass:       set.StorageClass,
+		&attrs.KMSKeyName:         c.c.DestinationKMSKeyName,
+	} {
+		if v != "" {
+			*field = v
+		}
+	}
+
+	if set.Metadata != nil {
+		attrs.Metadata = set.Metadata
+	}
+
+	attrs = copyAttrs(attrs)
+
+	acl, err := s.bucket(c.dst.bucket).aclOf(set.PredefinedACL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	attrs.ACL = acl
+
+	return s.store(c.dst.bucket, c.dst.name, src.Content, &attrs), nil
+}
+
+func (o *objectHandle) ComposerFrom(srcs ...gcsenhancer.ObjectHandle) gcsenhancer.ObjectComposer {
+	handles := make([]*objectHandle, len(srcs))
+
+	for i, src := range srcs {
+		handles[i] = src.(*objectHandle)
+	}
+
+	return &composer{dst: o, srcs: handles}
+}
+
+type composer struct {
+	dst  *objectHandle
+	srcs []*objectHandle
+	c    storage.Composer
+}
+
+func (c *composer) Settings() *storage.Composer {
+	return &c.c
+}
+
+// Run concatenates the sources. Like GCS, composite objects have no MD5.
+func (c *composer) Run(ctx context.Context) (*storage.ObjectAttrs, error) {
+	set := copyAttrs(c.c.ObjectAttrs)
+	call := c.dst.call(OpCompose)
+	call.Attrs = &set
+
+	if err := c.dst.begin(ctx, call); err != nil {
+		return nil, err
+	}
+
+	if len(c.srcs) == 0 || len(c.srcs) > 32 {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "compose takes 1 to 32 sources"}
+	}
+
+	s := c.dst.s
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objs := make([]*Object, len(c.srcs))
+	components := int64(0)
+
+	for i, src := range c.srcs {
+		if src.bucket != c.dst.bucket {
+			return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "compose sources must be in the destination bucket"}
+		}
+
+		if objs[i] = src.lookup(); objs[i] == nil {
+			return nil, storage.ErrObjectNotExist
+		}
+
+		n := objs[i].components
+
+		if n == 0 {
+			n = 1
+		}
+
+		components += n
+	}
+
+	if components > 1024 {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "composite objects are limited to 1024 components"}
+	}
+
+	existing := s.bucket(c.dst.bucket).objects[c.dst.name]
+
+	if err := checkConditions(c.dst.conds, existing); err != nil {
+		return nil, err
+	}
+
+	acl, err := s.bucket(c.dst.bucket).aclOf(set.PredefinedACL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	set.ACL = acl
+	set.PredefinedACL = ""
+
+	attrs := s.store(c.dst.bucket, c.dst.name, concat(objs), &set)
+
+	stored := s.bucket(c.dst.bucket).objects[c.dst.name]
+	stored.Attrs.MD5 = nil
+	stored.components = components
+
+	attrs.MD5 = nil
+
+	return attrs, nil
+}
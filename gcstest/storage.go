@@ -0,0 +1,413 @@
+// Package gcstest provides an in-memory fake of the storage the enhancer
+// runs against, see gcsenhancer.NewWithStorage. Besides the content of the
+// objects, it records their attributes, ACL and the preconditions of every
+// call, so tests can assert on them.
+package gcstest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"google.golang.org/api/googleapi"
+)
+
+// Op is the kind of a call made to the fake.
+type Op string
+
+const (
+	OpAttrs          Op = "attrs"
+	OpRead           Op = "read"
+	OpWrite          Op = "write"
+	OpUpdate         Op = "update"
+	OpDelete         Op = "delete"
+	OpSetACL         Op = "acl.set"
+	OpListACL        Op = "acl.list"
+	OpCopy           Op = "copy"
+	OpCompose        Op = "compose"
+	OpList           Op = "list"
+	OpBucketAttrs    Op = "bucket.attrs"
+	OpBucketUpdate   Op = "bucket.update"
+	OpLockRetention  Op = "bucket.lockRetention"
+	OpIAMPolicy      Op = "bucket.iamPolicy"
+	OpSignURL        Op = "bucket.signURL"
+	OpSignPostPolicy Op = "bucket.signPostPolicy"
+)
+
+// Call is a call made to the fake. Object is empty for bucket calls.
+type Call struct {
+	Op     Op
+	Bucket string
+	Object string
+
+	// Conditions are the preconditions of the call, if any.
+	Conditions *storage.Conditions
+
+	// Generation is the generation the object handle is pinned to, or zero.
+	Generation int64
+
+	// Attrs are the attributes written by OpWrite, OpCopy and OpCompose,
+	// and the ACL set by OpSetACL.
+	Attrs *storage.ObjectAttrs
+}
+
+// Object is the state of a stored object.
+type Object struct {
+	Attrs   storage.ObjectAttrs
+	Content []byte
+
+	// components is the component count of composite objects.
+	components int64
+}
+
+// Storage is an in-memory gcsenhancer.Storage. Buckets are created on first
+// use. It is safe for concurrent use.
+type Storage struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	gen       int64
+	calls     []Call
+	intercept func(Call) error
+	now       func() time.Time
+	signer    []byte
+}
+
+var _ gcsenhancer.Storage = (*Storage)(nil)
+
+type bucket struct {
+	attrs   storage.BucketAttrs
+	policy  *iam.Policy
+	objects map[string]*Object
+}
+
+// New returns an empty fake.
+func New() *Storage {
+	return &Storage{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Bucket returns the handle of the bucket name.
+func (s *Storage) Bucket(name string) gcsenhancer.BucketHandle {
+	return &bucketHandle{s: s, name: name}
+}
+
+// Intercept makes fn see every call before it is served. A non-nil error
+// fails the call with it, e.g. to simulate outages or permission errors.
+// fn is called without any lock held, it may block.
+func (s *Storage) Intercept(fn func(Call) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.intercept = fn
+}
+
+// SetClock sets the clock the timestamps of objects are taken from.
+func (s *Storage) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+}
+
+// Calls returns the calls made so far, in order.
+func (s *Storage) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the calls of kind op made so far, in order.
+func (s *Storage) CallsTo(op Op) []Call {
+	var calls []Call
+
+	for _, c := range s.Calls() {
+		if c.Op == op {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Object returns the stored object name of bucketName.
+func (s *Storage) Object(bucketName, name string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.bucket(bucketName).objects[name]
+
+	if !ok {
+		return Object{}, false
+	}
+
+	return Object{
+		Attrs:   copyAttrs(obj.Attrs),
+		Content: append([]byte(nil), obj.Content...),
+	}, true
+}
+
+// Objects returns the sorted names of the objects stored in bucketName.
+func (s *Storage) Objects(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0)
+
+	for name := range s.bucket(bucketName).objects {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Put stores an object as if it was uploaded with attrs, of which the
+// checksums, size, generation and timestamps are set by the fake.
+func (s *Storage) Put(bucketName, name string, content []byte, attrs storage.ObjectAttrs) *storage.ObjectAttrs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs = copyAttrs(attrs)
+
+	return s.store(bucketName, name, content, &attrs)
+}
+
+// SetBucketAttrs sets the attributes of the bucket, e.g. its uniform
+// bucket-level access or retention policy. Objects can only be retained
+// individually in buckets with an ObjectRetentionMode of "Enabled".
+func (s *Storage) SetBucketAttrs(name string, attrs storage.BucketAttrs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attrs.Name = name
+	s.bucket(name).attrs = attrs
+}
+
+// SetIAMPolicy sets the IAM policy of the bucket.
+func (s *Storage) SetIAMPolicy(bucketName string, policy *iam.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bucket(bucketName).policy = policy
+}
+
+// ------------------- internals, called with mu held unless noted -------------------
+
+// begin records the call and runs the interceptor. Called without mu held.
+func (s *Storage) begin(c Call) error {
+	s.mu.Lock()
+	s.calls = append(s.calls, c)
+	intercept := s.intercept
+	s.mu.Unlock()
+
+	if intercept == nil {
+		return nil
+	}
+
+	return intercept(c)
+}
+
+func (s *Storage) bucket(name string) *bucket {
+	b, ok := s.buckets[name]
+
+	if !ok {
+		b = &bucket{
+			attrs:   storage.BucketAttrs{Name: name, MetaGeneration: 1},
+			objects: make(map[string]*Object),
+		}
+		s.buckets[name] = b
+	}
+
+	return b
+}
+
+// store writes content under name with attrs, filling in the attributes GCS
+// computes.
+func (s *Storage) store(bucketName, name string, content []byte, attrs *storage.ObjectAttrs) *storage.ObjectAttrs {
+	b := s.bucket(bucketName)
+	now := s.now()
+	sum := md5.Sum(content)
+
+	s.gen++
+
+	attrs.Bucket = bucketName
+	attrs.Name = name
+	attrs.Size = int64(len(content))
+	attrs.MD5 = sum[:]
+	attrs.CRC32C = crc32.Checksum(content, crc32.MakeTable(crc32.Castagnoli))
+	attrs.Generation = s.gen
+	attrs.Metageneration = 1
+	attrs.Etag = fmt.Sprintf("etag-%d", s.gen)
+	attrs.Created = now
+	attrs.Updated = now
+
+	if attrs.StorageClass == "" {
+		attrs.StorageClass = "STANDARD"
+	}
+
+	if attrs.ContentType == "" {
+		attrs.ContentType = "application/octet-stream"
+	}
+
+	if p := b.attrs.RetentionPolicy; p != nil && p.RetentionPeriod > 0 {
+		attrs.RetentionExpirationTime = now.Add(p.RetentionPeriod)
+	}
+
+	b.objects[name] = &Object{
+		Attrs:   copyAttrs(*attrs),
+		Content: append([]byte(nil), content...),
+	}
+
+	out := copyAttrs(*attrs)
+
+	return &out
+}
+
+// aclOf returns the ACL of a new object of b written with predefinedACL.
+func (b *bucket) aclOf(predefinedACL string) ([]storage.ACLRule, error) {
+	if predefinedACL == "" {
+		return append([]storage.ACLRule(nil), b.attrs.DefaultObjectACL...), nil
+	}
+
+	if b.attrs.UniformBucketLevelAccess.Enabled {
+		return nil, uniformAccessError()
+	}
+
+	switch predefinedACL {
+	case "publicRead":
+		return []storage.ACLRule{{Entity: storage.AllUsers, Role: storage.RoleReader}}, nil
+	case "private", "projectPrivate", "authenticatedRead", "bucketOwnerRead", "bucketOwnerFullControl":
+		return nil, nil
+	}
+
+	return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "invalid predefinedAcl " + predefinedACL}
+}
+
+// checkReplaceable fails when obj can't be overwritten or deleted.
+func (s *Storage) checkReplaceable(obj *Object) error {
+	if obj == nil {
+		return nil
+	}
+
+	a := obj.Attrs
+
+	retained := a.Retention != nil && a.Retention.RetainUntil.After(s.now())
+
+	if a.TemporaryHold || a.EventBasedHold || retained || a.RetentionExpirationTime.After(s.now()) {
+		return &googleapi.Error{Code: http.StatusForbidden, Message: fmt.Sprintf("object %s is under active hold or retention", a.Name)}
+	}
+
+	return nil
+}
+
+func checkConditions(conds *storage.Conditions, obj *Object) error {
+	if conds == nil {
+		return nil
+	}
+
+	failed := false
+
+	switch {
+	case conds.DoesNotExist:
+		failed = obj != nil
+	case conds.GenerationMatch != 0:
+		failed = obj == nil || obj.Attrs.Generation != conds.GenerationMatch
+	case conds.GenerationNotMatch != 0:
+		failed = obj == nil || obj.Attrs.Generation == conds.GenerationNotMatch
+	}
+
+	switch {
+	case conds.MetagenerationMatch != 0:
+		failed = failed || obj == nil || obj.Attrs.Metageneration != conds.MetagenerationMatch
+	case conds.MetagenerationNotMatch != 0:
+		failed = failed || obj == nil || obj.Attrs.Metageneration == conds.MetagenerationNotMatch
+	}
+
+	if failed {
+		return preconditionError()
+	}
+
+	return nil
+}
+
+// validateConditions mirrors the validation of the storage client.
+func validateConditions(method string, conds *storage.Conditions) error {
+	if conds == nil {
+		return nil
+	}
+
+	if *conds == (storage.Conditions{}) {
+		return fmt.Errorf("storage: %s: empty conditions", method)
+	}
+
+	gens := 0
+
+	for _, set := range []bool{conds.GenerationMatch != 0, conds.GenerationNotMatch != 0, conds.DoesNotExist} {
+		if set {
+			gens++
+		}
+	}
+
+	if gens > 1 {
+		return fmt.Errorf("storage: %s: multiple conditions specified for generation", method)
+	}
+
+	if conds.MetagenerationMatch != 0 && conds.MetagenerationNotMatch != 0 {
+		return fmt.Errorf("storage: %s: multiple conditions specified for metageneration", method)
+	}
+
+	return nil
+}
+
+func preconditionError() error {
+	return &googleapi.Error{Code: http.StatusPreconditionFailed, Message: "At least one of the pre-conditions you specified did not hold."}
+}
+
+func uniformAccessError() error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: "Cannot use ACL API to update object policy when uniform bucket-level access is enabled."}
+}
+
+func copyAttrs(a storage.ObjectAttrs) storage.ObjectAttrs {
+	if a.Metadata != nil {
+		metadata := make(map[string]string, len(a.Metadata))
+
+		for k, v := range a.Metadata {
+			metadata[k] = v
+		}
+
+		a.Metadata = metadata
+	}
+
+	a.ACL = append([]storage.ACLRule(nil), a.ACL...)
+	a.MD5 = append([]byte(nil), a.MD5...)
+
+	if a.Retention != nil {
+		retention := *a.Retention
+		a.Retention = &retention
+	}
+
+	return a
+}
+
+// concat joins the contents of objs.
+func concat(objs []*Object) []byte {
+	var buf bytes.Buffer
+
+	for _, obj := range objs {
+		buf.Write(obj.Content)
+	}
+
+	return buf.Bytes()
+}
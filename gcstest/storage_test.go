@@ -0,0 +1,103 @@
+package gcstest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadRecordsACLAndMetadata(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.Upload(context.Background(), strings.NewReader("hello"), "docs/hello.txt", gcsenhancer.UploadOptions{
+		PublicAccess: true,
+		ContentType:  "text/plain",
+		Metadata:     map[string]string{"owner": "42"},
+		Conditions:   &storage.Conditions{DoesNotExist: true},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, ok := fake.Object("bucket", "docs/hello.txt")
+
+	if !ok {
+		t.Fatal("object not stored")
+	}
+
+	if got := string(obj.Content); got != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+
+	if obj.Attrs.ContentType != "text/plain" {
+		t.Errorf("content type = %q, want text/plain", obj.Attrs.ContentType)
+	}
+
+	if obj.Attrs.Metadata["owner"] != "42" {
+		t.Errorf("metadata = %v, want owner=42", obj.Attrs.Metadata)
+	}
+
+	if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers || obj.Attrs.ACL[0].Role != storage.RoleReader {
+		t.Errorf("ACL = %v, want AllUsers reader", obj.Attrs.ACL)
+	}
+
+	writes := fake.CallsTo(gcstest.OpWrite)
+
+	if len(writes) != 1 {
+		t.Fatalf("%d writes, want 1", len(writes))
+	}
+
+	if c := writes[0].Conditions; c == nil || !c.DoesNotExist {
+		t.Errorf("write conditions = %+v, want DoesNotExist", c)
+	}
+
+	if len(fake.CallsTo(gcstest.OpSetACL)) != 1 {
+		t.Errorf("ACL set %d times, want once", len(fake.CallsTo(gcstest.OpSetACL)))
+	}
+}
+
+func TestPrivateUploadHasNoACL(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+
+	if len(obj.Attrs.ACL) != 0 {
+		t.Errorf("ACL = %v, want none", obj.Attrs.ACL)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpSetACL)); n != 0 {
+		t.Errorf("ACL set %d times, want never", n)
+	}
+}
+
+func TestPredefinedACLOnUniformBucketFails(t *testing.T) {
+	fake := gcstest.New()
+	fake.SetBucketAttrs("bucket", storage.BucketAttrs{
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		PredefinedACL: gcsenhancer.PredefinedACLPublicRead,
+	})
+
+	if err == nil {
+		t.Fatal("upload with a predefined ACL succeeded on a uniform bucket")
+	}
+
+	if _, ok := fake.Object("bucket", "a.txt"); ok {
+		t.Error("object stored despite the failure")
+	}
+}
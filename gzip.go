@@ -0,0 +1,124 @@
+package gcsenhancer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// incompressibleTypes are content types already compressed, gzipping them
+// wastes CPU and often inflates them. Entries ending with "/" match the
+// whole top-level type.
+var incompressibleTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"image/heic",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+}
+
+// compressible reports whether content of contentType is worth gzipping.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	for _, t := range incompressibleTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return false
+		}
+
+		if mediaType == t {
+			return false
+		}
+	}
+
+	return true
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// validateGzipLevel checks level is a valid UploadOptions.GzipLevel.
+func validateGzipLevel(level int) error {
+	if level == 0 || level == gzip.HuffmanOnly || level == gzip.DefaultCompression {
+		return nil
+	}
+
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return fmt.Errorf("gcsenhancer: invalid gzip level %d", level)
+	}
+
+	return nil
+}
+
+// gzipReader streams the gzip compression of r at level, validated with
+// validateGzipLevel. The returned reader must be closed to stop the
+// compression when it is not read to the end; Close returns once r is no
+// longer read, so r can be rewound for a retry.
+func gzipReader(r io.Reader, level int) io.ReadCloser {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// The level is valid, NewWriterLevel can't fail.
+		gz, _ := gzip.NewWriterLevel(pw, level)
+
+		_, err := io.Copy(gz, r)
+
+		if err == nil {
+			err = gz.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return &gzipStream{PipeReader: pr, done: done}
+}
+
+// gzipStream is the reading end of the compression of gzipReader.
+type gzipStream struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close stops the compression and waits for it to return.
+func (s *gzipStream) Close() error {
+	err := s.PipeReader.Close()
+	<-s.done
+
+	return err
+}
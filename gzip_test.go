@@ -0,0 +1,201 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+func TestGzipSkipsCompressedContent(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	svg := strings.Repeat(`<rect width="1" height="1"/>`, 64)
+
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		content     string
+		gzipped     bool
+	}{
+		{"photo.jpg", "image/jpeg", "\xff\xd8\xff\xe0jpeg", false},
+		{"icon.svg", "image/svg+xml; charset=utf-8", svg, true},
+	} {
+		_, err := e.Upload(context.Background(), strings.NewReader(tt.content), tt.name, gcsenhancer.UploadOptions{
+			ContentType: tt.contentType,
+			Gzip:        true,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", tt.name)
+
+		if got := obj.Attrs.ContentEncoding == "gzip"; got != tt.gzipped {
+			t.Errorf("%s: content encoding = %q, gzipped %v, want %v", tt.name, obj.Attrs.ContentEncoding, got, tt.gzipped)
+		}
+
+		content := obj.Content
+
+		if tt.gzipped {
+			zr, err := gzip.NewReader(bytes.NewReader(content))
+
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			if content, err = io.ReadAll(zr); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+
+		if string(content) != tt.content {
+			t.Errorf("%s: stored content differs from the source", tt.name)
+		}
+	}
+}
+
+func TestGzipLevel(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	var payload strings.Builder
+
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&payload, "line %d: value %d\n", i, i*i%997)
+	}
+
+	sizes := make(map[int]int64)
+
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		name := fmt.Sprintf("level%d.txt", level)
+
+		_, err := e.Upload(ctx, strings.NewReader(payload.String()), name, gcsenhancer.UploadOptions{
+			ContentType: "text/plain",
+			Gzip:        true,
+			GzipLevel:   level,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", name)
+		sizes[level] = obj.Attrs.Size
+	}
+
+	if sizes[gzip.BestCompression] >= sizes[gzip.BestSpeed] {
+		t.Errorf("BestCompression stored %d bytes, BestSpeed %d, want it smaller", sizes[gzip.BestCompression], sizes[gzip.BestSpeed])
+	}
+
+	_, err := e.Upload(ctx, strings.NewReader("x"), "invalid.txt", gcsenhancer.UploadOptions{Gzip: true, GzipLevel: 42})
+
+	if err == nil {
+		t.Error("upload with gzip level 42 succeeded")
+	}
+
+	if _, ok := fake.Object("bucket", "invalid.txt"); ok {
+		t.Error("object stored despite the invalid level")
+	}
+}
+
+// flakyWrites fails the first write of any object once it is given data.
+type flakyWrites struct {
+	gcsenhancer.Storage
+	failed int32
+}
+
+func (s *flakyWrites) Bucket(name string) gcsenhancer.BucketHandle {
+	return flakyBucket{s.Storage.Bucket(name), s}
+}
+
+type flakyBucket struct {
+	gcsenhancer.BucketHandle
+	s *flakyWrites
+}
+
+func (b flakyBucket) Object(name string) gcsenhancer.ObjectHandle {
+	return flakyObject{b.BucketHandle.Object(name), b.s}
+}
+
+func (b flakyBucket) Retryer(opts ...storage.RetryOption) gcsenhancer.BucketHandle {
+	return flakyBucket{b.BucketHandle.Retryer(opts...), b.s}
+}
+
+type flakyObject struct {
+	gcsenhancer.ObjectHandle
+	s *flakyWrites
+}
+
+func (o flakyObject) If(conds storage.Conditions) gcsenhancer.ObjectHandle {
+	return flakyObject{o.ObjectHandle.If(conds), o.s}
+}
+
+func (o flakyObject) NewWriter(ctx context.Context) gcsenhancer.ObjectWriter {
+	return flakyWriter{o.ObjectHandle.NewWriter(ctx), o.s}
+}
+
+type flakyWriter struct {
+	gcsenhancer.ObjectWriter
+	s *flakyWrites
+}
+
+func (w flakyWriter) Write(p []byte) (int, error) {
+	if atomic.CompareAndSwapInt32(&w.s.failed, 0, 1) {
+		return 0, &googleapi.Error{Code: http.StatusServiceUnavailable}
+	}
+
+	return w.ObjectWriter.Write(p)
+}
+
+func TestGzipRetryAfterFailedWrite(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(&flakyWrites{Storage: fake}, "bucket",
+		gcsenhancer.WithRetryPolicy(gcsenhancer.ExponentialBackoff{BaseDelay: time.Millisecond}))
+
+	// Random content compresses poorly, the first write happens while most
+	// of the file is still to be compressed.
+	payload := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	_, err := e.Upload(context.Background(), bytes.NewReader(payload), "a.bin", gcsenhancer.UploadOptions{
+		ContentType: "application/octet-stream",
+		Gzip:        true,
+		Retries:     1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.bin")
+	zr, err := gzip.NewReader(bytes.NewReader(obj.Content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := io.ReadAll(zr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, payload) {
+		t.Errorf("stored %d bytes decompressing to something else than the file", len(obj.Content))
+	}
+}
@@ -0,0 +1,180 @@
+package gcsenhancer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+)
+
+// DefaultUploadFormField is the form field UploadHandler reads the file from.
+const DefaultUploadFormField = "file"
+
+type UploadHandlerOptions struct {
+	// FormField is the multipart field holding the file. Defaults to
+	// DefaultUploadFormField.
+	FormField string
+
+	// MaxSize caps the size of the file. Defaults to DefaultMaxRemoteSize.
+	MaxSize int64
+
+	// AllowedContentTypes restricts the files accepted, see
+	// WithAllowedContentTypes. Any content type is accepted when empty.
+	AllowedContentTypes []string
+
+	// Prefix is prepended to the name of the file, e.g. "uploads/".
+	Prefix string
+
+	// UploadOptions are the options of the upload. ContentType is always
+	// sniffed from the file, the one declared by the part is ignored as
+	// clients can set any.
+	UploadOptions UploadOptions
+
+	// Overwrite lets an upload replace the object stored under the same
+	// name. The name comes from the client, so by default a name taken is
+	// suffixed instead, see CollisionSuffix, unless UploadOptions sets
+	// another strategy than CollisionOverwrite.
+	Overwrite bool
+}
+
+// UploadHandler returns a handler storing the file of multipart POST
+// requests with e, and responding with its link as JSON:
+//
+//	{"name": "uploads/cat.png", "link": "https://..."}
+//
+// The object is named after the file, under Prefix. Existing objects are
+// not replaced unless Overwrite is set, the name is suffixed instead, e.g.
+// "uploads/cat (1).png".
+//
+// The file is streamed, never held in memory as a whole. Failures are
+// responded as {"error": "..."} with a 4xx status for bad requests: 405,
+// 400, 413 for files over MaxSize and 415 for content types not allowed.
+// Other failures are logged and responded with a 500.
+func UploadHandler(e *GCSEnhancer, opts UploadHandlerOptions) http.Handler {
+	if opts.FormField == "" {
+		opts.FormField = DefaultUploadFormField
+	}
+
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxRemoteSize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+
+			return
+		}
+
+		info, err := handleUpload(e, w, r, opts)
+
+		if err != nil {
+			writeJSONError(w, uploadErrorStatus(err), err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{
+			"name": info.Filename,
+			"link": info.PublicLink,
+		})
+	})
+}
+
+var (
+	errNoFile      = errors.New("gcsenhancer: no file in the request")
+	errBadUpload   = errors.New("gcsenhancer: malformed upload request")
+	multipartSlack = int64(1 << 20)
+)
+
+func handleUpload(e *GCSEnhancer, w http.ResponseWriter, r *http.Request, opts UploadHandlerOptions) (*UploadedFileInfo, error) {
+	// Other fields and the multipart framing come on top of the file.
+	r.Body = http.MaxBytesReader(w, r.Body, opts.MaxSize+multipartSlack)
+
+	mr, err := r.MultipartReader()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadUpload, err)
+	}
+
+	for {
+		part, err := mr.NextPart()
+
+		if err == io.EOF {
+			return nil, errNoFile
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadUpload, err)
+		}
+
+		if part.FormName() != opts.FormField || part.FileName() == "" {
+			continue
+		}
+
+		return uploadPart(e, r, part, opts)
+	}
+}
+
+func uploadPart(e *GCSEnhancer, r *http.Request, part *multipart.Part, opts UploadHandlerOptions) (*UploadedFileInfo, error) {
+	body := bufio.NewReader(part)
+	head, _ := body.Peek(sniffLen)
+	contentType := http.DetectContentType(head)
+
+	if len(opts.AllowedContentTypes) > 0 && !contentTypeAllowed(opts.AllowedContentTypes, contentType) {
+		return nil, fmt.Errorf("%w: content sniffed as %s", ErrContentTypeNotAllowed, contentType)
+	}
+
+	uploadOpts := opts.UploadOptions
+	uploadOpts.ContentType = contentType
+
+	if uploadOpts.Collision == CollisionOverwrite && !opts.Overwrite {
+		uploadOpts.Collision = CollisionSuffix
+	}
+
+	// The client controls the filename, only its base is kept.
+	name := opts.Prefix + path.Base(part.FileName())
+
+	return e.Upload(r.Context(), &limitReader{r: body, remaining: opts.MaxSize}, name, uploadOpts)
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoFile), errors.Is(err, errBadUpload), errors.Is(err, ErrEmptyObject):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrObjectTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrContentTypeNotAllowed):
+		return http.StatusUnsupportedMediaType
+	}
+
+	return http.StatusInternalServerError
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	// Internal failures are logged rather than exposed to the client.
+	if status == http.StatusInternalServerError {
+		log.Printf("gcsenhancer: upload handler failed: %v", err)
+
+		err = errors.New("upload failed")
+	}
+
+	writeJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("gcsenhancer: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// postFile posts content as the file field of a multipart form to h.
+func postFile(t *testing.T, h http.Handler, field, filename string, content []byte) (int, map[string]string) {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile(field, filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var res map[string]string
+
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+
+	return rec.Code, res
+}
+
+func TestUploadHandler(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	h := gcsenhancer.UploadHandler(e, gcsenhancer.UploadHandlerOptions{Prefix: "uploads/"})
+
+	code, res := postFile(t, h, "file", "../../notes.txt", []byte("hello"))
+
+	if code != http.StatusOK {
+		t.Fatalf("status %d: %v", code, res)
+	}
+
+	if res["name"] != "uploads/notes.txt" || res["link"] == "" {
+		t.Errorf("response = %v, want the name and link of uploads/notes.txt", res)
+	}
+
+	obj, ok := fake.Object("bucket", "uploads/notes.txt")
+
+	if !ok || string(obj.Content) != "hello" {
+		t.Fatalf("stored %q, want hello", obj.Content)
+	}
+
+	if !strings.HasPrefix(obj.Attrs.ContentType, "text/plain") {
+		t.Errorf("content type = %q, want the sniffed text/plain", obj.Attrs.ContentType)
+	}
+}
+
+func TestUploadHandlerDoesNotOverwrite(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	h := gcsenhancer.UploadHandler(e, gcsenhancer.UploadHandlerOptions{})
+
+	postFile(t, h, "file", "cat.txt", []byte("first"))
+	_, res := postFile(t, h, "file", "cat.txt", []byte("second"))
+
+	if res["name"] != "cat (1).txt" {
+		t.Errorf("second upload named %q, want cat (1).txt", res["name"])
+	}
+
+	if obj, _ := fake.Object("bucket", "cat.txt"); string(obj.Content) != "first" {
+		t.Errorf("first upload replaced by %q", obj.Content)
+	}
+
+	h = gcsenhancer.UploadHandler(e, gcsenhancer.UploadHandlerOptions{Overwrite: true})
+	_, res = postFile(t, h, "file", "cat.txt", []byte("third"))
+
+	if res["name"] != "cat.txt" {
+		t.Errorf("overwriting upload named %q, want cat.txt", res["name"])
+	}
+
+	if obj, _ := fake.Object("bucket", "cat.txt"); string(obj.Content) != "third" {
+		t.Errorf("content = %q, want third with Overwrite", obj.Content)
+	}
+}
+
+func TestUploadHandlerRejects(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100))
+
+	for _, tc := range []struct {
+		name    string
+		opts    gcsenhancer.UploadHandlerOptions
+		field   string
+		content []byte
+		status  int
+	}{
+		{"too large", gcsenhancer.UploadHandlerOptions{MaxSize: 10}, "file", bytes.Repeat([]byte("x"), 100), http.StatusRequestEntityTooLarge},
+		{"content type", gcsenhancer.UploadHandlerOptions{AllowedContentTypes: []string{"image/png"}}, "file", []byte("text"), http.StatusUnsupportedMediaType},
+		{"no file", gcsenhancer.UploadHandlerOptions{}, "other", []byte("x"), http.StatusBadRequest},
+		{"empty", gcsenhancer.UploadHandlerOptions{UploadOptions: gcsenhancer.UploadOptions{RejectEmpty: true}}, "file", nil, http.StatusBadRequest},
+		{"allowed", gcsenhancer.UploadHandlerOptions{AllowedContentTypes: []string{"image/png"}}, "file", png, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := gcstest.New()
+			h := gcsenhancer.UploadHandler(gcsenhancer.NewWithStorage(fake, "bucket"), tc.opts)
+
+			code, res := postFile(t, h, tc.field, "f.bin", tc.content)
+
+			if code != tc.status {
+				t.Fatalf("status %d, want %d: %v", code, tc.status, res)
+			}
+
+			if code != http.StatusOK && (res["error"] == "" || len(fake.Objects("bucket")) != 0) {
+				t.Errorf("response %v, objects %v, want an error and nothing stored", res, fake.Objects("bucket"))
+			}
+		})
+	}
+}
+
+func TestUploadHandlerMethodNotAllowed(t *testing.T) {
+	h := gcsenhancer.UploadHandler(gcsenhancer.NewWithStorage(gcstest.New(), "bucket"), gcsenhancer.UploadHandlerOptions{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upload", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("status %d, Allow %q, want 405 and POST", rec.Code, rec.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,38 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+)
+
+const healthcheckPrefix = ".healthcheck/"
+
+var ErrNotWritable = errors.New("gcsenhancer: bucket is not writable")
+
+// CheckWritable verifies the credentials are allowed to write to the bucket by
+// writing, then deleting, a tiny probe object under ".healthcheck/". Call it
+// on startup to catch misconfigured service accounts early.
+func (e *GCSEnhancer) CheckWritable(ctx context.Context) error {
+	name := path.Join(healthcheckPrefix, strconv.FormatInt(e.now().UnixNano(), 10))
+	object := e.bucket(e.bucketName).Object(name)
+
+	w := object.NewWriter(ctx)
+	w.Settings().ContentType = "text/plain"
+
+	if _, err := w.Write([]byte("ok")); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotWritable, e.bucketName, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrNotWritable, e.bucketName, err)
+	}
+
+	if err := object.Delete(ctx); err != nil {
+		return fmt.Errorf("%w: %s: probe %s written but not deleted: %v", ErrNotWritable, e.bucketName, name, err)
+	}
+
+	return nil
+}
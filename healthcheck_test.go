@@ -0,0 +1,53 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+func TestCheckWritable(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if err := e.CheckWritable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := fake.CallsTo(gcstest.OpWrite)
+
+	if len(writes) != 1 || !strings.HasPrefix(writes[0].Object, ".healthcheck/") {
+		t.Fatalf("writes = %+v, want one probe under .healthcheck/", writes)
+	}
+
+	if names := fake.Objects("bucket"); len(names) != 0 {
+		t.Errorf("probe %v left behind", names)
+	}
+}
+
+func TestCheckWritableDenied(t *testing.T) {
+	for _, op := range []gcstest.Op{gcstest.OpWrite, gcstest.OpDelete} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		fake.Intercept(func(c gcstest.Call) error {
+			if c.Op == op {
+				return &googleapi.Error{Code: http.StatusForbidden, Message: "storage.objects.create denied"}
+			}
+
+			return nil
+		})
+
+		err := e.CheckWritable(context.Background())
+
+		if !errors.Is(err, gcsenhancer.ErrNotWritable) {
+			t.Errorf("%s denied: err = %v, want ErrNotWritable", op, err)
+		}
+	}
+}
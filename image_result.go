@@ -0,0 +1,159 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ImageResult is the outcome of the upload of a single source image.
+type ImageResult struct {
+	SourceName    string
+	OriginalLink  string
+	ThumbnailLink string
+	Err           error
+
+	// Exif is the EXIF metadata of the source, see WithExifExtraction.
+	Exif *ExifData
+}
+
+// UploadImagesWithResults is UploadImages reporting the outcome of every
+// image separately, in the order of imgs. A failing image doesn't stop the
+// others from being uploaded. With multiple output formats, the links are
+// those of the first format.
+func (e *GCSEnhancer) UploadImagesWithResults(ctx context.Context, imgs []Images) []ImageResult {
+	results := make([]ImageResult, len(imgs))
+
+	var (
+		objs   []*ObjectInfo
+		owners []int
+	)
+
+	objsPerImage, errs := e.prepareImages(ctx, imgs)
+
+	for i, img := range imgs {
+		results[i].SourceName = img.Name
+
+		if e.extractExif && len(img.OrigBytes) > 0 {
+			results[i].Exif, _ = ParseExif(img.OrigBytes)
+		}
+
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+
+			continue
+		}
+
+		for range objsPerImage[i] {
+			owners = append(owners, i)
+		}
+
+		objs = append(objs, objsPerImage[i]...)
+	}
+
+	infos := make([]*UploadedFileInfo, len(objs))
+	uploadErrs := make([]error, len(objs))
+
+	// Errors are collected per object rather than returned, so that a single
+	// failure doesn't cancel the uploads of the other images.
+	err := e.runBounded(ctx, len(objs), func(ctx context.Context, i int) error {
+		infos[i], _, uploadErrs[i] = e.uploadObject(ctx, objs[i])
+
+		return nil
+	})
+
+	for i, obj := range objs {
+		r := &results[owners[i]]
+
+		if r.Err != nil {
+			continue
+		}
+
+		if uploadErrs[i] != nil {
+			r.Err = uploadErrs[i]
+
+			continue
+		}
+
+		if infos[i] == nil {
+			// Never started, the context was done.
+			r.Err = err
+
+			continue
+		}
+
+		if obj.Size == Original && r.OriginalLink == "" {
+			r.OriginalLink = infos[i].PublicLink
+		}
+
+		if obj.Size == Thumbnail && r.ThumbnailLink == "" {
+			r.ThumbnailLink = infos[i].PublicLink
+		}
+	}
+
+	return results
+}
+
+// ImageErrorReason classifies the failure of an image upload.
+type ImageErrorReason string
+
+const (
+	ReasonUnsupportedFormat ImageErrorReason = "unsupported_format"
+	ReasonEncode            ImageErrorReason = "encode"
+	ReasonUpload            ImageErrorReason = "upload"
+	ReasonCanceled          ImageErrorReason = "canceled"
+)
+
+// ImageError describes the failure of the image at Index of the batch.
+type ImageError struct {
+	Index  int
+	Name   string
+	Reason ImageErrorReason
+	Err    error
+}
+
+func (e ImageError) Error() string {
+	return fmt.Sprintf("image %d (%s): %s: %v", e.Index, e.Name, e.Reason, e.Err)
+}
+
+// UploadImagesWithErrors is UploadImagesWithResults splitting the outcomes
+// into the results of the uploaded images and the errors of the failed ones,
+// e.g. to tell users which uploads to retry.
+func (e *GCSEnhancer) UploadImagesWithErrors(ctx context.Context, imgs []Images) ([]ImageResult, []ImageError) {
+	var (
+		succeeded []ImageResult
+		failed    []ImageError
+	)
+
+	for i, r := range e.UploadImagesWithResults(ctx, imgs) {
+		if r.Err == nil {
+			succeeded = append(succeeded, r)
+
+			continue
+		}
+
+		failed = append(failed, ImageError{
+			Index:  i,
+			Name:   r.SourceName,
+			Reason: imageErrorReason(r.Err),
+			Err:    r.Err,
+		})
+	}
+
+	return succeeded, failed
+}
+
+func imageErrorReason(err error) ImageErrorReason {
+	var encodeErr *encodeError
+
+	switch {
+	case errors.Is(err, ErrUnsupportedFormat):
+		return ReasonUnsupportedFormat
+	case errors.As(err, &encodeErr):
+		return ReasonEncode
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ReasonCanceled
+	}
+
+	return ReasonUpload
+}
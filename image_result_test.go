@@ -0,0 +1,115 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadImagesWithResults(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys())
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && strings.HasPrefix(c.Object, "b") {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	results := e.UploadImagesWithResults(context.Background(), pngImages("a.png", "b.png", "c.png"))
+
+	if len(results) != 3 {
+		t.Fatalf("%d results, want one per image", len(results))
+	}
+
+	for i, name := range []string{"a", "b", "c"} {
+		r := results[i]
+
+		if r.SourceName != name+".png" {
+			t.Errorf("result %d is for %s, want %s.png", i, r.SourceName, name)
+		}
+
+		if name == "b" {
+			if !errors.Is(r.Err, errDenied) {
+				t.Errorf("b.png err = %v, want the write error", r.Err)
+			}
+
+			continue
+		}
+
+		if r.Err != nil {
+			t.Errorf("%s.png: %v", name, r.Err)
+		}
+
+		if !strings.HasSuffix(r.OriginalLink, "/"+name+".png") || !strings.HasSuffix(r.ThumbnailLink, "/"+name+"_thumbnail.png") {
+			t.Errorf("%s.png links %s and %s, want its own pair", name, r.OriginalLink, r.ThumbnailLink)
+		}
+	}
+}
+
+func TestUploadImagesWithErrors(t *testing.T) {
+	errEncode := errors.New("encoder broken")
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys(),
+		gcsenhancer.WithEncoder("image/gif", func(w io.Writer, img image.Image, size gcsenhancer.ImageSize) error {
+			return errEncode
+		}),
+	)
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && strings.HasPrefix(c.Object, "d") {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	imgs := pngImages("a.png", "b.bmp", "c.gif", "d.png")
+	imgs[1].Mime = "image/bmp"
+	imgs[2].Mime = "image/gif"
+
+	succeeded, failed := e.UploadImagesWithErrors(context.Background(), imgs)
+
+	if len(succeeded) != 1 || succeeded[0].SourceName != "a.png" {
+		t.Errorf("succeeded = %+v, want a.png only", succeeded)
+	}
+
+	want := []struct {
+		index  int
+		name   string
+		reason gcsenhancer.ImageErrorReason
+		err    error
+	}{
+		{1, "b.bmp", gcsenhancer.ReasonUnsupportedFormat, gcsenhancer.ErrUnsupportedFormat},
+		{2, "c.gif", gcsenhancer.ReasonEncode, errEncode},
+		{3, "d.png", gcsenhancer.ReasonUpload, errDenied},
+	}
+
+	if len(failed) != len(want) {
+		t.Fatalf("%d errors, want %d: %v", len(failed), len(want), failed)
+	}
+
+	for i, w := range want {
+		got := failed[i]
+
+		if got.Index != w.index || got.Name != w.name || got.Reason != w.reason {
+			t.Errorf("error %d = %d %s %s, want %d %s %s", i, got.Index, got.Name, got.Reason, w.index, w.name, w.reason)
+		}
+
+		if !errors.Is(got.Err, w.err) {
+			t.Errorf("%s err = %v, want %v", w.name, got.Err, w.err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+const objectViewerRole iam.RoleName = "roles/storage.objectViewer"
+
+var ErrUniformAccess = errors.New("gcsenhancer: uniform bucket-level access is enabled")
+
+// IsPublic tells whether the object is readable by anyone. Under uniform
+// bucket-level access object ACLs are disabled, so the IAM policy of the
+// bucket is inspected instead.
+func (e *GCSEnhancer) IsPublic(ctx context.Context, name string) (bool, error) {
+	bucket := e.bucket(e.bucketName)
+
+	battrs, err := bucket.Attrs(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	if battrs.UniformBucketLevelAccess.Enabled {
+		policy, err := bucket.IAMPolicy(ctx)
+
+		if err != nil {
+			return false, err
+		}
+
+		return policy.HasRole(iam.AllUsers, objectViewerRole), nil
+	}
+
+	rules, err := bucket.Object(name).ACL().List(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	return hasPublicRead(rules), nil
+}
+
+func hasPublicRead(rules []storage.ACLRule) bool {
+	for _, rule := range rules {
+		if rule.Entity == storage.AllUsers && (rule.Role == storage.RoleReader || rule.Role == storage.RoleOwner) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnsurePublic grants AllUsers read access to every object under prefix
+// lacking it, in parallel, and returns the number of objects fixed. Buckets
+// with uniform bucket-level access have no object ACLs and are rejected with
+// ErrUniformAccess, their objects are made public through the bucket IAM
+// policy instead.
+func (e *GCSEnhancer) EnsurePublic(ctx context.Context, prefix string) (int, error) {
+	bucket := e.bucket(e.bucketName)
+
+	battrs, err := bucket.Attrs(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if battrs.UniformBucketLevelAccess.Enabled {
+		return 0, fmt.Errorf("%w: %s", ErrUniformAccess, e.bucketName)
+	}
+
+	// The full projection lists the ACL of each object along with it.
+	it := bucket.Objects(ctx, &storage.Query{
+		Prefix:     prefix,
+		Projection: storage.ProjectionFull,
+	})
+
+	var private []string
+
+	for {
+		attr, err := it.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if !hasPublicRead(attr.ACL) {
+			private = append(private, attr.Name)
+		}
+	}
+
+	var fixed int64
+
+	err = e.runBounded(ctx, len(private), func(ctx context.Context, i int) error {
+		granted, err := e.makePublic(ctx, bucket.Object(private[i]))
+
+		if err != nil {
+			return err
+		}
+
+		if granted {
+			atomic.AddInt64(&fixed, 1)
+		}
+
+		return nil
+	})
+
+	return int(fixed), err
+}
@@ -0,0 +1,116 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestIsPublic(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "public.txt", []byte("x"), storage.ObjectAttrs{ACL: publicRead})
+	fake.Put("bucket", "private.txt", []byte("x"), storage.ObjectAttrs{})
+
+	for name, want := range map[string]bool{"public.txt": true, "private.txt": false} {
+		public, err := e.IsPublic(context.Background(), name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if public != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", name, public, want)
+		}
+	}
+}
+
+func TestIsPublicUniformAccess(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		fake := gcstest.New()
+		fake.SetBucketAttrs("bucket", storage.BucketAttrs{
+			UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+		})
+
+		policy := &iam.Policy{}
+
+		if want {
+			policy.Add(iam.AllUsers, "roles/storage.objectViewer")
+		}
+
+		fake.SetIAMPolicy("bucket", policy)
+		fake.Put("bucket", "a.txt", []byte("x"), storage.ObjectAttrs{})
+
+		e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+		public, err := e.IsPublic(context.Background(), "a.txt")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if public != want {
+			t.Errorf("IsPublic under uniform access = %v, want %v", public, want)
+		}
+
+		if n := len(fake.CallsTo(gcstest.OpListACL)); n != 0 {
+			t.Errorf("object ACL listed %d times under uniform access", n)
+		}
+	}
+}
+
+func TestEnsurePublic(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "assets/public.txt", []byte("x"), storage.ObjectAttrs{ACL: publicRead})
+	fake.Put("bucket", "assets/private1.txt", []byte("x"), storage.ObjectAttrs{})
+	fake.Put("bucket", "assets/sub/private2.txt", []byte("x"), storage.ObjectAttrs{})
+	fake.Put("bucket", "other/private.txt", []byte("x"), storage.ObjectAttrs{})
+
+	fixed, err := e.EnsurePublic(context.Background(), "assets/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fixed != 2 {
+		t.Errorf("fixed %d objects, want 2", fixed)
+	}
+
+	for _, c := range fake.CallsTo(gcstest.OpSetACL) {
+		if c.Object == "assets/public.txt" || c.Object == "other/private.txt" {
+			t.Errorf("ACL of %s set", c.Object)
+		}
+	}
+
+	for name, want := range map[string]bool{
+		"assets/public.txt":       true,
+		"assets/private1.txt":     true,
+		"assets/sub/private2.txt": true,
+		"other/private.txt":       false,
+	} {
+		if public, _ := e.IsPublic(context.Background(), name); public != want {
+			t.Errorf("IsPublic(%s) = %v, want %v", name, public, want)
+		}
+	}
+}
+
+func TestEnsurePublicUniformAccess(t *testing.T) {
+	fake := gcstest.New()
+	fake.SetBucketAttrs("bucket", storage.BucketAttrs{
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.EnsurePublic(context.Background(), ""); !errors.Is(err, gcsenhancer.ErrUniformAccess) {
+		t.Errorf("err = %v, want ErrUniformAccess", err)
+	}
+}
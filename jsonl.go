@@ -0,0 +1,110 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+const jsonlContentType = "application/x-ndjson"
+
+// JSONLAppender appends newline-delimited JSON records to an object. Objects
+// are immutable, so records are buffered, uploaded as a chunk object on
+// Flush and composed onto the end of the target object.
+//
+// Every flush adds a component to the composite target. GCS caps composite
+// objects at 1024 components, past which composing fails: rotate the target
+// well before that, e.g. one object per day or per batch job.
+type JSONLAppender struct {
+	e    *GCSEnhancer
+	name string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// NewJSONLAppender returns an appender of the object name. The object is
+// created by the first flush if it doesn't exist.
+func (e *GCSEnhancer) NewJSONLAppender(name string) *JSONLAppender {
+	return &JSONLAppender{
+		e:    e,
+		name: name,
+	}
+}
+
+// Append buffers the records, one JSON document per line.
+func (a *JSONLAppender) Append(records ...interface{}) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	enc := json.NewEncoder(&a.buf)
+
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Flush appends the buffered records to the object. The buffer is kept when
+// flushing fails, so it can be retried.
+func (a *JSONLAppender) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.buf.Len() == 0 {
+		return nil
+	}
+
+	bucket := a.e.bucket(a.e.bucketName)
+
+	// ------------------- upload the records as a chunk -------------------
+	chunkName := fmt.Sprintf("%s.chunk-%d", a.name, time.Now().UnixNano())
+
+	if _, err := a.e.stage(ctx, bytes.NewReader(a.buf.Bytes()), chunkName, UploadOptions{
+		ContentType: jsonlContentType,
+	}); err != nil {
+		return err
+	}
+
+	chunk := bucket.Object(chunkName)
+
+	defer chunk.Delete(ctx)
+
+	// ------------------- compose the chunk onto the target -------------------
+	target := bucket.Object(a.name)
+	srcs := []ObjectHandle{chunk}
+
+	// The preconditions make concurrent appenders fail rather than silently
+	// overwrite each other's records.
+	dst := target.If(storage.Conditions{DoesNotExist: true})
+
+	attr, err := target.Attrs(ctx)
+
+	switch {
+	case err == nil:
+		srcs = []ObjectHandle{target, chunk}
+		dst = target.If(storage.Conditions{GenerationMatch: attr.Generation})
+	case !errors.Is(err, storage.ErrObjectNotExist):
+		return err
+	}
+
+	composer := dst.ComposerFrom(srcs...)
+	composer.Settings().ContentType = jsonlContentType
+
+	if _, err := composer.Run(ctx); err != nil {
+		return err
+	}
+
+	a.buf.Reset()
+
+	return nil
+}
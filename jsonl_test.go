@@ -0,0 +1,91 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+type event struct {
+	N int `json:"n"`
+}
+
+func TestJSONLAppender(t *testing.T) {
+	ctx := context.Background()
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	a := e.NewJSONLAppender("logs/events.jsonl")
+
+	for _, batch := range [][]interface{}{{event{1}, event{2}}, {event{3}}, {event{4}, event{5}}} {
+		if err := a.Append(batch...); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := a.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing buffered, nothing to compose.
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := fake.Objects("bucket"); !reflect.DeepEqual(got, []string{"logs/events.jsonl"}) {
+		t.Errorf("objects = %v, want only the target, chunks deleted", got)
+	}
+
+	obj, _ := fake.Object("bucket", "logs/events.jsonl")
+
+	want := "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n{\"n\":4}\n{\"n\":5}\n"
+
+	if string(obj.Content) != want {
+		t.Errorf("content = %q, want %q", obj.Content, want)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpCompose)); n != 3 {
+		t.Errorf("%d composes, want one per flush", n)
+	}
+}
+
+func TestJSONLAppenderKeepsBufferOnFailure(t *testing.T) {
+	ctx := context.Background()
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpCompose {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	a := e.NewJSONLAppender("events.jsonl")
+
+	if err := a.Append(event{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Flush(ctx); !errors.Is(err, errDenied) {
+		t.Fatalf("err = %v, want the compose error", err)
+	}
+
+	fake.Intercept(nil)
+
+	if err := a.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, _ := fake.Object("bucket", "events.jsonl"); strings.TrimSpace(string(obj.Content)) != `{"n":1}` {
+		t.Errorf("content = %q, want the record retried", obj.Content)
+	}
+}
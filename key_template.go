@@ -0,0 +1,184 @@
+package gcsenhancer
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidKeyTemplate = errors.New("gcsenhancer: invalid key template")
+
+// keyPlaceholders are the placeholders a KeyTemplate can expand.
+var keyPlaceholders = map[string]bool{
+	"prefix": true,
+	"base":   true,
+	"ext":    true,
+	"yyyy":   true,
+	"mm":     true,
+	"dd":     true,
+	"uuid":   true,
+	"unix":   true,
+}
+
+// KeyTemplate generates object keys from a template like
+// "{prefix}/{yyyy}/{mm}/{uuid}{ext}". The placeholders expand to:
+//
+//	{prefix}  the directory of the input name, e.g. "avatars"
+//	{base}    the input name without directory and extension, e.g. "cat"
+//	{ext}     the extension of the input name, with its dot, e.g. ".png"
+//	{yyyy}    {mm} {dd} the date of the clock, see WithClock
+//	{uuid}    a random version 4 UUID
+//	{unix}    the unix time of the clock in seconds
+type KeyTemplate struct {
+	template string
+	parts    []keyPart
+}
+
+// keyPart is either a literal or a placeholder of a template.
+type keyPart struct {
+	literal     string
+	placeholder string
+}
+
+// ParseKeyTemplate parses and validates tmpl. Unknown placeholders and
+// unbalanced braces are rejected with ErrInvalidKeyTemplate.
+func ParseKeyTemplate(tmpl string) (*KeyTemplate, error) {
+	if tmpl == "" {
+		return nil, fmt.Errorf("%w: empty template", ErrInvalidKeyTemplate)
+	}
+
+	t := &KeyTemplate{template: tmpl}
+	rest := tmpl
+
+	for rest != "" {
+		open := strings.IndexAny(rest, "{}")
+
+		if open < 0 {
+			t.parts = append(t.parts, keyPart{literal: rest})
+
+			break
+		}
+
+		if rest[open] == '}' {
+			return nil, fmt.Errorf("%w: unexpected } in %q", ErrInvalidKeyTemplate, tmpl)
+		}
+
+		if open > 0 {
+			t.parts = append(t.parts, keyPart{literal: rest[:open]})
+		}
+
+		closing := strings.IndexAny(rest[open+1:], "{}")
+
+		if closing < 0 || rest[open+1+closing] != '}' {
+			return nil, fmt.Errorf("%w: unclosed { in %q", ErrInvalidKeyTemplate, tmpl)
+		}
+
+		name := rest[open+1 : open+1+closing]
+
+		if !keyPlaceholders[name] {
+			return nil, fmt.Errorf("%w: unknown placeholder {%s} in %q", ErrInvalidKeyTemplate, name, tmpl)
+		}
+
+		t.parts = append(t.parts, keyPart{placeholder: name})
+		rest = rest[open+2+closing:]
+	}
+
+	return t, nil
+}
+
+func (t *KeyTemplate) String() string {
+	return t.template
+}
+
+// expand expands the template with vars. Empty segments, e.g. of an empty
+// {prefix}, are dropped so no key starts with or contains "//".
+func (t *KeyTemplate) expand(vars map[string]string) string {
+	var b strings.Builder
+
+	for _, part := range t.parts {
+		if part.placeholder != "" {
+			b.WriteString(vars[part.placeholder])
+		} else {
+			b.WriteString(part.literal)
+		}
+	}
+
+	segs := strings.Split(b.String(), "/")
+	key := segs[:0]
+
+	for _, seg := range segs {
+		if seg != "" {
+			key = append(key, seg)
+		}
+	}
+
+	return strings.Join(key, "/")
+}
+
+// WithKeyTemplate makes UploadImages generate the keys of the originals with
+// t, see ParseKeyTemplate. The thumbnail is stored next to its original, with
+// "<sep>thumbnail" inserted before the extension, e.g. "2022/05/<uuid>.png"
+// and "2022/05/<uuid>_thumbnail.png". Templates take precedence over
+// WithStableKeys and WithSequentialKeys.
+func WithKeyTemplate(t *KeyTemplate) Option {
+	return func(e *GCSEnhancer) {
+		e.keyTemplate = t
+	}
+}
+
+// templateKeys generates the keys of the original and the thumbnail of name
+// with the key template.
+func (e *GCSEnhancer) templateKeys(name string) (string, string, error) {
+	ext := path.Ext(name)
+	now := e.now()
+
+	dir := path.Dir(name)
+
+	if dir == "." {
+		dir = ""
+	}
+
+	uuid, err := newUUID()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	vars := map[string]string{
+		"prefix": dir,
+		"base":   strings.TrimSuffix(path.Base(name), ext),
+		"ext":    ext,
+		"yyyy":   now.Format("2006"),
+		"mm":     now.Format("01"),
+		"dd":     now.Format("02"),
+		"uuid":   uuid,
+		"unix":   strconv.FormatInt(now.Unix(), 10),
+	}
+
+	orig := e.keyTemplate.expand(vars)
+
+	if e.lowercaseKeys {
+		orig = strings.ToLower(orig)
+	}
+
+	thumbExt := path.Ext(orig)
+
+	return orig, fmt.Sprintf("%s%sthumbnail%s", strings.TrimSuffix(orig, thumbExt), e.keySeparator, thumbExt), nil
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
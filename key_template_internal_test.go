@@ -0,0 +1,61 @@
+package gcsenhancer
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestKeyTemplateExpand(t *testing.T) {
+	const uuid = `[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`
+
+	for _, tc := range []struct {
+		tmpl  string
+		name  string
+		orig  string
+		thumb string
+	}{
+		{"{prefix}/{yyyy}/{mm}/{dd}/{base}{ext}", "avatars/cat.png", "avatars/2022/05/01/cat.png", "avatars/2022/05/01/cat_thumbnail.png"},
+		{"{prefix}/{yyyy}/{base}{ext}", "cat.png", "2022/cat.png", "2022/cat_thumbnail.png"},
+		{"{base}-{unix}{ext}", "a/b/photo.jpg", "photo-1651406400.jpg", "photo-1651406400_thumbnail.jpg"},
+		{"images/{uuid}{ext}", "cat.png", "images/" + uuid + `\.png`, "images/" + uuid + `_thumbnail\.png`},
+		{"{base}", "noext", "noext", "noext_thumbnail"},
+	} {
+		tmpl, err := ParseKeyTemplate(tc.tmpl)
+
+		if err != nil {
+			t.Fatalf("%s: %v", tc.tmpl, err)
+		}
+
+		e := NewWithStorage(nil, "bucket", WithClock(fixedClock), WithKeyTemplate(tmpl))
+
+		orig, thumb, err := e.templateKeys(tc.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !regexp.MustCompile("^" + tc.orig + "$").MatchString(orig) {
+			t.Errorf("%s of %s: original = %q, want %q", tc.tmpl, tc.name, orig, tc.orig)
+		}
+
+		if !regexp.MustCompile("^" + tc.thumb + "$").MatchString(thumb) {
+			t.Errorf("%s of %s: thumbnail = %q, want %q", tc.tmpl, tc.name, thumb, tc.thumb)
+		}
+	}
+}
+
+func TestParseKeyTemplateInvalid(t *testing.T) {
+	for _, tmpl := range []string{
+		"",
+		"{base",
+		"base}",
+		"{base{ext}}",
+		"{hour}/{base}{ext}",
+		"{}",
+	} {
+		if _, err := ParseKeyTemplate(tmpl); !errors.Is(err, ErrInvalidKeyTemplate) {
+			t.Errorf("ParseKeyTemplate(%q) err = %v, want ErrInvalidKeyTemplate", tmpl, err)
+		}
+	}
+}
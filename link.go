@@ -0,0 +1,63 @@
+package gcsenhancer
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+)
+
+// WithCacheBusting appends the object generation, e.g. "?v=1652345678901234",
+// to the returned links. Overwriting an object changes its generation, thus
+// its link, so CDNs don't keep serving the stale content.
+func WithCacheBusting() Option {
+	return func(e *GCSEnhancer) {
+		e.cacheBusting = true
+	}
+}
+
+// WithPublic sets whether the enhancer serves public objects, which is the
+// default. A private enhancer never grants public access, regardless of
+// UploadOptions.PublicAccess, and returns signed links valid for
+// DefaultSignedURLExpiry instead of public ones.
+//
+// New deployments are encouraged to use WithPublic(false) and opt in to
+// public access only for buckets meant to be public.
+func WithPublic(public bool) Option {
+	return func(e *GCSEnhancer) {
+		e.public = public
+	}
+}
+
+// objectLink is ObjectLinkWithHost honoring the link options of the enhancer.
+func (e *GCSEnhancer) objectLink(attr *storage.ObjectAttrs, host string) *UploadedFileInfo {
+	u := hostURL(attr, host)
+
+	if e.cacheBusting && attr.Generation != 0 {
+		u.RawQuery = url.Values{
+			"v": []string{strconv.FormatInt(attr.Generation, 10)},
+		}.Encode()
+	}
+
+	link := u.String()
+
+	if !e.public {
+		signed, err := e.signedDownloadURL(attr.Bucket, attr.Name, DefaultSignedURLExpiry, ResponseOverrides{})
+
+		if err != nil {
+			log.Printf("gcsenhancer: failed to sign link of private object %s, the link requires authentication: %v", attr.Name, err)
+		} else {
+			link = signed
+		}
+	}
+
+	return uploadedFileInfo(attr, link)
+}
+
+// GSURI returns the gs://bucket/object URI of objectName, the form consumed
+// by BigQuery, Dataflow and gsutil. The name is not escaped, slashes included.
+func (e *GCSEnhancer) GSURI(objectName string) string {
+	return fmt.Sprintf("gs://%s/%s", e.bucketName, objectName)
+}
@@ -0,0 +1,172 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestCacheBustingLinks(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithCacheBusting())
+	ctx := context.Background()
+
+	first, err := e.Upload(ctx, strings.NewReader("v1"), "site.css", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "site.css")
+
+	if want := "?v=" + strconv.FormatInt(obj.Attrs.Generation, 10); !strings.HasSuffix(first.PublicLink, want) {
+		t.Errorf("link = %s, want it to end with %s", first.PublicLink, want)
+	}
+
+	second, err := e.Upload(ctx, strings.NewReader("v2"), "site.css", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.PublicLink == first.PublicLink {
+		t.Error("overwriting the object kept its link")
+	}
+}
+
+func TestLinksWithoutCacheBusting(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	info, err := e.Upload(context.Background(), strings.NewReader("v1"), "site.css", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.PublicLink != "https://storage.googleapis.com/bucket/site.css" {
+		t.Errorf("link = %s, want the plain public link", info.PublicLink)
+	}
+}
+
+func TestPublicAndPrivateModes(t *testing.T) {
+	for _, public := range []bool{true, false} {
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithPublic(public))
+
+		info, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{PublicAccess: true})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", "a.txt")
+		signed := strings.Contains(info.PublicLink, "X-Goog-Signature")
+
+		if public {
+			if len(obj.Attrs.ACL) != 1 || signed {
+				t.Errorf("public: ACL %v, link %s, want AllUsers and a plain link", obj.Attrs.ACL, info.PublicLink)
+			}
+
+			continue
+		}
+
+		if len(obj.Attrs.ACL) != 0 || len(fake.CallsTo(gcstest.OpSetACL)) != 0 {
+			t.Errorf("private: ACL %v set, want none", obj.Attrs.ACL)
+		}
+
+		if !signed {
+			t.Errorf("private: link %s, want a signed one", info.PublicLink)
+		}
+	}
+}
+
+func TestUploadReturnsETagAndMD5(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	info, err := e.Upload(context.Background(), strings.NewReader("hello"), "a.txt", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+
+	if info.ETag == "" || info.ETag != obj.Attrs.Etag {
+		t.Errorf("ETag = %q, want the stored %q", info.ETag, obj.Attrs.Etag)
+	}
+
+	// The MD5 of "hello".
+	if info.MD5 != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("MD5 = %q", info.MD5)
+	}
+}
+
+func TestGSURI(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "my-bucket")
+
+	for name, want := range map[string]string{
+		"a.txt":                      "gs://my-bucket/a.txt",
+		"exports/2022/05/data.csv":   "gs://my-bucket/exports/2022/05/data.csv",
+		"reports/q1 summary (1).pdf": "gs://my-bucket/reports/q1 summary (1).pdf",
+	} {
+		if got := e.GSURI(name); got != want {
+			t.Errorf("GSURI(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestPerCallHost(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name string
+		host string
+		want string
+	}{
+		{"img/a.png", "cdn.example.com", "https://cdn.example.com/img/a.png"},
+		{"img/b.png", "", "https://storage.googleapis.com/bucket/img/b.png"},
+	} {
+		info, err := e.Upload(ctx, strings.NewReader("x"), tt.name, gcsenhancer.UploadOptions{PublicAccess: true, Host: tt.host})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.PublicLink != tt.want {
+			t.Errorf("host %q: link = %s, want %s", tt.host, info.PublicLink, tt.want)
+		}
+	}
+
+	private := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithPublic(false))
+
+	info, err := private.Upload(ctx, strings.NewReader("x"), "img/c.png", gcsenhancer.UploadOptions{Host: "cdn.example.com"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(info.PublicLink, "https://storage.googleapis.com/bucket/img/c.png?") {
+		t.Errorf("private link = %s, want a signed GCS link", info.PublicLink)
+	}
+}
+
+func TestObjectLinkWithHost(t *testing.T) {
+	attr := &storage.ObjectAttrs{Bucket: "bucket", Name: "img/a b.png"}
+
+	for host, want := range map[string]string{
+		"":                "https://storage.googleapis.com/bucket/img/a%20b.png",
+		"cdn.example.com": "https://cdn.example.com/img/a%20b.png",
+	} {
+		if got := gcsenhancer.ObjectLinkWithHost(attr, host).PublicLink; got != want {
+			t.Errorf("host %q: link = %s, want %s", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gcsenhancer
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// List lists the objects under prefix recursively. Soft deleted objects are
+// left out unless includeDeleted is set.
+func (e *GCSEnhancer) List(ctx context.Context, prefix string, includeDeleted bool) ([]*storage.ObjectAttrs, error) {
+	return e.list(ctx, &storage.Query{Prefix: prefix}, includeDeleted)
+}
+
+// list lists the objects matching q, see List.
+func (e *GCSEnhancer) list(ctx context.Context, q *storage.Query, includeDeleted bool) ([]*storage.ObjectAttrs, error) {
+	it := e.bucket(e.bucketName).Objects(ctx, q)
+
+	var objects []*storage.ObjectAttrs
+
+	for {
+		attr, err := it.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !includeDeleted && isSoftDeleted(attr) {
+			continue
+		}
+
+		objects = append(objects, attr)
+	}
+
+	return objects, nil
+}
+
+// ListFolders lists a single level of the bucket under prefix, like a file
+// browser does. Objects right under prefix are returned as objects, deeper
+// ones are rolled up into their "folder", e.g. "photos/2022/", in prefixes.
+// Soft deleted objects are left out.
+func (e *GCSEnhancer) ListFolders(ctx context.Context, prefix string) (objects []*storage.ObjectAttrs, prefixes []string, err error) {
+	it := e.bucket(e.bucketName).Objects(ctx, &storage.Query{
+		Prefix:    prefix,
+		Delimiter: "/",
+	})
+
+	for {
+		attr, err := it.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if attr.Prefix != "" {
+			prefixes = append(prefixes, attr.Prefix)
+
+			continue
+		}
+
+		if isSoftDeleted(attr) {
+			continue
+		}
+
+		objects = append(objects, attr)
+	}
+
+	return objects, prefixes, nil
+}
+
+// ListModifiedSince lists the objects under prefix updated after since, e.g.
+// the time of the previous incremental sync. GCS can't filter by time, every
+// object under prefix is listed and filtered client side. Soft deleted
+// objects are left out.
+func (e *GCSEnhancer) ListModifiedSince(ctx context.Context, prefix string, since time.Time) ([]*storage.ObjectAttrs, error) {
+	objects, err := e.List(ctx, prefix, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	modified := objects[:0]
+
+	for _, attr := range objects {
+		if attr.Updated.After(since) {
+			modified = append(modified, attr)
+		}
+	}
+
+	return modified, nil
+}
@@ -0,0 +1,95 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestListFolders(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	for _, name := range []string{
+		"readme.txt",
+		"photos/a.png",
+		"photos/b.png",
+		"photos/2021/c.png",
+		"photos/2022/d.png",
+		"photos/2022/raw/e.png",
+		"videos/f.mp4",
+	} {
+		fake.Put("bucket", name, []byte("x"), storage.ObjectAttrs{})
+	}
+
+	for _, tt := range []struct {
+		prefix   string
+		objects  []string
+		prefixes []string
+	}{
+		{"", []string{"readme.txt"}, []string{"photos/", "videos/"}},
+		{"photos/", []string{"photos/a.png", "photos/b.png"}, []string{"photos/2021/", "photos/2022/"}},
+		{"photos/2022/", []string{"photos/2022/d.png"}, []string{"photos/2022/raw/"}},
+		{"missing/", nil, nil},
+	} {
+		objects, prefixes, err := e.ListFolders(context.Background(), tt.prefix)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+
+		for _, obj := range objects {
+			names = append(names, obj.Name)
+		}
+
+		if !reflect.DeepEqual(names, tt.objects) {
+			t.Errorf("ListFolders(%q) objects = %v, want %v", tt.prefix, names, tt.objects)
+		}
+
+		if !reflect.DeepEqual(prefixes, tt.prefixes) {
+			t.Errorf("ListFolders(%q) prefixes = %v, want %v", tt.prefix, prefixes, tt.prefixes)
+		}
+	}
+}
+
+func TestListModifiedSince(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	base := fixedClock()
+
+	for name, offset := range map[string]time.Duration{
+		"sync/old.txt":  -time.Hour,
+		"sync/at.txt":   0,
+		"sync/new.txt":  time.Hour,
+		"sync/new2.txt": 2 * time.Hour,
+		"other/new.txt": time.Hour,
+	} {
+		updated := base.Add(offset)
+
+		fake.SetClock(func() time.Time { return updated })
+		fake.Put("bucket", name, []byte("x"), storage.ObjectAttrs{})
+	}
+
+	objects, err := e.ListModifiedSince(context.Background(), "sync/", base)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, attr := range objects {
+		names = append(names, attr.Name)
+	}
+
+	if want := []string{"sync/new.txt", "sync/new2.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("modified = %v, want %v", names, want)
+	}
+}
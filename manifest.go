@@ -0,0 +1,62 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Manifest describes a set of uploaded objects, e.g. the result of a batch.
+type Manifest struct {
+	Bucket      string     `json:"bucket"`
+	GeneratedAt time.Time  `json:"generated_at"`
+	Objects     []FileInfo `json:"objects"`
+}
+
+// Manifest stats the named objects and describes them, in order, in a
+// manifest. When manifestName is not empty, e.g. "exports/42/manifest.json",
+// the manifest is also uploaded there as JSON.
+func (e *GCSEnhancer) Manifest(ctx context.Context, names []string, manifestName string) (*Manifest, error) {
+	objects := make([]FileInfo, len(names))
+
+	err := e.runBounded(ctx, len(names), func(ctx context.Context, i int) error {
+		info, err := e.Stat(ctx, names[i])
+
+		if err != nil {
+			return err
+		}
+
+		objects[i] = info
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Bucket:      e.bucketName,
+		GeneratedAt: time.Now().UTC(),
+		Objects:     objects,
+	}
+
+	if manifestName == "" {
+		return m, nil
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := e.Upload(ctx, bytes.NewReader(b), manifestName, UploadOptions{
+		ContentType: "application/json",
+	}); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
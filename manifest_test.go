@@ -0,0 +1,83 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestManifest(t *testing.T) {
+	ctx := context.Background()
+	fake := gcstest.New()
+	fake.SetClock(fixedClock)
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	names := []string{"b.json", "a.txt"}
+
+	for _, name := range names {
+		if _, err := e.Upload(ctx, strings.NewReader("content of "+name), name, gcsenhancer.UploadOptions{ContentTypeFromExt: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := e.Manifest(ctx, names, "exports/manifest.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Bucket != "bucket" || len(m.Objects) != len(names) {
+		t.Fatalf("manifest of %s lists %d objects, want %d of bucket", m.Bucket, len(m.Objects), len(names))
+	}
+
+	for i, name := range names {
+		want, err := e.Stat(ctx, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := m.Objects[i]; got != want {
+			t.Errorf("object %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	obj, ok := fake.Object("bucket", "exports/manifest.json")
+
+	if !ok {
+		t.Fatal("manifest not uploaded")
+	}
+
+	if obj.Attrs.ContentType != "application/json" {
+		t.Errorf("manifest stored as %s", obj.Attrs.ContentType)
+	}
+
+	var uploaded gcsenhancer.Manifest
+
+	if err := json.Unmarshal(obj.Content, &uploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(uploaded.Objects, m.Objects) || !uploaded.GeneratedAt.Equal(m.GeneratedAt) {
+		t.Errorf("uploaded manifest %+v, want %+v", uploaded, *m)
+	}
+}
+
+func TestManifestMissingObject(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.Manifest(context.Background(), []string{"missing.txt"}, "manifest.json"); err == nil {
+		t.Fatal("manifest of a missing object succeeded")
+	}
+
+	if _, ok := fake.Object("bucket", "manifest.json"); ok {
+		t.Error("manifest uploaded despite the failure")
+	}
+}
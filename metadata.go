@@ -0,0 +1,69 @@
+package gcsenhancer
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+)
+
+// UpdateMetadata updates the attributes of an existing object without
+// re-uploading it. Setting a key of update.Metadata to "" removes the key.
+//
+// GCS merges metadata on update, so removing keys takes two calls: the
+// metadata is cleared, guarded by a metageneration precondition, then the
+// remaining keys are written back along with the other attributes, guarded
+// by the metageneration of the clear so concurrent updates aren't lost.
+// Should the second call fail, the object is left without any metadata and
+// the error is returned; the caller has to write the metadata back.
+func (e *GCSEnhancer) UpdateMetadata(ctx context.Context, name string, update storage.ObjectAttrsToUpdate) (*storage.ObjectAttrs, error) {
+	object := e.bucket(e.bucketName).Object(name)
+
+	if hasEmptyValue(update.Metadata) {
+		attr, err := object.Attrs(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		merged := make(map[string]string)
+
+		for k, v := range attr.Metadata {
+			merged[k] = v
+		}
+
+		for k, v := range update.Metadata {
+			if v == "" {
+				delete(merged, k)
+
+				continue
+			}
+
+			merged[k] = v
+		}
+
+		cleared, err := object.
+			If(storage.Conditions{MetagenerationMatch: attr.Metageneration}).
+			Update(ctx, storage.ObjectAttrsToUpdate{
+				Metadata: map[string]string{},
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		update.Metadata = merged
+		object = object.If(storage.Conditions{MetagenerationMatch: cleared.Metageneration})
+	}
+
+	return object.Update(ctx, update)
+}
+
+func hasEmptyValue(m map[string]string) bool {
+	for _, v := range m {
+		if v == "" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+func TestUpdateMetadata(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("a"), storage.ObjectAttrs{
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"owner": "42", "stale": "1"},
+	})
+
+	attr, err := e.UpdateMetadata(context.Background(), "a.txt", storage.ObjectAttrsToUpdate{
+		CacheControl: "public, max-age=3600",
+		Metadata:     map[string]string{"stale": "", "reviewed": "yes"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attr.CacheControl != "public, max-age=3600" {
+		t.Errorf("cache control = %q", attr.CacheControl)
+	}
+
+	want := map[string]string{"owner": "42", "reviewed": "yes"}
+
+	if len(attr.Metadata) != len(want) || attr.Metadata["owner"] != "42" || attr.Metadata["reviewed"] != "yes" {
+		t.Errorf("metadata = %v, want %v", attr.Metadata, want)
+	}
+
+	updates := fake.CallsTo(gcstest.OpUpdate)
+
+	if len(updates) != 2 {
+		t.Fatalf("%d updates, want 2", len(updates))
+	}
+
+	for i, c := range updates {
+		if c.Conditions == nil || c.Conditions.MetagenerationMatch == 0 {
+			t.Errorf("update %d not guarded by the metageneration", i)
+		}
+	}
+}
+
+func TestUpdateMetadataConcurrentUpdate(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("a"), storage.ObjectAttrs{
+		Metadata: map[string]string{"stale": "1"},
+	})
+
+	updates := 0
+
+	// Another writer updates the object between the two calls.
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpUpdate {
+			return nil
+		}
+
+		if updates++; updates == 2 {
+			_, err := fake.Bucket("bucket").Object("a.txt").Update(context.Background(), storage.ObjectAttrsToUpdate{
+				ContentLanguage: "en",
+			})
+
+			return err
+		}
+
+		return nil
+	})
+
+	_, err := e.UpdateMetadata(context.Background(), "a.txt", storage.ObjectAttrsToUpdate{
+		Metadata: map[string]string{"stale": ""},
+	})
+
+	var apiErr *googleapi.Error
+
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusPreconditionFailed {
+		t.Fatalf("err = %v, want a failed precondition", err)
+	}
+
+	if obj, _ := fake.Object("bucket", "a.txt"); obj.Attrs.ContentLanguage != "en" {
+		t.Errorf("concurrent update lost, content language %q", obj.Attrs.ContentLanguage)
+	}
+}
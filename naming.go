@@ -0,0 +1,196 @@
+package gcsenhancer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrEmptyObjectName = errors.New("gcsenhancer: empty object name")
+
+const (
+	timestampLayout     = "20060102150405"
+	defaultKeySeparator = "_"
+)
+
+// WithKeySeparator sets the separator placed between the filename and the
+// stamps appended to generated object keys. Defaults to "_".
+func WithKeySeparator(sep string) Option {
+	return func(e *GCSEnhancer) {
+		e.keySeparator = sep
+	}
+}
+
+// WithLowercaseKeys lowercases the generated object keys.
+func WithLowercaseKeys() Option {
+	return func(e *GCSEnhancer) {
+		e.lowercaseKeys = true
+	}
+}
+
+func appendStamp(filename, stamp, sep string) string {
+	secs := strings.Split(filename, ".")
+
+	return fmt.Sprintf("%s%s%s.%s", secs[0], sep, stamp, secs[len(secs)-1])
+}
+
+// WithStableKeys disables the stamping of image keys: the original is stored
+// under the given name as is, and the thumbnail next to it, e.g.
+// "avatars/42.png" and "avatars/42_thumbnail.png". Uploading the same name
+// again overwrites the objects in place, so links never change.
+//
+// Overwritten objects keep their link, CDNs and browsers may serve the stale
+// content until their cache expires. Consider WithCacheBusting.
+func WithStableKeys() Option {
+	return func(e *GCSEnhancer) {
+		e.stableKeys = true
+	}
+}
+
+// WithClock sets the clock the generated keys are stamped with. Defaults to
+// time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(e *GCSEnhancer) {
+		e.now = now
+	}
+}
+
+// WithSequentialKeys appends the position of each image within its batch,
+// e.g. "cat_20220102150405_0001.png", to the keys generated by UploadImages.
+// Images of the same batch stamped within the same second never collide.
+func WithSequentialKeys() Option {
+	return func(e *GCSEnhancer) {
+		e.sequentialKeys = true
+	}
+}
+
+// imageKeys generates the object keys of the original and the thumbnail of
+// name, e.g. "cat_20220102150405.png" and "cat_thumbnail_20220102150405.png".
+// seq is the 1-based position of the image in its batch.
+func (e *GCSEnhancer) imageKeys(name string, seq int) (string, string, error) {
+	if e.keyTemplate != nil {
+		return e.templateKeys(name)
+	}
+
+	if e.stableKeys {
+		ext := filepath.Ext(name)
+
+		return name, fmt.Sprintf("%s%sthumbnail%s", strings.TrimSuffix(name, ext), e.keySeparator, ext), nil
+	}
+
+	filename := filepath.Base(name)
+	stamp := e.now().Format(timestampLayout)
+
+	if e.sequentialKeys {
+		stamp = fmt.Sprintf("%s%s%04d", stamp, e.keySeparator, seq)
+	}
+
+	return e.stampedKey(filename, "", stamp), e.stampedKey(filename, "thumbnail", stamp), nil
+}
+
+// stampedKey appends the variant, if any, and the stamp to filename.
+func (e *GCSEnhancer) stampedKey(filename, variant, stamp string) string {
+	if variant != "" {
+		filename = appendStamp(filename, variant, e.keySeparator)
+	}
+
+	key := appendStamp(filename, stamp, e.keySeparator)
+
+	if e.lowercaseKeys {
+		key = strings.ToLower(key)
+	}
+
+	return key
+}
+
+// thumbnailKey derives the key of the thumbnail generated alongside the
+// original stored under key, reversing the stamping of imageKeys. ok is false
+// when key was not generated by the key options of the enhancer.
+func (e *GCSEnhancer) thumbnailKey(key string) (string, bool) {
+	ext := filepath.Ext(key)
+	stem := strings.TrimSuffix(key, ext)
+
+	if e.keyTemplate != nil || e.stableKeys {
+		return fmt.Sprintf("%s%sthumbnail%s", stem, e.keySeparator, ext), true
+	}
+
+	stampLen := len(timestampLayout)
+
+	if e.sequentialKeys {
+		stampLen += len(e.keySeparator) + 4
+	}
+
+	if len(stem) < stampLen+len(e.keySeparator) {
+		return "", false
+	}
+
+	prefix, stamp := stem[:len(stem)-stampLen], stem[len(stem)-stampLen:]
+
+	if !strings.HasSuffix(prefix, e.keySeparator) || !isDigits(stamp[:len(timestampLayout)]) {
+		return "", false
+	}
+
+	return fmt.Sprintf("%sthumbnail%s%s%s", prefix, e.keySeparator, stamp, ext), true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// WithGeneratedNames makes uploads given an empty name store the file under a
+// random name, e.g. "3f2a...9c.png", rather than failing with
+// ErrEmptyObjectName. The extension is derived from the content type, if any.
+// The generated name is returned in UploadedFileInfo.Filename.
+func WithGeneratedNames() Option {
+	return func(e *GCSEnhancer) {
+		e.generateNames = true
+	}
+}
+
+// objectName validates the name of an upload, generating one if allowed.
+func (e *GCSEnhancer) objectName(name, contentType string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+
+	if !e.generateNames {
+		return "", ErrEmptyObjectName
+	}
+
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	name = hex.EncodeToString(b)
+
+	if contentType == "" || contentType == DefaultContentType {
+		return name, nil
+	}
+
+	// The extensions of the supported formats are fixed, the first of the
+	// mime package depends on the system, e.g. ".jfif" for JPEG.
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if ext, ok := formatExts[mediaType]; ok {
+			return name + "." + ext, nil
+		}
+	}
+
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		name += exts[0]
+	}
+
+	return name, nil
+}
@@ -0,0 +1,105 @@
+package gcsenhancer
+
+import (
+	"testing"
+	"time"
+)
+
+func fixedClock() time.Time {
+	return time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func TestImageKeysSeparatorAndCasing(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		sep       string
+		lowercase bool
+		orig      string
+		thumb     string
+	}{
+		{"Cat.png", "", false, "Cat_20220501120000.png", "Cat_thumbnail_20220501120000.png"},
+		{"Cat.png", "-", false, "Cat-20220501120000.png", "Cat-thumbnail-20220501120000.png"},
+		{"Cat.png", "", true, "cat_20220501120000.png", "cat_thumbnail_20220501120000.png"},
+		{"Cat.PNG", "-", true, "cat-20220501120000.png", "cat-thumbnail-20220501120000.png"},
+		{"Photos/My_Cat.jpg", "-", true, "my_cat-20220501120000.jpg", "my_cat-thumbnail-20220501120000.jpg"},
+		{"cat.png", "__", false, "cat__20220501120000.png", "cat__thumbnail__20220501120000.png"},
+	} {
+		opts := []Option{WithClock(fixedClock)}
+
+		if tc.sep != "" {
+			opts = append(opts, WithKeySeparator(tc.sep))
+		}
+
+		if tc.lowercase {
+			opts = append(opts, WithLowercaseKeys())
+		}
+
+		e := NewWithStorage(nil, "bucket", opts...)
+
+		orig, thumb, err := e.imageKeys(tc.name, 1)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if orig != tc.orig || thumb != tc.thumb {
+			t.Errorf("keys of %s with %q, lowercase %v: %s %s, want %s %s", tc.name, tc.sep, tc.lowercase, orig, thumb, tc.orig, tc.thumb)
+		}
+	}
+}
+
+func TestAppendUnixTimeStampToFilenameKeepsDefaults(t *testing.T) {
+	key := AppendUnixTimeStampToFilename("Cat.png")
+
+	if len(key) != len("Cat_20220501120000.png") || key[:4] != "Cat_" || key[len(key)-4:] != ".png" {
+		t.Errorf("key = %s, want Cat_<stamp>.png", key)
+	}
+}
+
+func TestThumbnailKeyReversesImageKeys(t *testing.T) {
+	tmpl, err := ParseKeyTemplate("{yyyy}/{mm}/{base}{ext}")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		opts []Option
+	}{
+		{"default", nil},
+		{"separator", []Option{WithKeySeparator("-")}},
+		{"long separator", []Option{WithKeySeparator("__")}},
+		{"lowercase", []Option{WithLowercaseKeys()}},
+		{"sequential", []Option{WithSequentialKeys()}},
+		{"sequential with separator", []Option{WithSequentialKeys(), WithKeySeparator("-")}},
+		{"stable", []Option{WithStableKeys()}},
+		{"template", []Option{WithKeyTemplate(tmpl)}},
+	} {
+		e := NewWithStorage(nil, "bucket", append(tc.opts, WithClock(fixedClock))...)
+
+		for _, name := range []string{"cat.png", "My_Cat_2.jpg", "avatars/42.webp", "noext"} {
+			orig, thumb, err := e.imageKeys(name, 3)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := e.thumbnailKey(orig)
+
+			if !ok || got != thumb {
+				t.Errorf("%s: thumbnailKey(%s) = %s, %v, want %s", tc.desc, orig, got, ok, thumb)
+			}
+		}
+	}
+}
+
+func TestThumbnailKeyRejectsForeignKeys(t *testing.T) {
+	e := NewWithStorage(nil, "bucket")
+
+	for _, key := range []string{"cat.png", "cat_2022.png", "cat_2022050112000x.png", "20220501120000.png"} {
+		if thumb, ok := e.thumbnailKey(key); ok {
+			t.Errorf("thumbnailKey(%s) = %s, want no pairing", key, thumb)
+		}
+	}
+}
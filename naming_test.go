@@ -0,0 +1,134 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestStableKeysOverwriteInPlace(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys())
+
+	for _, width := range []int{10, 20} {
+		imgs := pngImages("avatars/42.png")
+		imgs[0].OrigImage = image.NewRGBA(image.Rect(0, 0, width, width))
+
+		if _, err := e.UploadImages(context.Background(), imgs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := fake.Objects("bucket"), []string{"avatars/42.png", "avatars/42_thumbnail.png"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored %v, want %v", got, want)
+	}
+
+	obj, _ := fake.Object("bucket", "avatars/42.png")
+	cfg, err := png.DecodeConfig(bytes.NewReader(obj.Content))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Width != 20 {
+		t.Errorf("original is %dpx wide, want the latest 20px upload", cfg.Width)
+	}
+}
+
+func TestSequentialKeys(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithClock(fixedClock), gcsenhancer.WithSequentialKeys())
+
+	links, err := e.UploadImages(context.Background(), pngImages("cat.png", "cat.png", "cat.png", "cat.png", "cat.png"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var originals []string
+
+	for _, name := range fake.Objects("bucket") {
+		if !strings.Contains(name, "thumbnail") {
+			originals = append(originals, name)
+		}
+	}
+
+	want := []string{
+		"cat_20220501120000_0001.png",
+		"cat_20220501120000_0002.png",
+		"cat_20220501120000_0003.png",
+		"cat_20220501120000_0004.png",
+		"cat_20220501120000_0005.png",
+	}
+
+	if !reflect.DeepEqual(originals, want) {
+		t.Errorf("originals = %v, want %v", originals, want)
+	}
+
+	if len(links.Original) != 5 || len(links.Thumbnails) != 5 {
+		t.Errorf("%d originals and %d thumbnails linked, want 5 each", len(links.Original), len(links.Thumbnails))
+	}
+}
+
+func TestEmptyObjectName(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "", gcsenhancer.UploadOptions{}); !errors.Is(err, gcsenhancer.ErrEmptyObjectName) {
+		t.Errorf("err = %v, want ErrEmptyObjectName", err)
+	}
+
+	if n := len(fake.Calls()); n != 0 {
+		t.Errorf("%d calls made for an empty name, want none", n)
+	}
+}
+
+func TestGeneratedNames(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithGeneratedNames())
+
+	seen := make(map[string]bool)
+
+	for _, tt := range []struct {
+		contentType string
+		ext         string
+	}{
+		{"image/png", ".png"},
+		{"image/png", ".png"},
+		{"image/jpeg", ".jpg"},
+		{"image/webp", ".webp"},
+		{"image/gif; charset=binary", ".gif"},
+		{"", ""},
+	} {
+		info, err := e.Upload(context.Background(), strings.NewReader("x"), "", gcsenhancer.UploadOptions{ContentType: tt.contentType})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := info.Filename
+
+		if name == "" || seen[name] {
+			t.Errorf("generated name %q, want a fresh one", name)
+		}
+
+		seen[name] = true
+
+		if filepath.Ext(name) != tt.ext {
+			t.Errorf("generated %s for %q, want extension %q", name, tt.contentType, tt.ext)
+		}
+
+		if _, ok := fake.Object("bucket", name); !ok {
+			t.Errorf("%s not stored", name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gcsenhancer
+
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// UploadOption sets a field of the UploadOptions of a single call to Upload,
+// on top of the UploadOptions passed along. Options are applied in order, a
+// later option overrides an earlier one.
+type UploadOption func(*UploadOptions)
+
+// apply returns a copy of o with extra applied, leaving the maps of the
+// caller untouched.
+func (o UploadOptions) apply(extra []UploadOption) UploadOptions {
+	if len(extra) == 0 {
+		return o
+	}
+
+	if o.Metadata != nil {
+		metadata := make(map[string]string, len(o.Metadata))
+
+		for k, v := range o.Metadata {
+			metadata[k] = v
+		}
+
+		o.Metadata = metadata
+	}
+
+	for _, opt := range extra {
+		opt(&o)
+	}
+
+	return o
+}
+
+// UploadContentType sets the content type of the object.
+func UploadContentType(contentType string) UploadOption {
+	return func(o *UploadOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// UploadMetadata adds a custom metadata entry to the object.
+func UploadMetadata(key, value string) UploadOption {
+	return func(o *UploadOptions) {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string)
+		}
+
+		o.Metadata[key] = value
+	}
+}
+
+// UploadConditions sets the preconditions of the write.
+func UploadConditions(conds storage.Conditions) UploadOption {
+	return func(o *UploadOptions) {
+		o.Conditions = &conds
+	}
+}
+
+// UploadACL applies a predefined ACL, e.g. PredefinedACLPublicRead, with the
+// write.
+func UploadACL(predefinedACL string) UploadOption {
+	return func(o *UploadOptions) {
+		o.PredefinedACL = predefinedACL
+	}
+}
+
+// UploadPublic sets whether the object is publicly accessible.
+func UploadPublic(public bool) UploadOption {
+	return func(o *UploadOptions) {
+		o.PublicAccess = public
+	}
+}
+
+// DownloadOption sets a field of the DownloadOptions of a single call to
+// Download, on top of the DownloadOptions passed along.
+type DownloadOption func(*DownloadOptions)
+
+// DownloadContentType overrides the content type reported for the object.
+func DownloadContentType(contentType string) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// DownloadConditions sets the preconditions of the read.
+func DownloadConditions(conds storage.Conditions) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.Conditions = &conds
+	}
+}
+
+// UploadCustomTime sets the custom time of the object.
+func UploadCustomTime(t time.Time) UploadOption {
+	return func(o *UploadOptions) {
+		o.CustomTime = t
+	}
+}
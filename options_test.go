@@ -0,0 +1,106 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+func TestUploadOptionsCompose(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	metadata := map[string]string{"owner": "42"}
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		ContentType: "application/octet-stream",
+		Metadata:    metadata,
+	},
+		gcsenhancer.UploadContentType("text/plain"),
+		gcsenhancer.UploadMetadata("tenant", "acme"),
+		gcsenhancer.UploadConditions(storage.Conditions{DoesNotExist: true}),
+		gcsenhancer.UploadACL(gcsenhancer.PredefinedACLPublicRead),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+
+	if obj.Attrs.ContentType != "text/plain" {
+		t.Errorf("content type = %q, want the option's text/plain", obj.Attrs.ContentType)
+	}
+
+	if obj.Attrs.Metadata["owner"] != "42" || obj.Attrs.Metadata["tenant"] != "acme" {
+		t.Errorf("metadata = %v, want owner=42 and tenant=acme", obj.Attrs.Metadata)
+	}
+
+	if len(metadata) != 1 {
+		t.Errorf("caller's metadata modified: %v", metadata)
+	}
+
+	if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers {
+		t.Errorf("ACL = %v, want publicRead", obj.Attrs.ACL)
+	}
+
+	if c := fake.CallsTo(gcstest.OpWrite)[0].Conditions; c == nil || !c.DoesNotExist {
+		t.Errorf("write conditions = %+v, want DoesNotExist", c)
+	}
+}
+
+func TestUploadOptionsLaterOverrides(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{},
+		gcsenhancer.UploadContentType("text/plain"),
+		gcsenhancer.UploadContentType("text/csv"),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, _ := fake.Object("bucket", "a.txt"); obj.Attrs.ContentType != "text/csv" {
+		t.Errorf("content type = %q, want the last option's text/csv", obj.Attrs.ContentType)
+	}
+}
+
+func TestDownloadOptions(t *testing.T) {
+	fake := gcstest.New()
+	attrs := fake.Put("bucket", "a.txt", []byte("x"), storage.ObjectAttrs{ContentType: "application/octet-stream"})
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	body, info, err := e.Download(ctx, "a.txt", gcsenhancer.DownloadOptions{},
+		gcsenhancer.DownloadContentType("text/plain"),
+		gcsenhancer.DownloadConditions(storage.Conditions{GenerationMatch: attrs.Generation}),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body.Close()
+
+	if info.ContentType != "text/plain" {
+		t.Errorf("content type = %q, want the option's text/plain", info.ContentType)
+	}
+
+	_, _, err = e.Download(ctx, "a.txt", gcsenhancer.DownloadOptions{},
+		gcsenhancer.DownloadConditions(storage.Conditions{GenerationMatch: attrs.Generation + 1}),
+	)
+
+	var gerr *googleapi.Error
+
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusPreconditionFailed {
+		t.Errorf("download with a stale generation: err = %v, want 412", err)
+	}
+}
@@ -0,0 +1,80 @@
+package gcsenhancer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+var ErrInvalidSizeRange = errors.New("gcsenhancer: invalid size range")
+
+type PostPolicyOptions struct {
+	// KeyPrefix, e.g. "uploads/42/", is prepended to Name. The policy
+	// requires the key to start with it.
+	KeyPrefix string
+	Name      string
+
+	// ContentType, when set, is the only content type the form may upload.
+	ContentType string
+
+	// MinSize and MaxSize bound the size of the uploaded file, in bytes.
+	// A zero MaxSize leaves the size unbounded above.
+	MinSize int64
+	MaxSize int64
+
+	// Expiry is the lifetime of the policy, DefaultSignedURLExpiry when not
+	// positive.
+	Expiry time.Duration
+}
+
+// SignedPostPolicy generates a V4 signed policy document a browser form can
+// POST the object to. The returned URL is the action of the form, the fields
+// its hidden inputs, followed by the file input. GCS rejects uploads not
+// matching the conditions of the policy. The storage client pins the key to
+// KeyPrefix and Name, so each policy is valid for a single key.
+func (e *GCSEnhancer) SignedPostPolicy(opts PostPolicyOptions) (*storage.PostPolicyV4, error) {
+	key := opts.KeyPrefix + opts.Name
+
+	if key == "" {
+		return nil, ErrEmptyObjectName
+	}
+
+	if opts.MinSize < 0 || opts.MaxSize < 0 || (opts.MaxSize > 0 && opts.MinSize > opts.MaxSize) {
+		return nil, fmt.Errorf("%w: %d-%d", ErrInvalidSizeRange, opts.MinSize, opts.MaxSize)
+	}
+
+	expiry := opts.Expiry
+
+	if expiry <= 0 {
+		expiry = DefaultSignedURLExpiry
+	}
+
+	var conds []storage.PostPolicyV4Condition
+
+	if opts.KeyPrefix != "" {
+		conds = append(conds, storage.ConditionStartsWith("$key", opts.KeyPrefix))
+	}
+
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		max := uint64(opts.MaxSize)
+
+		if max == 0 {
+			max = math.MaxInt64
+		}
+
+		conds = append(conds, storage.ConditionContentLengthRange(uint64(opts.MinSize), max))
+	}
+
+	bucket := e.bucket(e.bucketName)
+
+	return bucket.GenerateSignedPostPolicyV4(key, &storage.PostPolicyV4Options{
+		Expires:    time.Now().Add(expiry),
+		Conditions: conds,
+		Fields: &storage.PolicyV4Fields{
+			ContentType: opts.ContentType,
+		},
+	})
+}
@@ -0,0 +1,121 @@
+package gcsenhancer_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestSignedPostPolicy(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+	start := time.Now()
+
+	policy, err := e.SignedPostPolicy(gcsenhancer.PostPolicyOptions{
+		KeyPrefix:   "uploads/42/",
+		Name:        "avatar.png",
+		ContentType: "image/png",
+		MinSize:     1,
+		MaxSize:     1 << 20,
+		Expiry:      time.Hour,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.URL != "https://storage.googleapis.com/bucket/" {
+		t.Errorf("form action = %s", policy.URL)
+	}
+
+	if policy.Fields["key"] != "uploads/42/avatar.png" || policy.Fields["x-goog-signature"] == "" {
+		t.Errorf("fields = %v, want the key and a signature", policy.Fields)
+	}
+
+	doc, conds := decodePolicy(t, policy)
+
+	for _, want := range []string{
+		`["starts-with","$key","uploads/42/"]`,
+		`["content-length-range",1,1048576]`,
+		`{"content-type":"image/png"}`,
+		`{"key":"uploads/42/avatar.png"}`,
+		`{"bucket":"bucket"}`,
+	} {
+		if !conds[want] {
+			t.Errorf("policy lacks %s: %s", want, doc.Conditions)
+		}
+	}
+
+	if got := doc.Expiration.Sub(start); got < time.Hour-time.Minute || got > time.Hour+time.Minute {
+		t.Errorf("policy expires in %v, want an hour", got)
+	}
+}
+
+func TestSignedPostPolicyMinSize(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	policy, err := e.SignedPostPolicy(gcsenhancer.PostPolicyOptions{Name: "a.png", MinSize: 100})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, conds := decodePolicy(t, policy)
+
+	if want := `["content-length-range",100,9223372036854775807]`; !conds[want] {
+		t.Errorf("policy lacks %s: %s", want, doc.Conditions)
+	}
+}
+
+type policyDoc struct {
+	Conditions []json.RawMessage `json:"conditions"`
+	Expiration time.Time         `json:"expiration"`
+}
+
+// decodePolicy decodes the policy document of policy, and its conditions
+// as a set of their JSON.
+func decodePolicy(t *testing.T, policy *storage.PostPolicyV4) (policyDoc, map[string]bool) {
+	t.Helper()
+
+	raw, err := base64.StdEncoding.DecodeString(policy.Fields["policy"])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc policyDoc
+
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	conds := make(map[string]bool, len(doc.Conditions))
+
+	for _, c := range doc.Conditions {
+		conds[string(c)] = true
+	}
+
+	return doc, conds
+}
+
+func TestSignedPostPolicyInvalid(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	for _, tt := range []struct {
+		opts gcsenhancer.PostPolicyOptions
+		err  error
+	}{
+		{gcsenhancer.PostPolicyOptions{}, gcsenhancer.ErrEmptyObjectName},
+		{gcsenhancer.PostPolicyOptions{Name: "a.png", MinSize: 10, MaxSize: 5}, gcsenhancer.ErrInvalidSizeRange},
+		{gcsenhancer.PostPolicyOptions{Name: "a.png", MaxSize: -1}, gcsenhancer.ErrInvalidSizeRange},
+	} {
+		if _, err := e.SignedPostPolicy(tt.opts); !errors.Is(err, tt.err) {
+			t.Errorf("%+v: err = %v, want %v", tt.opts, err, tt.err)
+		}
+	}
+}
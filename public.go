@@ -0,0 +1,105 @@
+package gcsenhancer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// PredefinedACLPublicRead grants the owner full control and AllUsers read access.
+const PredefinedACLPublicRead = "publicRead"
+
+// DefaultACLTimeout bounds the call granting public access to an upload.
+const DefaultACLTimeout = 10 * time.Second
+
+const (
+	publicPollInitialDelay = 100 * time.Millisecond
+	publicPollMaxDelay     = 2 * time.Second
+)
+
+// WithACLTimeout bounds the call granting public access to an upload with
+// its own deadline, so a stalled ACL call fails fast instead of using up the
+// whole context of the upload. Zero disables the bound.
+func WithACLTimeout(d time.Duration) Option {
+	return func(e *GCSEnhancer) {
+		e.aclTimeout = d
+	}
+}
+
+// WithLenientACL makes failing to grant public access non-fatal: the upload
+// succeeds, leaving the object private, and a warning is logged.
+func WithLenientACL() Option {
+	return func(e *GCSEnhancer) {
+		e.lenientACL = true
+	}
+}
+
+// WithPredefinedACL makes public uploads apply PredefinedACLPublicRead with
+// the write itself rather than with a separate ACL call once written. It
+// saves a request and can't leave a written object private on failure.
+func WithPredefinedACL() Option {
+	return func(e *GCSEnhancer) {
+		e.predefinedACL = true
+	}
+}
+
+// makePublic grants AllUsers read access to the object. It reports whether
+// the access was granted, which it may not be with WithLenientACL.
+func (e *GCSEnhancer) makePublic(ctx context.Context, object ObjectHandle) (bool, error) {
+	if e.aclTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.aclTimeout)
+		defer cancel()
+	}
+
+	err := object.ACL().Set(ctx, storage.AllUsers, storage.RoleReader)
+
+	if err != nil && e.lenientACL {
+		log.Printf("gcsenhancer: failed to make %s public, it stays private: %v", object.ObjectName(), err)
+
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// waitForPublic polls link anonymously with exponential backoff until it is
+// served, since a fresh ACL may take a moment to propagate.
+func (e *GCSEnhancer) waitForPublic(ctx context.Context, link string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	delay := publicPollInitialDelay
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+
+		if err != nil {
+			return err
+		}
+
+		resp, err := e.httpClient.Do(req)
+
+		if err == nil {
+			resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s to become public: %w", link, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > publicPollMaxDelay {
+			delay = publicPollMaxDelay
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// propagatingLinks serves 404 for the first misses requests, then 200.
+func propagatingLinks(misses int) (*http.Client, func() []string) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.String())
+		n := len(requests)
+		mu.Unlock()
+
+		rec := httptest.NewRecorder()
+
+		if n <= misses {
+			rec.WriteHeader(http.StatusNotFound)
+		}
+
+		return rec.Result(), nil
+	})}
+
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestWaitForPublic(t *testing.T) {
+	client, requests := propagatingLinks(2)
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithHTTPClient(client))
+
+	info, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		PublicAccess:  true,
+		WaitForPublic: 5 * time.Second,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+
+	if len(got) != 3 {
+		t.Fatalf("polled %d times, want 3: %v", len(got), got)
+	}
+
+	if want := "HEAD " + info.PublicLink; got[0] != want {
+		t.Errorf("polled %q, want %q", got[0], want)
+	}
+}
+
+func TestWaitForPublicTimeout(t *testing.T) {
+	client, _ := propagatingLinks(1 << 30)
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithHTTPClient(client))
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		PublicAccess:  true,
+		WaitForPublic: 250 * time.Millisecond,
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a deadline exceeded", err)
+	}
+}
+
+func TestWaitForPublicSkipsPrivateUploads(t *testing.T) {
+	client, requests := propagatingLinks(0)
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithHTTPClient(client))
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		WaitForPublic: time.Second,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := requests(); len(got) != 0 {
+		t.Errorf("private upload polled %v", got)
+	}
+}
+
+// stallingACL is a storage whose ACL calls hang until their context is done.
+type stallingACL struct {
+	gcsenhancer.Storage
+}
+
+func (s stallingACL) Bucket(name string) gcsenhancer.BucketHandle {
+	return stallingBucket{s.Storage.Bucket(name)}
+}
+
+type stallingBucket struct {
+	gcsenhancer.BucketHandle
+}
+
+func (b stallingBucket) Object(name string) gcsenhancer.ObjectHandle {
+	return stallingObject{b.BucketHandle.Object(name)}
+}
+
+func (b stallingBucket) Retryer(opts ...storage.RetryOption) gcsenhancer.BucketHandle {
+	return stallingBucket{b.BucketHandle.Retryer(opts...)}
+}
+
+type stallingObject struct {
+	gcsenhancer.ObjectHandle
+}
+
+func (o stallingObject) If(conds storage.Conditions) gcsenhancer.ObjectHandle {
+	return stallingObject{o.ObjectHandle.If(conds)}
+}
+
+func (o stallingObject) ACL() gcsenhancer.ACLHandle {
+	return stallingACLHandle{o.ObjectHandle.ACL()}
+}
+
+type stallingACLHandle struct {
+	gcsenhancer.ACLHandle
+}
+
+func (stallingACLHandle) Set(ctx context.Context, entity storage.ACLEntity, role storage.ACLRole) error {
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestACLTimeout(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(stallingACL{fake}, "bucket", gcsenhancer.WithACLTimeout(50*time.Millisecond))
+
+	start := time.Now()
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{PublicAccess: true})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the ACL call to time out", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("upload took %v, want the ACL call bounded", elapsed)
+	}
+}
+
+func TestLenientACL(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(stallingACL{fake}, "bucket",
+		gcsenhancer.WithACLTimeout(50*time.Millisecond),
+		gcsenhancer.WithLenientACL())
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{PublicAccess: true}); err != nil {
+		t.Fatalf("upload failed on a lenient ACL timeout: %v", err)
+	}
+
+	obj, ok := fake.Object("bucket", "a.txt")
+
+	if !ok {
+		t.Fatal("object not stored")
+	}
+
+	if len(obj.Attrs.ACL) != 0 {
+		t.Errorf("ACL = %v, want the object left private", obj.Attrs.ACL)
+	}
+}
+
+func TestPredefinedACL(t *testing.T) {
+	calls := make(map[bool]int)
+
+	for _, predefined := range []bool{false, true} {
+		fake := gcstest.New()
+
+		var opts []gcsenhancer.Option
+
+		if predefined {
+			opts = append(opts, gcsenhancer.WithPredefinedACL())
+		}
+
+		e := gcsenhancer.NewWithStorage(fake, "bucket", opts...)
+
+		if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{PublicAccess: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", "a.txt")
+
+		if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers {
+			t.Errorf("predefined %v: ACL = %v, want AllUsers", predefined, obj.Attrs.ACL)
+		}
+
+		if n := len(fake.CallsTo(gcstest.OpSetACL)); predefined && n != 0 {
+			t.Errorf("predefined ACL made %d ACL calls, want none", n)
+		}
+
+		calls[predefined] = len(fake.Calls())
+	}
+
+	if calls[true] != calls[false]-1 {
+		t.Errorf("%d calls with the predefined ACL, want one fewer than the %d without", calls[true], calls[false])
+	}
+}
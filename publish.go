@@ -0,0 +1,78 @@
+package gcsenhancer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+)
+
+// publishPrefix is where PublishAtomic stages uploads before publishing them.
+const publishPrefix = ".publish/"
+
+// PublishAtomic uploads r to a temporary key then copies it to finalName in a
+// single rewrite and deletes the temporary object, so readers of finalName
+// either see the previous content or the complete new one. It returns the
+// link of finalName. The content type is derived from the extension of
+// finalName unless set by extra.
+//
+// Like Upload, finalName is private unless made public by extra or the
+// context, see UploadPublic and ContextWithPublicAccess. The ACL and the
+// conditions of extra apply to finalName, the temporary object stays private.
+//
+// The temporary object is deleted on failure too, failing to delete it is
+// only logged. Consider a lifecycle rule deleting objects under ".publish/"
+// to collect the leftovers of crashed processes.
+func (e *GCSEnhancer) PublishAtomic(ctx context.Context, r io.Reader, finalName string, extra ...UploadOption) (string, error) {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	tmpName := fmt.Sprintf("%s%s.%s", publishPrefix, finalName, hex.EncodeToString(b))
+
+	opts := UploadOptions{ContentType: ContentTypeByExtension(finalName)}.apply(extra)
+	public := e.public && publicAccess(ctx, opts)
+
+	staged := opts
+	staged.PublicAccess = false
+	staged.PredefinedACL = ""
+	staged.Conditions = nil
+
+	bucket := e.bucket(e.bucketName)
+	tmp := bucket.Object(tmpName)
+
+	if _, err := e.stage(ContextWithPublicAccess(ctx, false), r, tmpName, staged); err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err := tmp.Delete(context.Background()); err != nil {
+			log.Printf("gcsenhancer: failed to delete temporary object %s: %v", tmpName, err)
+		}
+	}()
+
+	dst := bucket.Object(finalName)
+
+	if opts.Conditions != nil {
+		dst = dst.If(*opts.Conditions)
+	}
+
+	copier := dst.CopierFrom(tmp)
+	copier.Settings().PredefinedACL = opts.PredefinedACL
+
+	if public && opts.PredefinedACL == "" {
+		copier.Settings().PredefinedACL = PredefinedACLPublicRead
+	}
+
+	attr, err := copier.Run(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	return e.objectLink(attr, opts.Host).PublicLink, nil
+}
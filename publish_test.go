@@ -0,0 +1,94 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestPublishAtomic(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	// The final object must not exist while the content is being written.
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite {
+			if _, ok := fake.Object("bucket", "site/index.html"); ok {
+				t.Error("final object visible before the upload completed")
+			}
+		}
+
+		return nil
+	})
+
+	if _, err := e.PublishAtomic(context.Background(), strings.NewReader("<html>"), "site/index.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(fake.Objects("bucket"), ","); got != "site/index.html" {
+		t.Fatalf("objects = %s, want only site/index.html", got)
+	}
+
+	obj, _ := fake.Object("bucket", "site/index.html")
+
+	if string(obj.Content) != "<html>" {
+		t.Errorf("content = %q, want <html>", obj.Content)
+	}
+
+	if !strings.HasPrefix(obj.Attrs.ContentType, "text/html") {
+		t.Errorf("content type = %q, want text/html", obj.Attrs.ContentType)
+	}
+
+	if len(obj.Attrs.ACL) != 0 {
+		t.Errorf("ACL = %v, want private", obj.Attrs.ACL)
+	}
+}
+
+func TestPublishAtomicPublic(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	_, err := e.PublishAtomic(context.Background(), strings.NewReader("{}"), "feed.json", gcsenhancer.UploadPublic(true))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "feed.json")
+
+	if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers {
+		t.Errorf("ACL = %v, want AllUsers reader", obj.Attrs.ACL)
+	}
+
+	for _, c := range fake.CallsTo(gcstest.OpWrite) {
+		if c.Attrs != nil && len(c.Attrs.ACL) != 0 {
+			t.Errorf("temporary object %s written with ACL %v", c.Object, c.Attrs.ACL)
+		}
+	}
+}
+
+func TestPublishAtomicFailureCleansUp(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "feed.json", []byte("old"), storage.ObjectAttrs{})
+
+	_, err := e.PublishAtomic(context.Background(), strings.NewReader("new"), "feed.json",
+		gcsenhancer.UploadConditions(storage.Conditions{DoesNotExist: true}))
+
+	if err == nil {
+		t.Fatal("publish over an existing object succeeded despite DoesNotExist")
+	}
+
+	if got := strings.Join(fake.Objects("bucket"), ","); got != "feed.json" {
+		t.Errorf("objects = %s, want only feed.json", got)
+	}
+
+	if obj, _ := fake.Object("bucket", "feed.json"); string(obj.Content) != "old" {
+		t.Errorf("content = %q, want old", obj.Content)
+	}
+}
@@ -0,0 +1,118 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+var ErrInvalidRange = errors.New("gcsenhancer: invalid range")
+
+// DownloadRange opens length bytes of the object starting at offset, e.g. to
+// resume a download or seek in a video. A negative length reads to the end of
+// the object. A negative offset, or one past the end of the object, is
+// rejected with ErrInvalidRange. The caller must close the returned body.
+func (e *GCSEnhancer) DownloadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: negative offset %d", ErrInvalidRange, offset)
+	}
+
+	if length < 0 {
+		length = -1
+	}
+
+	r, err := e.bucket(e.bucketName).Object(name).NewRangeReader(ctx, offset, length)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+	}
+
+	var apiErr *googleapi.Error
+
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusRequestedRangeNotSatisfiable {
+		return nil, fmt.Errorf("%w: offset %d is past the end of %s", ErrInvalidRange, offset, name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// DownloadParallel downloads the object into w, split by size into parts
+// range reads running concurrently, see WithConcurrency, each written at its
+// offset. The generation is pinned so all the parts are of the same content.
+// w may be partially written on failure.
+func (e *GCSEnhancer) DownloadParallel(ctx context.Context, name string, w io.WriterAt, parts int) error {
+	object := e.bucket(e.bucketName).Object(name)
+
+	attr, err := object.Attrs(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if int64(parts) > attr.Size {
+		parts = int(attr.Size)
+	}
+
+	if parts < 1 {
+		parts = 1
+	}
+
+	object = object.Generation(attr.Generation)
+	partSize := attr.Size / int64(parts)
+
+	return e.runBounded(ctx, parts, func(ctx context.Context, i int) error {
+		offset := int64(i) * partSize
+		length := partSize
+
+		// The last part takes the remainder.
+		if i == parts-1 {
+			length = attr.Size - offset
+		}
+
+		r, err := object.NewRangeReader(ctx, offset, length)
+
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		n, err := io.Copy(&offsetWriter{w: w, offset: offset}, r)
+
+		if err != nil {
+			return err
+		}
+
+		if n != length {
+			return fmt.Errorf("gcsenhancer: part %d of %s is %d bytes, expected %d", i, name, n, length)
+		}
+
+		return nil
+	})
+}
+
+// offsetWriter writes sequentially to w from offset on.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+
+	return n, err
+}
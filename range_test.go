@@ -0,0 +1,147 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestDownloadRange(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("0123456789"), storage.ObjectAttrs{})
+
+	for _, tt := range []struct {
+		offset, length int64
+		want           string
+	}{
+		{3, 4, "3456"},
+		{0, 10, "0123456789"},
+		{7, -1, "789"},
+		{7, 100, "789"},
+		{9, 1, "9"},
+	} {
+		r, err := e.DownloadRange(context.Background(), "a.txt", tt.offset, tt.length)
+
+		if err != nil {
+			t.Fatalf("range %d+%d: %v", tt.offset, tt.length, err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != tt.want {
+			t.Errorf("range %d+%d = %q, want %q", tt.offset, tt.length, b, tt.want)
+		}
+	}
+}
+
+func TestDownloadRangeInvalid(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("0123456789"), storage.ObjectAttrs{})
+
+	for _, offset := range []int64{-1, 10, 50} {
+		if _, err := e.DownloadRange(context.Background(), "a.txt", offset, 1); !errors.Is(err, gcsenhancer.ErrInvalidRange) {
+			t.Errorf("offset %d: err = %v, want ErrInvalidRange", offset, err)
+		}
+	}
+
+	if _, err := e.DownloadRange(context.Background(), "missing.txt", 0, 1); !errors.Is(err, gcsenhancer.ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrObjectNotFound", err)
+	}
+}
+
+// bufferAt is an io.WriterAt of a fixed size.
+type bufferAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return copy(b.buf[off:], p), nil
+}
+
+func TestDownloadParallel(t *testing.T) {
+	content := make([]byte, 10_007)
+
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	fake := gcstest.New()
+	fake.Put("bucket", "big.bin", content, storage.ObjectAttrs{})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithConcurrency(2))
+
+	var (
+		mu             sync.Mutex
+		inFlight, peak int
+	)
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpRead {
+			return nil
+		}
+
+		mu.Lock()
+		inFlight++
+
+		if inFlight > peak {
+			peak = inFlight
+		}
+
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return nil
+	})
+
+	for _, parts := range []int{1, 3, 8} {
+		w := &bufferAt{buf: make([]byte, len(content))}
+
+		if err := e.DownloadParallel(context.Background(), "big.bin", w, parts); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(w.buf, content) {
+			t.Errorf("%d parts: reassembled bytes differ from the original", parts)
+		}
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpRead)); n != 1+3+8 {
+		t.Errorf("%d range reads, want one per part", n)
+	}
+
+	if peak > 2 {
+		t.Errorf("%d reads in flight, want at most 2", peak)
+	}
+
+	err := e.DownloadParallel(context.Background(), "missing.bin", &bufferAt{}, 2)
+
+	if !errors.Is(err, gcsenhancer.ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrObjectNotFound", err)
+	}
+}
@@ -0,0 +1,126 @@
+package gcsenhancer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultMaxRemoteSize int64 = 32 << 20
+	DefaultRemoteTimeout       = 30 * time.Second
+)
+
+var ErrObjectTooLarge = errors.New("gcsenhancer: object exceeds the size limit")
+
+// WithHTTPClient sets the client used to fetch remote files. Defaults to
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) Option {
+	return func(e *GCSEnhancer) {
+		e.httpClient = c
+	}
+}
+
+// WithMaxRemoteSize caps the number of bytes UploadFromURL accepts.
+func WithMaxRemoteSize(n int64) Option {
+	return func(e *GCSEnhancer) {
+		e.maxRemoteSize = n
+	}
+}
+
+// WithRemoteTimeout bounds the time UploadFromURL spends fetching and
+// storing a remote file.
+func WithRemoteTimeout(d time.Duration) Option {
+	return func(e *GCSEnhancer) {
+		e.remoteTimeout = d
+	}
+}
+
+// UploadFromURL fetches sourceURL and streams the response body into the
+// object without buffering it. The content type is taken from the response,
+// or sniffed from the body when the server doesn't tell.
+func (e *GCSEnhancer) UploadFromURL(ctx context.Context, sourceURL, objectName string) (string, error) {
+	if e.remoteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.remoteTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := e.httpClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("fetching %s: unexpected status %s", sourceURL, resp.Status)
+	}
+
+	if e.maxRemoteSize > 0 && resp.ContentLength > e.maxRemoteSize {
+		return "", ErrObjectTooLarge
+	}
+
+	// ------------------- detect content type -------------------
+	body := bufio.NewReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+
+	if contentType == "" || contentType == "application/octet-stream" {
+		head, _ := body.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+
+	var r io.Reader = body
+
+	if e.maxRemoteSize > 0 {
+		r = &limitReader{r: body, remaining: e.maxRemoteSize}
+	}
+
+	info, err := e.Upload(ctx, r, objectName, UploadOptions{
+		ContentType: contentType,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return info.PublicLink, nil
+}
+
+// limitReader fails with ErrObjectTooLarge, rather than silently truncating
+// like io.LimitReader, once more than remaining bytes are read.
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrObjectTooLarge
+	}
+
+	// Read one byte past the limit to tell an exact fit from an overflow.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	if l.remaining < 0 {
+		return 0, ErrObjectTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,107 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+var pngBytes = []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 120))
+
+func TestUploadFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cat.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/untyped":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		default:
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Write(pngBytes)
+	}))
+	defer srv.Close()
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithHTTPClient(srv.Client()))
+
+	for _, path := range []string{"/cat.png", "/untyped"} {
+		name := "remote" + path
+
+		link, err := e.UploadFromURL(context.Background(), srv.URL+path, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasSuffix(link, name) {
+			t.Errorf("link = %s, want the link of %s", link, name)
+		}
+
+		obj, _ := fake.Object("bucket", name)
+
+		if !bytes.Equal(obj.Content, pngBytes) {
+			t.Errorf("%s: stored %d bytes, want %d", path, len(obj.Content), len(pngBytes))
+		}
+
+		if obj.Attrs.ContentType != "image/png" {
+			t.Errorf("%s: content type = %q, want image/png", path, obj.Attrs.ContentType)
+		}
+	}
+
+	if _, err := e.UploadFromURL(context.Background(), srv.URL+"/missing", "missing"); err == nil {
+		t.Error("404 stored")
+	}
+}
+
+func TestUploadFromURLMaxSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Flushing first makes the response chunked, without a length.
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+
+		w.Write(bytes.Repeat([]byte("x"), 1000))
+	}))
+	defer srv.Close()
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithHTTPClient(srv.Client()), gcsenhancer.WithMaxRemoteSize(100))
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		if _, err := e.UploadFromURL(context.Background(), srv.URL+path, "big"); !errors.Is(err, gcsenhancer.ErrObjectTooLarge) {
+			t.Errorf("%s: err = %v, want ErrObjectTooLarge", path, err)
+		}
+	}
+
+	if names := fake.Objects("bucket"); len(names) != 0 {
+		t.Errorf("objects %v stored past the size limit", names)
+	}
+}
+
+func TestUploadFromURLTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithHTTPClient(srv.Client()), gcsenhancer.WithRemoteTimeout(20*time.Millisecond))
+
+	if _, err := e.UploadFromURL(context.Background(), srv.URL, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline exceeded", err)
+	}
+}
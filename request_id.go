@@ -0,0 +1,34 @@
+package gcsenhancer
+
+import "context"
+
+// RequestIDMetadataKey is the metadata key the request ID of an upload is
+// stored under, see WithRequestIDMetadata.
+const RequestIDMetadataKey = "x-request-id"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set by ContextWithRequestID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// WithRequestIDMetadata stores the request ID extracted from the context of
+// the upload on every uploaded object, under RequestIDMetadataKey. extract
+// defaults to RequestIDFromContext when nil.
+func WithRequestIDMetadata(extract func(ctx context.Context) string) Option {
+	return func(e *GCSEnhancer) {
+		if extract == nil {
+			extract = RequestIDFromContext
+		}
+
+		e.requestID = extract
+	}
+}
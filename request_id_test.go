@@ -0,0 +1,55 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestRequestIDMetadata(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithRequestIDMetadata(nil))
+	ctx := gcsenhancer.ContextWithRequestID(context.Background(), "req-42")
+
+	_, err := e.Upload(ctx, strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{
+		Metadata: map[string]string{"owner": "7"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.UploadImages(ctx, pngImages("b.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range fake.Objects("bucket") {
+		obj, _ := fake.Object("bucket", name)
+
+		if got := obj.Attrs.Metadata[gcsenhancer.RequestIDMetadataKey]; got != "req-42" {
+			t.Errorf("%s: %s = %q, want req-42", name, gcsenhancer.RequestIDMetadataKey, got)
+		}
+	}
+
+	if obj, _ := fake.Object("bucket", "a.txt"); obj.Attrs.Metadata["owner"] != "7" {
+		t.Errorf("metadata = %v, want the caller's metadata kept", obj.Attrs.Metadata)
+	}
+}
+
+func TestRequestIDMetadataWithoutID(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithRequestIDMetadata(nil))
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+
+	if _, ok := obj.Attrs.Metadata[gcsenhancer.RequestIDMetadataKey]; ok {
+		t.Errorf("metadata = %v, want no request ID", obj.Attrs.Metadata)
+	}
+}
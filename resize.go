@@ -0,0 +1,173 @@
+package gcsenhancer
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultThumbnailSize is the width and height of the box generated
+// thumbnails fit in.
+const DefaultThumbnailSize = 256
+
+// WithInterpolator sets the algorithm used to resize images, e.g.
+// draw.NearestNeighbor for speed or draw.CatmullRom, the default, for quality.
+func WithInterpolator(interpolator draw.Interpolator) Option {
+	return func(e *GCSEnhancer) {
+		e.interpolator = interpolator
+	}
+}
+
+// WithThumbnailSize sets the box generated thumbnails fit in.
+func WithThumbnailSize(width, height int) Option {
+	return func(e *GCSEnhancer) {
+		e.thumbWidth = width
+		e.thumbHeight = height
+	}
+}
+
+// ThumbnailMode tells how generated thumbnails are shaped to the thumbnail box.
+type ThumbnailMode int
+
+const (
+	// ThumbnailFit scales the image down to fit in the box, keeping its
+	// aspect ratio. The thumbnail may be smaller than the box on one side.
+	ThumbnailFit ThumbnailMode = iota
+
+	// ThumbnailFill scales the image to cover the box and crops the overflow
+	// evenly on both sides, so the thumbnail has the exact box size.
+	ThumbnailFill
+
+	// ThumbnailSmart is ThumbnailFill cropping around the area of highest
+	// entropy, i.e. the most detailed part of the image, instead of the center.
+	ThumbnailSmart
+)
+
+// smartCropSteps is the number of crop windows ThumbnailSmart compares.
+const smartCropSteps = 8
+
+// WithThumbnailMode sets how thumbnails are generated. Defaults to ThumbnailFit.
+func WithThumbnailMode(mode ThumbnailMode) Option {
+	return func(e *GCSEnhancer) {
+		e.thumbMode = mode
+	}
+}
+
+// thumbnail shapes img to the thumbnail box according to the thumbnail mode.
+func (e *GCSEnhancer) thumbnail(img image.Image) image.Image {
+	switch e.thumbMode {
+	case ThumbnailFill, ThumbnailSmart:
+		return e.fill(img, e.thumbWidth, e.thumbHeight, e.thumbMode == ThumbnailSmart)
+	}
+
+	b := img.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), e.thumbWidth, e.thumbHeight)
+
+	return e.resize(img, w, h)
+}
+
+// fill scales img to cover width x height and crops it to exactly that size.
+func (e *GCSEnhancer) fill(img image.Image, width, height int, smart bool) image.Image {
+	b := img.Bounds()
+	sw, sh := coverSize(b.Dx(), b.Dy(), width, height)
+	scaled := e.resize(img, sw, sh)
+
+	offset := image.Pt((sw-width)/2, (sh-height)/2)
+
+	if smart {
+		offset = entropyCrop(scaled, width, height)
+	}
+
+	return scaled.SubImage(image.Rect(offset.X, offset.Y, offset.X+width, offset.Y+height))
+}
+
+func (e *GCSEnhancer) resize(img image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	e.interpolator.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	return dst
+}
+
+// fitSize returns the size of a w x h image scaled to fit in maxW x maxH,
+// keeping its aspect ratio. Images already fitting are not upscaled.
+func fitSize(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+
+	if w*maxH > h*maxW {
+		return maxW, max1(h * maxW / w)
+	}
+
+	return max1(w * maxH / h), maxH
+}
+
+func max1(n int) int {
+	if n < 1 {
+		return 1
+	}
+
+	return n
+}
+
+// coverSize returns the smallest size of a w x h image scaled to cover
+// boxW x boxH, keeping its aspect ratio.
+func coverSize(w, h, boxW, boxH int) (int, int) {
+	if w*boxH > h*boxW {
+		return max1(w * boxH / h), boxH
+	}
+
+	return boxW, max1(h * boxW / w)
+}
+
+// entropyCrop returns the top-left corner of the width x height window of img
+// with the highest luminance entropy. Windows slide along the axis img
+// overflows the window on.
+func entropyCrop(img *image.RGBA, width, height int) image.Point {
+	b := img.Bounds()
+	overX, overY := b.Dx()-width, b.Dy()-height
+
+	best := image.Point{}
+	bestEntropy := -1.0
+
+	for i := 0; i <= smartCropSteps; i++ {
+		p := image.Pt(overX*i/smartCropSteps, overY*i/smartCropSteps)
+
+		if ent := entropy(img, image.Rect(p.X, p.Y, p.X+width, p.Y+height)); ent > bestEntropy {
+			best, bestEntropy = p, ent
+		}
+	}
+
+	return best
+}
+
+// entropy computes the Shannon entropy of the luminance histogram of r.
+func entropy(img *image.RGBA, r image.Rectangle) float64 {
+	var (
+		hist  [256]int
+		total int
+	)
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			lum := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+			hist[lum]++
+			total++
+		}
+	}
+
+	var ent float64
+
+	for _, n := range hist {
+		if n == 0 {
+			continue
+		}
+
+		p := float64(n) / float64(total)
+		ent -= p * math.Log2(p)
+	}
+
+	return ent
+}
@@ -0,0 +1,112 @@
+package gcsenhancer
+
+import (
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// checkerboard returns a w x h image of alternating black and white pixels.
+func checkerboard(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x+y)%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	return img
+}
+
+func TestWithInterpolator(t *testing.T) {
+	src := checkerboard(97, 61)
+	sums := make(map[[sha256.Size]byte]string)
+
+	for name, interpolator := range map[string]draw.Interpolator{
+		"NearestNeighbor": draw.NearestNeighbor,
+		"CatmullRom":      draw.CatmullRom,
+	} {
+		e := NewWithStorage(nil, "bucket", WithInterpolator(interpolator))
+		dst := e.resize(src, 40, 25)
+
+		if other, ok := sums[sha256.Sum256(dst.Pix)]; ok {
+			t.Errorf("%s and %s resized to the same pixels", name, other)
+		}
+
+		sums[sha256.Sum256(dst.Pix)] = name
+	}
+}
+
+func TestDefaultInterpolatorIsCatmullRom(t *testing.T) {
+	src := checkerboard(97, 61)
+
+	got := NewWithStorage(nil, "bucket").resize(src, 40, 25)
+	want := NewWithStorage(nil, "bucket", WithInterpolator(draw.CatmullRom)).resize(src, 40, 25)
+
+	if sha256.Sum256(got.Pix) != sha256.Sum256(want.Pix) {
+		t.Error("default resize differs from CatmullRom")
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	for _, tt := range []struct {
+		w, h, maxW, maxH int
+		wantW, wantH     int
+	}{
+		{100, 50, 256, 256, 100, 50},
+		{1000, 500, 256, 256, 256, 128},
+		{500, 1000, 256, 256, 128, 256},
+		{10000, 1, 256, 256, 256, 1},
+	} {
+		w, h := fitSize(tt.w, tt.h, tt.maxW, tt.maxH)
+
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("fitSize(%d, %d, %d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.maxW, tt.maxH, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestThumbnailModes(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	for _, tt := range []struct {
+		mode ThumbnailMode
+		w, h int
+	}{
+		{ThumbnailFit, 100, 50},
+		{ThumbnailFill, 100, 100},
+		{ThumbnailSmart, 100, 100},
+	} {
+		e := NewWithStorage(nil, "bucket", WithThumbnailSize(100, 100), WithThumbnailMode(tt.mode))
+
+		if b := e.thumbnail(src).Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("mode %d: thumbnail is %dx%d, want %dx%d", tt.mode, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+}
+
+func TestThumbnailSmartCropsDetail(t *testing.T) {
+	// A flat 300x100 image with a detailed square on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	detail := checkerboard(100, 100)
+	draw.Draw(src, image.Rect(200, 0, 300, 100), detail, image.Point{}, draw.Src)
+
+	fill := NewWithStorage(nil, "bucket", WithThumbnailSize(100, 100), WithThumbnailMode(ThumbnailFill)).thumbnail(src)
+	smart := NewWithStorage(nil, "bucket", WithThumbnailSize(100, 100), WithThumbnailMode(ThumbnailSmart)).thumbnail(src)
+
+	if got := fill.Bounds().Min.X; got != 100 {
+		t.Errorf("fill crops at x=%d, want the center at 100", got)
+	}
+
+	if got := smart.Bounds().Min.X; got != 200 {
+		t.Errorf("smart crops at x=%d, want the detailed area at 200", got)
+	}
+}
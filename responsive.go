@@ -0,0 +1,123 @@
+package gcsenhancer
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UploadResponsive uploads a variant of the image per width, e.g. 320, 640
+// and 1280 for a srcset, and returns the link of each variant keyed by width.
+// Variants keep the aspect ratio of the source, widths larger than the source
+// are skipped since upscaling gains nothing.
+func (e *GCSEnhancer) UploadResponsive(ctx context.Context, img Images, widths []int) (map[int]string, error) {
+	img = e.prepareImage(img)
+
+	var (
+		objs     []*ObjectInfo
+		variants []int
+	)
+
+	b := img.OrigImage.Bounds()
+	stamp := e.now().Format(timestampLayout)
+
+	for _, width := range widths {
+		if width <= 0 || width > b.Dx() {
+			continue
+		}
+
+		height := max1(b.Dy() * width / b.Dx())
+		key := e.stampedKey(filepath.Base(img.Name), fmt.Sprintf("%dw", width), stamp)
+
+		obj, err := e.imageObject(e.resize(img.OrigImage, width, height), img.Mime, Original, key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, obj)
+		variants = append(variants, width)
+	}
+
+	links := make([]string, len(objs))
+
+	err := e.runBounded(ctx, len(objs), func(ctx context.Context, i int) error {
+		info, _, err := e.uploadObject(ctx, objs[i])
+
+		if err != nil {
+			return err
+		}
+
+		links[i] = info.PublicLink
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	linkByWidth := make(map[int]string, len(links))
+
+	for i, width := range variants {
+		linkByWidth[width] = links[i]
+	}
+
+	return linkByWidth, nil
+}
+
+// SrcSet builds the srcset attribute of the variants returned by
+// UploadResponsive, e.g. "https://.../cat_320w.png 320w, https://.../cat_640w.png 640w",
+// ordered by width.
+func SrcSet(variants map[int]string) string {
+	widths := make([]int, 0, len(variants))
+
+	for width := range variants {
+		widths = append(widths, width)
+	}
+
+	sort.Ints(widths)
+
+	candidates := make([]string, len(widths))
+
+	for i, width := range widths {
+		candidates[i] = fmt.Sprintf("%s %dw", variants[width], width)
+	}
+
+	return strings.Join(candidates, ", ")
+}
+
+// PictureHTML builds a <picture> element offering the webp variants to the
+// browsers supporting them, and the fallback variants, e.g. JPEG, to the
+// others. The widest fallback is the src of the <img> for browsers ignoring
+// srcset. Links and alt are HTML escaped. webp may be empty.
+func PictureHTML(webp, fallback map[int]string, alt string) string {
+	var b strings.Builder
+
+	b.WriteString("<picture>")
+
+	if len(webp) > 0 {
+		fmt.Fprintf(&b, `<source type="image/webp" srcset="%s">`, html.EscapeString(SrcSet(webp)))
+	}
+
+	src, widest := "", 0
+
+	for width, link := range fallback {
+		if width > widest {
+			src, widest = link, width
+		}
+	}
+
+	fmt.Fprintf(&b, `<img src="%s" srcset="%s" alt="%s">`,
+		html.EscapeString(src),
+		html.EscapeString(SrcSet(fallback)),
+		html.EscapeString(alt),
+	)
+
+	b.WriteString("</picture>")
+
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadResponsive(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	variants, err := e.UploadResponsive(context.Background(), gcsenhancer.Images{
+		Name:      "cat.png",
+		Mime:      "image/png",
+		OrigImage: image.NewRGBA(image.Rect(0, 0, 1000, 500)),
+	}, []int{320, 640, 1280})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variants) != 2 {
+		t.Fatalf("%d variants, want 320 and 640 only: %v", len(variants), variants)
+	}
+
+	if _, ok := variants[1280]; ok {
+		t.Error("1280w variant upscaled from a 1000px source")
+	}
+
+	for width, link := range variants {
+		name := strings.TrimPrefix(parseURL(t, link).Path, "/bucket/")
+		obj, ok := fake.Object("bucket", name)
+
+		if !ok {
+			t.Fatalf("%dw variant %s not stored", width, name)
+		}
+
+		cfg, err := png.DecodeConfig(bytes.NewReader(obj.Content))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Width != width || cfg.Height != width/2 {
+			t.Errorf("%dw variant is %dx%d, want %dx%d", width, cfg.Width, cfg.Height, width, width/2)
+		}
+	}
+}
+
+func TestSrcSet(t *testing.T) {
+	got := gcsenhancer.SrcSet(map[int]string{
+		640: "https://cdn/cat_640w.png",
+		320: "https://cdn/cat_320w.png",
+		960: "https://cdn/cat_960w.png",
+	})
+
+	if want := "https://cdn/cat_320w.png 320w, https://cdn/cat_640w.png 640w, https://cdn/cat_960w.png 960w"; got != want {
+		t.Errorf("SrcSet = %q, want %q", got, want)
+	}
+
+	if got := gcsenhancer.SrcSet(nil); got != "" {
+		t.Errorf("SrcSet of no variants = %q, want empty", got)
+	}
+}
+
+func TestPictureHTML(t *testing.T) {
+	webp := map[int]string{320: "https://cdn/cat_320w.webp", 640: "https://cdn/cat_640w.webp"}
+	jpeg := map[int]string{320: "https://cdn/cat_320w.jpg", 640: "https://cdn/cat_640w.jpg?a=1&b=2"}
+
+	want := `<picture>` +
+		`<source type="image/webp" srcset="https://cdn/cat_320w.webp 320w, https://cdn/cat_640w.webp 640w">` +
+		`<img src="https://cdn/cat_640w.jpg?a=1&amp;b=2" srcset="https://cdn/cat_320w.jpg 320w, https://cdn/cat_640w.jpg?a=1&amp;b=2 640w" alt="&#34;cat&#34; &lt;3">` +
+		`</picture>`
+
+	if got := gcsenhancer.PictureHTML(webp, jpeg, `"cat" <3`); got != want {
+		t.Errorf("PictureHTML =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := gcsenhancer.PictureHTML(nil, jpeg, "cat"); strings.Contains(got, "<source") {
+		t.Errorf("PictureHTML without webp variants = %s, want no <source>", got)
+	}
+}
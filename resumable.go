@@ -0,0 +1,298 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// resumableEndpoint is the JSON API endpoint resumable sessions are started on.
+const resumableEndpoint = "https://storage.googleapis.com/upload/storage/v1/b/%s/o"
+
+var (
+	ErrSessionExpired     = errors.New("gcsenhancer: resumable session expired or cancelled")
+	ErrNoAuthorizedClient = errors.New("gcsenhancer: resumable uploads need an authorized client, see WithAuthorizedClient")
+)
+
+// WithAuthorizedClient sets the authorized HTTP client resumable sessions are
+// driven with, see StartResumableUpload. storage.Writer doesn't expose its
+// session, sessions are thus driven through the JSON API directly, with the
+// credentials of c rather than those of the storage client. Resumable
+// uploads fail with ErrNoAuthorizedClient without it.
+func WithAuthorizedClient(c *http.Client) Option {
+	return func(e *GCSEnhancer) {
+		e.authorizedClient = c
+	}
+}
+
+func (e *GCSEnhancer) sessionClient() (*http.Client, error) {
+	if e.authorizedClient == nil {
+		return nil, ErrNoAuthorizedClient
+	}
+
+	return e.authorizedClient, nil
+}
+
+// sessionEndpoint returns the endpoint sessions of bucketName are started
+// on. Like the storage client, it targets the emulator set by the
+// STORAGE_EMULATOR_HOST environment variable, if any.
+func sessionEndpoint(bucketName string) string {
+	host := os.Getenv("STORAGE_EMULATOR_HOST")
+
+	if host == "" {
+		return fmt.Sprintf(resumableEndpoint, url.PathEscape(bucketName))
+	}
+
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+
+	return fmt.Sprintf("%s/upload/storage/v1/b/%s/o", strings.TrimSuffix(host, "/"), url.PathEscape(bucketName))
+}
+
+// StartResumableUpload starts a resumable upload session of the object name
+// and returns its URI. The URI can be persisted, e.g. along with a large
+// upload in progress, to resume the upload with ResumeUpload after an
+// interruption, even from another process. Sessions expire after a week.
+//
+// Only ContentType, ContentTypeFromExt and PredefinedACL of opts apply.
+// Public uploads get PredefinedACLPublicRead.
+func (e *GCSEnhancer) StartResumableUpload(ctx context.Context, name string, opts UploadOptions) (string, error) {
+	client, err := e.sessionClient()
+
+	if err != nil {
+		return "", err
+	}
+
+	if opts.ContentType == "" && opts.ContentTypeFromExt {
+		opts.ContentType = ContentTypeByExtension(name)
+	}
+
+	query := url.Values{
+		"uploadType": []string{"resumable"},
+		"name":       []string{name},
+	}
+
+	if opts.PredefinedACL == "" && e.public && publicAccess(ctx, opts) {
+		opts.PredefinedACL = PredefinedACLPublicRead
+	}
+
+	if opts.PredefinedACL != "" {
+		query.Set("predefinedAcl", opts.PredefinedACL)
+	}
+
+	endpoint := sessionEndpoint(e.bucketName) + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	if opts.ContentType != "" {
+		req.Header.Set("X-Upload-Content-Type", opts.ContentType)
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", sessionError(res)
+	}
+
+	return res.Header.Get("Location"), nil
+}
+
+// ResumableOffset returns the number of bytes persisted by the session, the
+// offset to resume the upload from. done is true when the upload completed.
+func (e *GCSEnhancer) ResumableOffset(ctx context.Context, sessionURI string) (offset int64, done bool, err error) {
+	client, err := e.sessionClient()
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURI, nil)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	req.Header.Set("Content-Range", "bytes */*")
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return 0, true, nil
+	case http.StatusPermanentRedirect:
+		offset, err := persistedOffset(res)
+
+		return offset, false, err
+	}
+
+	return 0, false, sessionError(res)
+}
+
+// ResumeUpload uploads the rest of the content, read from r, to the session
+// from offset on, e.g. as returned by ResumableOffset. r must start at
+// offset. The content is sent in chunks, an interrupted upload can be resumed
+// again from the last persisted chunk.
+func (e *GCSEnhancer) ResumeUpload(ctx context.Context, sessionURI string, r io.Reader, offset int64) (*UploadedFileInfo, error) {
+	client, err := e.sessionClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, defaultChunkSize)
+
+	for {
+		n, err := io.ReadFull(r, buf)
+
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+
+		if err != nil && !last {
+			return nil, err
+		}
+
+		info, persisted, err := e.sendChunk(ctx, client, sessionURI, buf[:n], offset, last)
+
+		if err != nil || info != nil {
+			return info, err
+		}
+
+		if persisted != offset+int64(n) {
+			return nil, fmt.Errorf("gcsenhancer: session persisted %d bytes out of %d, resume from there", persisted, offset+int64(n))
+		}
+
+		offset = persisted
+	}
+}
+
+// sendChunk sends chunk, located at offset of the content, to the session.
+// The link of the object is returned once the upload completed, otherwise
+// the offset the next chunk starts at, which may be less than the end of
+// chunk when the server persisted only part of it.
+func (e *GCSEnhancer) sendChunk(ctx context.Context, client *http.Client, sessionURI string, chunk []byte, offset int64, last bool) (*UploadedFileInfo, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURI, bytes.NewReader(chunk))
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Content-Range", contentRange(offset, int64(len(chunk)), last))
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		info, err := e.sessionObjectLink(ctx, res)
+
+		return info, 0, err
+	case http.StatusPermanentRedirect:
+		if last {
+			return nil, 0, fmt.Errorf("gcsenhancer: session did not complete after its last chunk")
+		}
+
+		persisted, err := persistedOffset(res)
+
+		return nil, persisted, err
+	}
+
+	return nil, 0, sessionError(res)
+}
+
+// contentRange returns the Content-Range of a chunk of n bytes at offset.
+// The total size is only known, thus sent, with the last chunk.
+func contentRange(offset, n int64, last bool) string {
+	total := "*"
+
+	if last {
+		total = strconv.FormatInt(offset+n, 10)
+	}
+
+	if n == 0 {
+		return fmt.Sprintf("bytes */%s", total)
+	}
+
+	return fmt.Sprintf("bytes %d-%d/%s", offset, offset+n-1, total)
+}
+
+// persistedOffset parses the Range, e.g. "bytes=0-1048575", of a 308
+// response. No Range means nothing is persisted yet.
+func persistedOffset(res *http.Response) (int64, error) {
+	rng := res.Header.Get("Range")
+
+	if rng == "" {
+		return 0, nil
+	}
+
+	i := strings.LastIndex(rng, "-")
+
+	if i < 0 {
+		return 0, fmt.Errorf("gcsenhancer: malformed range %q", rng)
+	}
+
+	end, err := strconv.ParseInt(rng[i+1:], 10, 64)
+
+	if err != nil {
+		return 0, fmt.Errorf("gcsenhancer: malformed range %q", rng)
+	}
+
+	return end + 1, nil
+}
+
+// sessionObjectLink returns the link of the object created by a session.
+func (e *GCSEnhancer) sessionObjectLink(ctx context.Context, res *http.Response) (*UploadedFileInfo, error) {
+	var created struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&created); err != nil {
+		return nil, err
+	}
+
+	attr, err := e.bucket(e.bucketName).Object(created.Name).Attrs(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e.objectLink(attr, ""), nil
+}
+
+func sessionError(res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		return fmt.Errorf("%w: %s", ErrSessionExpired, body)
+	}
+
+	return fmt.Errorf("gcsenhancer: resumable session failed with %s: %s", res.Status, body)
+}
@@ -0,0 +1,62 @@
+package gcsenhancer
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestContentRange(t *testing.T) {
+	for _, tc := range []struct {
+		offset, n int64
+		last      bool
+		want      string
+	}{
+		{0, 256, false, "bytes 0-255/*"},
+		{256, 100, true, "bytes 256-355/356"},
+		{512, 0, true, "bytes */512"},
+		{0, 0, false, "bytes */*"},
+	} {
+		if got := contentRange(tc.offset, tc.n, tc.last); got != tc.want {
+			t.Errorf("contentRange(%d, %d, %v) = %q, want %q", tc.offset, tc.n, tc.last, got, tc.want)
+		}
+	}
+}
+
+func TestPersistedOffset(t *testing.T) {
+	for rng, want := range map[string]int64{
+		"":                0,
+		"bytes=0-1048575": 1048576,
+	} {
+		res := &http.Response{Header: http.Header{}}
+
+		if rng != "" {
+			res.Header.Set("Range", rng)
+		}
+
+		got, err := persistedOffset(res)
+
+		if err != nil || got != want {
+			t.Errorf("persistedOffset(%q) = %d, %v, want %d", rng, got, err, want)
+		}
+	}
+
+	res := &http.Response{Header: http.Header{"Range": []string{"bytes=0-x"}}}
+
+	if _, err := persistedOffset(res); err == nil {
+		t.Error("malformed range accepted")
+	}
+}
+
+func TestSessionEndpoint(t *testing.T) {
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+
+	if got, want := sessionEndpoint("my bucket"), "https://storage.googleapis.com/upload/storage/v1/b/my%20bucket/o"; got != want {
+		t.Errorf("endpoint = %q, want %q", got, want)
+	}
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "localhost:9023")
+
+	if got, want := sessionEndpoint("b"), "http://localhost:9023/upload/storage/v1/b/b/o"; got != want {
+		t.Errorf("emulator endpoint = %q, want %q", got, want)
+	}
+}
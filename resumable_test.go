@@ -0,0 +1,180 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// sessionServer serves the resumable upload sessions of the JSON API,
+// storing completed uploads in fake.
+type sessionServer struct {
+	*httptest.Server
+
+	fake *gcstest.Storage
+
+	mu            sync.Mutex
+	name          string
+	contentType   string
+	predefinedACL string
+	content       []byte
+	chunks        []int
+	done          bool
+
+	// failAt, when positive, makes the chunk crossing it persist only up to
+	// failAt and fail, once.
+	failAt int
+}
+
+func newSessionServer(t *testing.T, fake *gcstest.Storage) *sessionServer {
+	s := &sessionServer{fake: fake}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	// Resumable sessions target the emulator, like the storage client.
+	t.Setenv("STORAGE_EMULATOR_HOST", s.URL)
+
+	return s
+}
+
+func (s *sessionServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodPost {
+		if r.URL.Path != "/upload/storage/v1/b/bucket/o" || r.URL.Query().Get("uploadType") != "resumable" {
+			http.Error(w, "unexpected session request "+r.URL.String(), http.StatusBadRequest)
+
+			return
+		}
+
+		s.name = r.URL.Query().Get("name")
+		s.predefinedACL = r.URL.Query().Get("predefinedAcl")
+		s.contentType = r.Header.Get("X-Upload-Content-Type")
+		w.Header().Set("Location", s.URL+"/session")
+
+		return
+	}
+
+	var (
+		first, last int
+		total       string
+	)
+
+	rng := r.Header.Get("Content-Range")
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if strings.HasPrefix(rng, "bytes */") {
+		total = strings.TrimPrefix(rng, "bytes */")
+	} else if _, err := fmt.Sscanf(rng, "bytes %d-%d/%s", &first, &last, &total); err != nil || first != len(s.content) || last-first+1 != len(body) {
+		http.Error(w, "bad range "+rng, http.StatusBadRequest)
+
+		return
+	}
+
+	if len(body) > 0 {
+		s.chunks = append(s.chunks, len(body))
+	}
+
+	if s.failAt > 0 && len(s.content)+len(body) > s.failAt {
+		s.content = append(s.content, body[:s.failAt-len(s.content)]...)
+		s.failAt = 0
+		http.Error(w, "connection reset", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	s.content = append(s.content, body...)
+
+	if !s.done && total == strconv.Itoa(len(s.content)) {
+		s.done = true
+		s.fake.Put("bucket", s.name, s.content, storage.ObjectAttrs{ContentType: s.contentType})
+	}
+
+	if s.done {
+		json.NewEncoder(w).Encode(map[string]string{"name": s.name})
+
+		return
+	}
+
+	if len(s.content) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.content)-1))
+	}
+
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func TestResumeUpload(t *testing.T) {
+	fake := gcstest.New()
+	srv := newSessionServer(t, fake)
+	srv.failAt = 400
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithAuthorizedClient(srv.Client()))
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	uri, err := e.StartResumableUpload(ctx, "big.bin", gcsenhancer.UploadOptions{ContentType: "application/x-big"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ResumeUpload(ctx, uri, bytes.NewReader(data), 0); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+
+	offset, done, err := e.ResumableOffset(ctx, uri)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset != 400 || done {
+		t.Fatalf("offset %d done %v, want 400 false", offset, done)
+	}
+
+	if _, err := e.ResumeUpload(ctx, uri, bytes.NewReader(data[offset:]), offset); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, ok := fake.Object("bucket", "big.bin")
+
+	if !ok {
+		t.Fatal("object not created")
+	}
+
+	if !bytes.Equal(obj.Content, data) {
+		t.Errorf("content differs, %d bytes stored", len(obj.Content))
+	}
+
+	if obj.Attrs.ContentType != "application/x-big" {
+		t.Errorf("content type = %q", obj.Attrs.ContentType)
+	}
+
+	if _, done, err := e.ResumableOffset(ctx, uri); err != nil || !done {
+		t.Errorf("done = %v, err = %v after completion", done, err)
+	}
+}
+
+func TestResumableUploadNeedsAuthorizedClient(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	_, err := e.StartResumableUpload(context.Background(), "a.bin", gcsenhancer.UploadOptions{})
+
+	if !errors.Is(err, gcsenhancer.ErrNoAuthorizedClient) {
+		t.Errorf("err = %v, want ErrNoAuthorizedClient", err)
+	}
+}
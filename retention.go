@@ -0,0 +1,140 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+var (
+	ErrObjectHeld           = errors.New("gcsenhancer: object is under hold or retention")
+	ErrConflictingRetention = errors.New("gcsenhancer: both RetainFor and RetainUntil set")
+)
+
+// SetRetention sets the retention period of the bucket. Objects in the bucket
+// can not be deleted or replaced until they are older than period. A zero
+// period removes the retention policy.
+func (e *GCSEnhancer) SetRetention(ctx context.Context, period time.Duration) error {
+	bucket := e.bucket(e.bucketName)
+
+	policy := &storage.RetentionPolicy{}
+
+	if period > 0 {
+		policy.RetentionPeriod = period
+	}
+
+	_, err := bucket.Update(ctx, storage.BucketAttrsToUpdate{
+		RetentionPolicy: policy,
+	})
+
+	return err
+}
+
+// retentionMode returns the mode of an object retention, see
+// UploadOptions.RetentionLocked.
+func retentionMode(locked bool) string {
+	if locked {
+		return "Locked"
+	}
+
+	return "Unlocked"
+}
+
+// retainUntil returns the time an upload with opts is retained until, zero
+// when it isn't.
+func (e *GCSEnhancer) retainUntil(opts UploadOptions) time.Time {
+	if opts.RetainFor > 0 {
+		return e.now().Add(opts.RetainFor)
+	}
+
+	return opts.RetainUntil
+}
+
+// retentionExpiration returns the time the object described by attr is
+// retained until, by the retention policy of its bucket or its own.
+func retentionExpiration(attr *storage.ObjectAttrs) time.Time {
+	expiration := attr.RetentionExpirationTime
+
+	if r := attr.Retention; r != nil && r.RetainUntil.After(expiration) {
+		expiration = r.RetainUntil
+	}
+
+	return expiration
+}
+
+// LockRetention permanently locks the retention policy of the bucket, making
+// its objects write-once-read-many: the period can then be increased but
+// never reduced or removed, and the bucket can't be deleted until every
+// object is past it. Locking is irreversible, set the period with
+// SetRetention first.
+//
+// Objects can be retained individually too, until a time of their own, with
+// UploadOptions.RetainFor.
+func (e *GCSEnhancer) LockRetention(ctx context.Context) error {
+	bucket := e.bucket(e.bucketName)
+
+	attrs, err := bucket.Attrs(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if attrs.RetentionPolicy == nil || attrs.RetentionPolicy.RetentionPeriod == 0 {
+		return fmt.Errorf("gcsenhancer: bucket %s has no retention policy to lock", e.bucketName)
+	}
+
+	// Guards against locking a policy changed since it was read.
+	return bucket.
+		If(storage.BucketConditions{MetagenerationMatch: attrs.MetaGeneration}).
+		LockRetentionPolicy(ctx)
+}
+
+// Delete deletes the object. Objects under a hold or an unexpired retention
+// are not deleted, ErrObjectHeld is returned instead.
+func (e *GCSEnhancer) Delete(ctx context.Context, name string) error {
+	object := e.bucket(e.bucketName).Object(name)
+
+	attr, err := object.Attrs(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return e.deleteObject(ctx, attr)
+}
+
+// deleteObject deletes the generation of the object described by attr,
+// unless it is held.
+func (e *GCSEnhancer) deleteObject(ctx context.Context, attr *storage.ObjectAttrs) error {
+	if err := checkDeletable(attr); err != nil {
+		return err
+	}
+
+	return e.bucket(attr.Bucket).Object(attr.Name).
+		If(storage.Conditions{GenerationMatch: attr.Generation}).
+		Delete(ctx)
+}
+
+func checkDeletable(attr *storage.ObjectAttrs) error {
+	if attr.TemporaryHold {
+		return fmt.Errorf("%w: %s has a temporary hold", ErrObjectHeld, attr.Name)
+	}
+
+	if attr.EventBasedHold {
+		return fmt.Errorf("%w: %s has an event-based hold", ErrObjectHeld, attr.Name)
+	}
+
+	if r := attr.Retention; r != nil && r.RetainUntil.After(time.Now()) {
+		return fmt.Errorf("%w: %s is retained until %s (%s)", ErrObjectHeld, attr.Name, r.RetainUntil.Format(time.RFC3339), strings.ToLower(r.Mode))
+	}
+
+	if attr.RetentionExpirationTime.After(time.Now()) {
+		return fmt.Errorf("%w: %s is retained until %s", ErrObjectHeld, attr.Name, attr.RetentionExpirationTime.Format(time.RFC3339))
+	}
+
+	return nil
+}
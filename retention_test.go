@@ -0,0 +1,255 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestLockedRetentionPreventsDelete(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	if err := e.LockRetention(ctx); err == nil {
+		t.Error("locked a bucket without retention policy")
+	}
+
+	if err := e.SetRetention(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.LockRetention(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.SetRetention(ctx, time.Minute); err == nil {
+		t.Error("shortened a locked retention policy")
+	}
+
+	if _, err := e.Upload(ctx, strings.NewReader("record"), "audit.log", gcsenhancer.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Delete(ctx, "audit.log"); !errors.Is(err, gcsenhancer.ErrObjectHeld) {
+		t.Errorf("err = %v, want ErrObjectHeld", err)
+	}
+
+	if _, ok := fake.Object("bucket", "audit.log"); !ok {
+		t.Error("retained object deleted")
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpDelete)); n != 0 {
+		t.Errorf("%d deletes sent, want the retention checked first", n)
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.SetBucketAttrs("bucket", storage.BucketAttrs{
+		RetentionPolicy: &storage.RetentionPolicy{RetentionPeriod: time.Hour, IsLocked: true},
+	})
+
+	// Stored two hours ago, past its retention.
+	fake.SetClock(func() time.Time { return time.Now().Add(-2 * time.Hour) })
+	fake.Put("bucket", "old.log", []byte("x"), storage.ObjectAttrs{})
+	fake.SetClock(time.Now)
+
+	if err := e.Delete(context.Background(), "old.log"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.Object("bucket", "old.log"); ok {
+		t.Error("expired object not deleted")
+	}
+}
+
+func TestUploadWithObjectRetention(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	opts := gcsenhancer.UploadOptions{RetainFor: time.Hour, RetentionLocked: true}
+
+	if _, err := e.Upload(ctx, strings.NewReader("record"), "audit.log", opts); err == nil {
+		t.Fatal("retained an object in a bucket without object retention")
+	}
+
+	fake.SetBucketAttrs("bucket", storage.BucketAttrs{ObjectRetentionMode: "Enabled"})
+
+	before := time.Now()
+
+	if _, err := e.Upload(ctx, strings.NewReader("record"), "audit.log", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "audit.log")
+
+	if r := obj.Attrs.Retention; r == nil || r.Mode != "Locked" || r.RetainUntil.Before(before.Add(time.Hour)) {
+		t.Fatalf("retention = %+v, want locked for an hour", r)
+	}
+
+	err := e.Delete(ctx, "audit.log")
+
+	if !errors.Is(err, gcsenhancer.ErrObjectHeld) || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("err = %v, want ErrObjectHeld naming the locked retention", err)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpDelete)); n != 0 {
+		t.Errorf("%d deletes sent, want the retention checked first", n)
+	}
+
+	if _, err := e.Upload(ctx, strings.NewReader("forged"), "audit.log", gcsenhancer.UploadOptions{}); err == nil {
+		t.Error("replaced a retained object")
+	}
+
+	// Retained until an hour after an upload made two hours ago.
+	past := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithClock(func() time.Time {
+		return time.Now().Add(-2 * time.Hour)
+	}))
+
+	if _, err := past.Upload(ctx, strings.NewReader("x"), "old.log", gcsenhancer.UploadOptions{RetainFor: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := past.Delete(ctx, "old.log"); err != nil {
+		t.Errorf("delete after the retention expired: %v", err)
+	}
+}
+
+func TestUploadSurfacesRetentionExpiration(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	info, err := e.Upload(ctx, strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.RetentionExpiration.IsZero() {
+		t.Errorf("expiration %v without a retention policy, want zero", info.RetentionExpiration)
+	}
+
+	if err := e.SetRetention(ctx, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+
+	info, err = e.Upload(ctx, strings.NewReader("x"), "b.txt", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.RetentionExpiration.Before(before.Add(24 * time.Hour)) {
+		t.Errorf("expiration %v, want a day from now", info.RetentionExpiration)
+	}
+
+	if err := e.Delete(ctx, "b.txt"); !errors.Is(err, gcsenhancer.ErrObjectHeld) {
+		t.Errorf("err = %v, want ErrObjectHeld before expiry", err)
+	}
+}
+
+func TestUploadRetainedUntil(t *testing.T) {
+	fake := gcstest.New()
+	fake.SetBucketAttrs("bucket", storage.BucketAttrs{ObjectRetentionMode: "Enabled"})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+	until := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+
+	info, err := e.Upload(ctx, strings.NewReader("x"), "share.zip", gcsenhancer.UploadOptions{RetainUntil: until})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "share.zip")
+
+	if r := obj.Attrs.Retention; r == nil || r.Mode != "Unlocked" || !r.RetainUntil.Equal(until) {
+		t.Errorf("retention = %+v, want unlocked until %v", r, until)
+	}
+
+	if !info.RetentionExpiration.Equal(until) {
+		t.Errorf("expiration %v, want %v", info.RetentionExpiration, until)
+	}
+
+	if err := e.Delete(ctx, "share.zip"); !errors.Is(err, gcsenhancer.ErrObjectHeld) {
+		t.Errorf("err = %v, want ErrObjectHeld before expiry", err)
+	}
+
+	// The later of the retention of the bucket and the one of the object.
+	if err := e.SetRetention(ctx, 72*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+
+	info, err = e.Upload(ctx, strings.NewReader("x"), "long.zip", gcsenhancer.UploadOptions{RetainUntil: until})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.RetentionExpiration.Before(before.Add(72 * time.Hour)) {
+		t.Errorf("expiration %v, want the one of the bucket policy", info.RetentionExpiration)
+	}
+
+	_, err = e.Upload(ctx, strings.NewReader("x"), "both.zip", gcsenhancer.UploadOptions{RetainFor: time.Hour, RetainUntil: until})
+
+	if !errors.Is(err, gcsenhancer.ErrConflictingRetention) {
+		t.Errorf("err = %v, want ErrConflictingRetention", err)
+	}
+}
+
+func TestUploadWithHolds(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	for name, opts := range map[string]gcsenhancer.UploadOptions{
+		"temporary.txt": {TemporaryHold: true},
+		"event.txt":     {EventBasedHold: true},
+	} {
+		if _, err := e.Upload(ctx, strings.NewReader("x"), name, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", name)
+
+		if obj.Attrs.TemporaryHold != opts.TemporaryHold || obj.Attrs.EventBasedHold != opts.EventBasedHold {
+			t.Errorf("%s: holds temporary=%v event=%v, want %+v", name, obj.Attrs.TemporaryHold, obj.Attrs.EventBasedHold, opts)
+		}
+
+		err := e.Delete(ctx, name)
+
+		if !errors.Is(err, gcsenhancer.ErrObjectHeld) || !strings.Contains(err.Error(), "hold") {
+			t.Errorf("%s: err = %v, want ErrObjectHeld naming the hold", name, err)
+		}
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpDelete)); n != 0 {
+		t.Errorf("%d deletes sent for held objects", n)
+	}
+
+	release := storage.ObjectAttrsToUpdate{TemporaryHold: false}
+
+	if _, err := e.UpdateMetadata(ctx, "temporary.txt", release); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Delete(ctx, "temporary.txt"); err != nil {
+		t.Errorf("delete after releasing the hold: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+)
+
+const retryBaseDelay = 200 * time.Millisecond
+
+// maxRetryDelay caps the delays of ExponentialBackoff without a MaxDelay.
+const maxRetryDelay = time.Minute
+
+// RetryPolicy decides whether, and after how long, a failed write is retried.
+// attempt is the 0-based number of the failed attempt. Policies can inspect
+// err, e.g. a *googleapi.Error, to honor the Retry-After of a 429. They are
+// only consulted for transient errors, see isTransient; others, like a 412
+// of a failed precondition, fail the upload right away.
+type RetryPolicy interface {
+	NextDelay(attempt int, err error) (time.Duration, bool)
+}
+
+// ExponentialBackoff retries after BaseDelay, doubled at every attempt and
+// capped to MaxDelay when positive, to a minute otherwise.
+type ExponentialBackoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, err error) (time.Duration, bool) {
+	max := b.MaxDelay
+
+	if max <= 0 {
+		max = maxRetryDelay
+	}
+
+	// Doubling past max, or past the width of Duration, is capped.
+	delay := b.BaseDelay
+
+	for i := 0; i < attempt && delay < max; i++ {
+		delay <<= 1
+	}
+
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+
+	return delay, true
+}
+
+// WithRetryPolicy sets the policy consulted between the retries of uploads,
+// see UploadOptions.Retries, which still bounds the number of retries.
+// Defaults to ExponentialBackoff starting at 200ms.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(e *GCSEnhancer) {
+		e.retryPolicy = p
+	}
+}
+
+// WithRetryer sets the retry options of the storage client, e.g.
+// storage.WithBackoff or storage.WithPolicy(storage.RetryAlways), for every
+// operation of the enhancer. They apply to the calls of the client, whereas
+// RetryPolicy and UploadOptions.Retries replay whole uploads. Timeouts are
+// taken from the deadline of the context of each call.
+func WithRetryer(opts ...storage.RetryOption) Option {
+	return func(e *GCSEnhancer) {
+		e.retryOptions = opts
+	}
+}
+
+// bucket returns the handle of the bucket name configured with the retry
+// options of the enhancer.
+func (e *GCSEnhancer) bucket(name string) BucketHandle {
+	bucket := e.client.Bucket(name)
+
+	if len(e.retryOptions) > 0 {
+		bucket = bucket.Retryer(e.retryOptions...)
+	}
+
+	return bucket
+}
+
+// writeWithRetry writes r to object, retrying up to opts.Retries times. r must
+// be an io.Seeker when retries are enabled so the body can be replayed.
+func (e *GCSEnhancer) writeWithRetry(ctx context.Context, object ObjectHandle, r io.Reader, opts UploadOptions) (int64, error) {
+	seeker, canReplay := r.(io.Seeker)
+
+	var start int64
+
+	if canReplay && opts.Retries > 0 {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+
+		if err != nil {
+			return 0, err
+		}
+
+		start = offset
+	}
+
+	for attempt := 0; ; attempt++ {
+		n, err := e.writeObject(ctx, object, r, opts)
+
+		if err == nil {
+			return n, nil
+		}
+
+		if !canReplay || attempt >= opts.Retries || ctx.Err() != nil || !isTransient(err) {
+			return n, err
+		}
+
+		delay, retry := e.retryPolicy.NextDelay(attempt, err)
+
+		if !retry {
+			return n, err
+		}
+
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isTransient reports whether err, of a failed write, may not happen again:
+// timeouts, rate limiting and server errors of GCS, and network errors.
+func isTransient(err error) bool {
+	var apiErr *googleapi.Error
+
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusRequestTimeout ||
+			apiErr.Code == http.StatusTooManyRequests ||
+			apiErr.Code >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
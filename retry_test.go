@@ -0,0 +1,267 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+	"google.golang.org/api/googleapi"
+)
+
+// retryOn retries the errors of the listed status codes, recording every
+// consultation.
+type retryOn struct {
+	codes    []int
+	attempts []int
+}
+
+func (p *retryOn) NextDelay(attempt int, err error) (time.Duration, bool) {
+	p.attempts = append(p.attempts, attempt)
+
+	var gerr *googleapi.Error
+
+	if errors.As(err, &gerr) {
+		for _, code := range p.codes {
+			if gerr.Code == code {
+				return time.Millisecond, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// failWritesWith fails the writes to the fake with the given status codes,
+// in order.
+func failWritesWith(fake *gcstest.Storage, codes ...int) {
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op != gcstest.OpWrite || len(codes) == 0 {
+			return nil
+		}
+
+		code := codes[0]
+		codes = codes[1:]
+
+		return &googleapi.Error{Code: code}
+	})
+}
+
+func TestCustomRetryPolicy(t *testing.T) {
+	policy := &retryOn{codes: []int{http.StatusTooManyRequests}}
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithRetryPolicy(policy))
+
+	failWritesWith(fake, http.StatusTooManyRequests, http.StatusTooManyRequests)
+
+	if _, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{Retries: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(policy.attempts, []int{0, 1}) {
+		t.Errorf("policy consulted for attempts %v, want [0 1]", policy.attempts)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 3 {
+		t.Errorf("%d writes, want 3", n)
+	}
+}
+
+func TestCustomRetryPolicyGivesUp(t *testing.T) {
+	policy := &retryOn{codes: []int{http.StatusTooManyRequests}}
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithRetryPolicy(policy))
+
+	failWritesWith(fake, http.StatusTooManyRequests, http.StatusForbidden)
+
+	_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{Retries: 5})
+
+	var gerr *googleapi.Error
+
+	if !errors.As(err, &gerr) || gerr.Code != http.StatusForbidden {
+		t.Fatalf("err = %v, want the 403 the policy gave up on", err)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 2 {
+		t.Errorf("%d writes, want 2", n)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := gcsenhancer.ExponentialBackoff{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt, want := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		delay, retry := b.NextDelay(attempt, nil)
+
+		if !retry || delay != want {
+			t.Errorf("attempt %d: %v, %v, want %v", attempt, delay, retry, want)
+		}
+	}
+
+	// Shifting past the width of Duration is capped too.
+	if delay, _ := b.NextDelay(80, nil); delay != time.Second {
+		t.Errorf("attempt 80: %v, want the cap", delay)
+	}
+
+	// Without MaxDelay, delays stop doubling at a minute.
+	b = gcsenhancer.ExponentialBackoff{BaseDelay: 200 * time.Millisecond}
+
+	for _, attempt := range []int{9, 40, 63, 80} {
+		if delay, _ := b.NextDelay(attempt, nil); delay != time.Minute {
+			t.Errorf("attempt %d without MaxDelay: %v, want a minute", attempt, delay)
+		}
+	}
+}
+
+func TestUploadRetriesTransientErrorsOnly(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		err    error
+		writes int
+	}{
+		{"503", &googleapi.Error{Code: http.StatusServiceUnavailable}, 2},
+		{"429", &googleapi.Error{Code: http.StatusTooManyRequests}, 2},
+		{"network", &net.OpError{Op: "write", Net: "tcp", Err: syscall.ECONNRESET}, 2},
+		{"412", &googleapi.Error{Code: http.StatusPreconditionFailed}, 1},
+		{"403", &googleapi.Error{Code: http.StatusForbidden}, 1},
+		{"other", errors.New("boom"), 1},
+	} {
+		policy := &retryAll{}
+
+		fake := gcstest.New()
+		e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithRetryPolicy(policy))
+
+		failed := false
+		fake.Intercept(func(c gcstest.Call) error {
+			if c.Op == gcstest.OpWrite && !failed {
+				failed = true
+
+				return tt.err
+			}
+
+			return nil
+		})
+
+		_, err := e.Upload(context.Background(), strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{Retries: 3})
+
+		if n := len(fake.CallsTo(gcstest.OpWrite)); n != tt.writes {
+			t.Errorf("%s: %d writes, want %d", tt.name, n, tt.writes)
+		}
+
+		if retried := tt.writes > 1; retried != (err == nil) || retried != (policy.calls > 0) {
+			t.Errorf("%s: err = %v, policy consulted %d times", tt.name, err, policy.calls)
+		}
+	}
+}
+
+// retryAll retries any error it is consulted for, right away.
+type retryAll struct {
+	calls int
+}
+
+func (p *retryAll) NextDelay(attempt int, err error) (time.Duration, bool) {
+	p.calls++
+
+	return 0, true
+}
+
+// retryerRecorder is a storage recording the buckets handed out and the retry
+// options set on them.
+type retryerRecorder struct {
+	gcsenhancer.Storage
+
+	mu       sync.Mutex
+	buckets  int
+	retryers [][]storage.RetryOption
+}
+
+func (s *retryerRecorder) Bucket(name string) gcsenhancer.BucketHandle {
+	s.mu.Lock()
+	s.buckets++
+	s.mu.Unlock()
+
+	return recordingBucket{s.Storage.Bucket(name), s}
+}
+
+type recordingBucket struct {
+	gcsenhancer.BucketHandle
+	s *retryerRecorder
+}
+
+func (b recordingBucket) Retryer(opts ...storage.RetryOption) gcsenhancer.BucketHandle {
+	b.s.mu.Lock()
+	b.s.retryers = append(b.s.retryers, opts)
+	b.s.mu.Unlock()
+
+	return recordingBucket{b.BucketHandle.Retryer(opts...), b.s}
+}
+
+func TestRetryerAppliedToOperations(t *testing.T) {
+	for _, configured := range []bool{true, false} {
+		rec := &retryerRecorder{Storage: gcstest.New()}
+
+		var opts []gcsenhancer.Option
+
+		if configured {
+			opts = append(opts, gcsenhancer.WithRetryer(
+				storage.WithPolicy(storage.RetryAlways),
+				storage.WithErrorFunc(func(err error) bool { return err != nil }),
+			))
+		}
+
+		e := gcsenhancer.NewWithStorage(rec, "bucket", opts...)
+		ctx := context.Background()
+
+		if _, err := e.Upload(ctx, strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		body, _, err := e.Download(ctx, "a.txt", gcsenhancer.DownloadOptions{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body.Close()
+
+		if err := e.Delete(ctx, "a.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		if !configured {
+			if len(rec.retryers) != 0 {
+				t.Errorf("retry options set %d times without WithRetryer", len(rec.retryers))
+			}
+
+			continue
+		}
+
+		if rec.buckets == 0 || len(rec.retryers) != rec.buckets {
+			t.Errorf("retry options set on %d of %d buckets, want all", len(rec.retryers), rec.buckets)
+		}
+
+		for _, got := range rec.retryers {
+			if len(got) != 2 {
+				t.Errorf("retryer set with %d options, want the 2 configured", len(got))
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// DefaultSignedURLExpiry is the lifetime of the signed links returned for
+// objects of a private enhancer.
+const DefaultSignedURLExpiry = 15 * time.Minute
+
+var ErrContentTypeRequired = errors.New("gcsenhancer: content type is required")
+
+// SignedUploadURL generates a V4 signed URL the browser can PUT the object to
+// directly. The content type is part of the signature so the client has to
+// send the exact same Content-Type header, otherwise GCS rejects the upload.
+func (e *GCSEnhancer) SignedUploadURL(objectName string, expiry time.Duration, contentType string) (string, error) {
+	if contentType == "" {
+		return "", ErrContentTypeRequired
+	}
+
+	bucket := e.bucket(e.bucketName)
+
+	return bucket.SignedURL(objectName, &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      http.MethodPut,
+		Expires:     time.Now().Add(expiry),
+		ContentType: contentType,
+	})
+}
+
+// ResponseOverrides override headers of the response served for a signed
+// download URL.
+type ResponseOverrides struct {
+	// ResponseContentDisposition, e.g. `attachment; filename="report.pdf"`,
+	// forces browsers to download the object under the given filename.
+	ResponseContentDisposition string
+	ResponseContentType        string
+}
+
+// SignedURL generates a V4 signed URL to download the object.
+func (e *GCSEnhancer) SignedURL(objectName string, expiry time.Duration) (string, error) {
+	return e.SignedDownloadURL(objectName, expiry, ResponseOverrides{})
+}
+
+// SignedDownloadURL generates a V4 signed URL to download the object with the
+// given response header overrides. The overrides are part of the signature,
+// so they can not be altered by the client.
+func (e *GCSEnhancer) SignedDownloadURL(objectName string, expiry time.Duration, overrides ResponseOverrides) (string, error) {
+	return e.signedDownloadURL(e.bucketName, objectName, expiry, overrides)
+}
+
+func (e *GCSEnhancer) signedDownloadURL(bucketName, objectName string, expiry time.Duration, overrides ResponseOverrides) (string, error) {
+	bucket := e.bucket(bucketName)
+
+	query := url.Values{}
+
+	if overrides.ResponseContentDisposition != "" {
+		query.Set("response-content-disposition", overrides.ResponseContentDisposition)
+	}
+
+	if overrides.ResponseContentType != "" {
+		query.Set("response-content-type", overrides.ResponseContentType)
+	}
+
+	return bucket.SignedURL(objectName, &storage.SignedURLOptions{
+		Scheme:          storage.SigningSchemeV4,
+		Method:          http.MethodGet,
+		Expires:         time.Now().Add(expiry),
+		QueryParameters: query,
+	})
+}
+
+// UploadLinks are both links of an upload, so callers can store the one they
+// need, e.g. the signed link for assets that may become private.
+type UploadLinks struct {
+	PublicLink string
+	SignedLink string
+}
+
+// UploadBoth uploads the file like Upload and returns both its public link
+// and a link signed for expiry, DefaultSignedURLExpiry when not positive. The
+// public link is only served once the object is public, see
+// UploadOptions.PublicAccess.
+func (e *GCSEnhancer) UploadBoth(ctx context.Context, file io.Reader, uploadFilename string, opts UploadOptions, expiry time.Duration) (*UploadLinks, error) {
+	info, err := e.Upload(ctx, file, uploadFilename, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if expiry <= 0 {
+		expiry = DefaultSignedURLExpiry
+	}
+
+	signed, err := e.SignedURL(info.Filename, expiry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	links := &UploadLinks{
+		PublicLink: info.PublicLink,
+		SignedLink: signed,
+	}
+
+	// A private enhancer returns a signed link from Upload.
+	if !e.public {
+		links.PublicLink = hostURL(&storage.ObjectAttrs{
+			Bucket: e.bucketName,
+			Name:   info.Filename,
+		}, opts.Host).String()
+	}
+
+	return links, nil
+}
+
+// SignedURLErrors maps the names SignedURLs failed to sign to their error.
+type SignedURLErrors map[string]error
+
+func (errs SignedURLErrors) Error() string {
+	names := make([]string, 0, len(errs))
+
+	for name := range errs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return fmt.Sprintf("gcsenhancer: failed to sign %d URLs, first %s: %v", len(errs), names[0], errs[names[0]])
+}
+
+// SignedURLs signs download URLs of names valid for expiry, in parallel since
+// signing through the IAM API is a network call, and returns them by name.
+// Names that fail to sign are left out of the map and reported in a
+// SignedURLErrors, the others are still returned.
+func (e *GCSEnhancer) SignedURLs(names []string, expiry time.Duration) (map[string]string, error) {
+	signed := make([]string, len(names))
+	errs := make([]error, len(names))
+
+	// Errors are collected per name rather than returned, so that a single
+	// failure doesn't cancel the signing of the others.
+	e.runBounded(context.Background(), len(names), func(ctx context.Context, i int) error {
+		signed[i], errs[i] = e.SignedURL(names[i], expiry)
+
+		return nil
+	})
+
+	urls := make(map[string]string, len(names))
+	failed := SignedURLErrors{}
+
+	for i, name := range names {
+		if errs[i] != nil {
+			failed[name] = errs[i]
+
+			continue
+		}
+
+		urls[name] = signed[i]
+	}
+
+	if len(failed) > 0 {
+		return urls, failed
+	}
+
+	return urls, nil
+}
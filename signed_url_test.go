@@ -0,0 +1,182 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func parseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+func TestSignedUploadURL(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	raw, err := e.SignedUploadURL("uploads/cat.png", 10*time.Minute, "image/png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := parseURL(t, raw)
+	q := u.Query()
+
+	if u.Path != "/bucket/uploads/cat.png" {
+		t.Errorf("path = %q", u.Path)
+	}
+
+	if q.Get("X-Goog-Method") != "PUT" {
+		t.Errorf("signed for %q, want PUT", q.Get("X-Goog-Method"))
+	}
+
+	if q.Get("X-Goog-Content-Type") != "image/png" {
+		t.Errorf("content type bound %q, want image/png", q.Get("X-Goog-Content-Type"))
+	}
+
+	if len(fake.CallsTo(gcstest.OpSignURL)) != 1 {
+		t.Error("URL not signed by the storage")
+	}
+}
+
+func TestSignedUploadURLRequiresContentType(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.SignedUploadURL("a.png", time.Minute, ""); !errors.Is(err, gcsenhancer.ErrContentTypeRequired) {
+		t.Errorf("err = %v, want ErrContentTypeRequired", err)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpSignURL)); n != 0 {
+		t.Errorf("signed %d URLs, want none", n)
+	}
+}
+
+func TestSignedDownloadURLOverrides(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	raw, err := e.SignedDownloadURL("reports/2022.pdf", time.Minute, gcsenhancer.ResponseOverrides{
+		ResponseContentDisposition: `attachment; filename="report.pdf"`,
+		ResponseContentType:        "application/pdf",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := parseURL(t, raw).Query()
+
+	if got := q.Get("response-content-disposition"); got != `attachment; filename="report.pdf"` {
+		t.Errorf("response-content-disposition = %q", got)
+	}
+
+	if got := q.Get("response-content-type"); got != "application/pdf" {
+		t.Errorf("response-content-type = %q", got)
+	}
+
+	if q.Get("X-Goog-Method") != "GET" {
+		t.Errorf("signed for %q, want GET", q.Get("X-Goog-Method"))
+	}
+}
+
+func TestSignedURLWithoutOverrides(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	raw, err := e.SignedURL("a.pdf", time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range parseURL(t, raw).Query() {
+		if strings.HasPrefix(key, "response-") {
+			t.Errorf("unexpected override %s", key)
+		}
+	}
+}
+
+func TestUploadBoth(t *testing.T) {
+	for _, public := range []bool{true, false} {
+		e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket", gcsenhancer.WithPublic(public))
+		start := time.Now()
+
+		links, err := e.UploadBoth(context.Background(), strings.NewReader("x"), "img/a.png", gcsenhancer.UploadOptions{}, time.Hour)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if links.PublicLink != "https://storage.googleapis.com/bucket/img/a.png" {
+			t.Errorf("public %v: public link = %q", public, links.PublicLink)
+		}
+
+		signed := parseURL(t, links.SignedLink)
+
+		if signed.Path != "/bucket/img/a.png" || signed.Query().Get("X-Goog-Signature") == "" {
+			t.Errorf("public %v: signed link = %q, want a signed link of img/a.png", public, links.SignedLink)
+		}
+
+		expires, err := strconv.ParseInt(signed.Query().Get("X-Goog-Expires"), 10, 64)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := time.Unix(expires, 0).Sub(start); got < time.Hour-time.Second || got > time.Hour+time.Minute {
+			t.Errorf("public %v: signed link expires in %v, want an hour", public, got)
+		}
+	}
+}
+
+func TestSignedURLs(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpSignURL && c.Object == "thumbs/bad.png" {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	names := []string{"thumbs/1.png", "thumbs/2.png", "thumbs/3.png", "thumbs/bad.png"}
+
+	urls, err := e.SignedURLs(names, time.Minute)
+
+	var failed gcsenhancer.SignedURLErrors
+
+	if !errors.As(err, &failed) || len(failed) != 1 || !errors.Is(failed["thumbs/bad.png"], errDenied) {
+		t.Fatalf("err = %v, want only thumbs/bad.png failed", err)
+	}
+
+	if len(urls) != 3 {
+		t.Fatalf("%d URLs, want 3", len(urls))
+	}
+
+	for _, name := range names[:3] {
+		u := parseURL(t, urls[name])
+
+		if u.Path != "/bucket/"+name || u.Query().Get("X-Goog-Signature") == "" {
+			t.Errorf("%s signed as %s", name, urls[name])
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package gcsenhancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// defaultChunkSize mirrors the default chunk size of storage.Writer.
+const defaultChunkSize = 16 << 20
+
+var ErrSizeMismatch = errors.New("gcsenhancer: size mismatch")
+
+// UploadSized uploads exactly size bytes read from r, e.g. a request body of
+// known Content-Length. The upload is aborted with ErrSizeMismatch when r
+// yields fewer or more bytes than size.
+func (e *GCSEnhancer) UploadSized(ctx context.Context, r io.Reader, size int64, name string) (*UploadedFileInfo, error) {
+	opts := UploadOptions{}
+
+	// Small objects fit in a single request, no need for a 16MiB buffer.
+	if size < defaultChunkSize {
+		opts.ChunkSize = int(size) + 1
+	}
+
+	return e.Upload(ctx, &sizedReader{r: r, size: size, remaining: size}, name, opts)
+}
+
+// sizedReader fails the read once r turns out to be shorter or longer than size.
+type sizedReader struct {
+	r         io.Reader
+	size      int64
+	remaining int64
+	probe     [1]byte
+}
+
+func (s *sizedReader) Read(p []byte) (int, error) {
+	if s.remaining <= 0 {
+		// Every expected byte is read, any further byte means r is oversized.
+		n, err := s.r.Read(s.probe[:])
+
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrSizeMismatch, s.size)
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+
+	n, err := s.r.Read(p)
+	s.remaining -= int64(n)
+
+	if err == io.EOF && s.remaining > 0 {
+		return n, fmt.Errorf("%w: got %d of %d bytes", ErrSizeMismatch, s.size-s.remaining, s.size)
+	}
+
+	return n, err
+}
@@ -0,0 +1,52 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadSized(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		size    int64
+		wantErr bool
+	}{
+		{"exact", "hello", 5, false},
+		{"short", "hell", 5, true},
+		{"over", "hello!", 5, true},
+		{"empty", "", 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gcstest.New()
+			e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+			_, err := e.UploadSized(context.Background(), strings.NewReader(tt.content), tt.size, "a.txt")
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if obj, _ := fake.Object("bucket", "a.txt"); string(obj.Content) != tt.content {
+					t.Errorf("content = %q, want %q", obj.Content, tt.content)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, gcsenhancer.ErrSizeMismatch) {
+				t.Fatalf("err = %v, want ErrSizeMismatch", err)
+			}
+
+			if _, ok := fake.Object("bucket", "a.txt"); ok {
+				t.Error("object stored despite the size mismatch")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package gcsenhancer
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// DeletedAtMetadataKey is the metadata key of the tombstone set by SoftDelete.
+const DeletedAtMetadataKey = "deleted-at"
+
+// SoftDelete marks the object as deleted, without removing it, by setting
+// the DeletedAtMetadataKey tombstone. Soft deleted objects are left out of
+// listings and can be brought back with Restore.
+func (e *GCSEnhancer) SoftDelete(ctx context.Context, name string) error {
+	_, err := e.UpdateMetadata(ctx, name, storage.ObjectAttrsToUpdate{
+		Metadata: map[string]string{
+			DeletedAtMetadataKey: time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+
+	return err
+}
+
+// Restore removes the tombstone of a soft deleted object.
+func (e *GCSEnhancer) Restore(ctx context.Context, name string) error {
+	_, err := e.UpdateMetadata(ctx, name, storage.ObjectAttrsToUpdate{
+		Metadata: map[string]string{
+			DeletedAtMetadataKey: "",
+		},
+	})
+
+	return err
+}
+
+func isSoftDeleted(attr *storage.ObjectAttrs) bool {
+	_, ok := attr.Metadata[DeletedAtMetadataKey]
+
+	return ok
+}
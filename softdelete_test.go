@@ -0,0 +1,74 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func listed(t *testing.T, e *gcsenhancer.GCSEnhancer, includeDeleted bool) []string {
+	t.Helper()
+
+	objects, err := e.List(context.Background(), "", includeDeleted)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, obj := range objects {
+		names = append(names, obj.Name)
+	}
+
+	return names
+}
+
+func TestSoftDeleteLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "a.txt", []byte("a"), storage.ObjectAttrs{Metadata: map[string]string{"owner": "7"}})
+	fake.Put("bucket", "b.txt", []byte("b"), storage.ObjectAttrs{})
+
+	if err := e.SoftDelete(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, ok := fake.Object("bucket", "a.txt")
+
+	if !ok {
+		t.Fatal("soft deleted object removed")
+	}
+
+	if obj.Attrs.Metadata[gcsenhancer.DeletedAtMetadataKey] == "" {
+		t.Errorf("metadata = %v, want a tombstone", obj.Attrs.Metadata)
+	}
+
+	if got := listed(t, e, false); !reflect.DeepEqual(got, []string{"b.txt"}) {
+		t.Errorf("listed %v, want the soft deleted object left out", got)
+	}
+
+	if got := listed(t, e, true); !reflect.DeepEqual(got, []string{"a.txt", "b.txt"}) {
+		t.Errorf("listed %v with deleted objects, want both", got)
+	}
+
+	if err := e.Restore(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ = fake.Object("bucket", "a.txt")
+
+	if want := map[string]string{"owner": "7"}; !reflect.DeepEqual(obj.Attrs.Metadata, want) {
+		t.Errorf("restored metadata = %v, want %v", obj.Attrs.Metadata, want)
+	}
+
+	if got := listed(t, e, false); !reflect.DeepEqual(got, []string{"a.txt", "b.txt"}) {
+		t.Errorf("listed %v, want the restored object back", got)
+	}
+}
@@ -0,0 +1,57 @@
+package gcsenhancer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+var ErrObjectNotFound = errors.New("gcsenhancer: object not found")
+
+// FileInfo is a trimmed down, stable view of storage.ObjectAttrs.
+type FileInfo struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	Updated     time.Time `json:"updated"`
+	Link        string    `json:"link"`
+
+	// MD5 is the hex encoded MD5 hash of the content. It is empty for
+	// composite objects.
+	MD5 string `json:"md5"`
+
+	// CRC32C is the hex encoded CRC32C checksum of the content.
+	CRC32C string `json:"crc32c"`
+}
+
+// Stat returns the file info of the object, or ErrObjectNotFound when the
+// object doesn't exist.
+func (e *GCSEnhancer) Stat(ctx context.Context, name string) (FileInfo, error) {
+	attr, err := e.bucket(e.bucketName).Object(name).Attrs(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return FileInfo{}, fmt.Errorf("%w: %s", ErrObjectNotFound, name)
+	}
+
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return e.fileInfo(attr), nil
+}
+
+func (e *GCSEnhancer) fileInfo(attr *storage.ObjectAttrs) FileInfo {
+	return FileInfo{
+		Name:        attr.Name,
+		Size:        attr.Size,
+		ContentType: attr.ContentType,
+		Updated:     attr.Updated,
+		Link:        e.objectLink(attr, "").PublicLink,
+		MD5:         hex.EncodeToString(attr.MD5),
+		CRC32C:      fmt.Sprintf("%08x", attr.CRC32C),
+	}
+}
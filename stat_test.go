@@ -0,0 +1,61 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestStat(t *testing.T) {
+	fake := gcstest.New()
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	fake.SetClock(func() time.Time { return now })
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	info, err := e.Upload(context.Background(), strings.NewReader("hello"), "docs/a.txt", gcsenhancer.UploadOptions{
+		PublicAccess: true,
+		ContentType:  "text/plain",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := e.Stat(context.Background(), "docs/a.txt")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := md5.Sum([]byte("hello"))
+
+	want := gcsenhancer.FileInfo{
+		Name:        "docs/a.txt",
+		Size:        5,
+		ContentType: "text/plain",
+		Updated:     now,
+		Link:        info.PublicLink,
+		MD5:         hex.EncodeToString(sum[:]),
+		CRC32C:      "9a71bb4c",
+	}
+
+	if fi != want {
+		t.Errorf("Stat = %+v, want %+v", fi, want)
+	}
+}
+
+func TestStatNotFound(t *testing.T) {
+	e := gcsenhancer.NewWithStorage(gcstest.New(), "bucket")
+
+	if _, err := e.Stat(context.Background(), "missing.txt"); !errors.Is(err, gcsenhancer.ErrObjectNotFound) {
+		t.Errorf("err = %v, want ErrObjectNotFound", err)
+	}
+}
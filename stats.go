@@ -0,0 +1,43 @@
+package gcsenhancer
+
+import "sync/atomic"
+
+// Stats is a snapshot of the counters of an enhancer.
+type Stats struct {
+	Uploads       int64
+	Failures      int64
+	BytesUploaded int64
+}
+
+// stats is shared by every goroutine using the enhancer, its fields must only
+// be accessed atomically.
+type stats struct {
+	uploads  int64
+	failures int64
+	bytes    int64
+}
+
+func (s *stats) record(err error) {
+	if err != nil {
+		atomic.AddInt64(&s.failures, 1)
+
+		return
+	}
+
+	atomic.AddInt64(&s.uploads, 1)
+}
+
+func (s *stats) addBytes(n int64) {
+	atomic.AddInt64(&s.bytes, n)
+}
+
+// Stats returns the number of succeeded / failed uploads and the bytes
+// uploaded by the enhancer so far. It is safe to call concurrently with the
+// upload methods.
+func (e *GCSEnhancer) Stats() Stats {
+	return Stats{
+		Uploads:       atomic.LoadInt64(&e.stats.uploads),
+		Failures:      atomic.LoadInt64(&e.stats.failures),
+		BytesUploaded: atomic.LoadInt64(&e.stats.bytes),
+	}
+}
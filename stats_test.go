@@ -0,0 +1,73 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// TestConcurrentUploadStats hammers a single enhancer from 50 goroutines, run
+// it with -race.
+func TestConcurrentUploadStats(t *testing.T) {
+	const (
+		goroutines = 50
+		uploads    = 4
+	)
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithCacheBusting())
+
+	// The last upload of every goroutine fails.
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && strings.HasSuffix(c.Object, fmt.Sprintf("-%d.txt", uploads-1)) {
+			return errors.New("denied")
+		}
+
+		return nil
+	})
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < uploads; i++ {
+				name := fmt.Sprintf("g%02d-%d.txt", g, i)
+
+				e.Upload(context.Background(), strings.NewReader("0123456789"), name, gcsenhancer.UploadOptions{})
+
+				// Reading the stats races with the uploads of the others.
+				e.Stats()
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	stats := e.Stats()
+
+	if want := int64(goroutines * (uploads - 1)); stats.Uploads != want {
+		t.Errorf("%d uploads, want %d", stats.Uploads, want)
+	}
+
+	if want := int64(goroutines); stats.Failures != want {
+		t.Errorf("%d failures, want %d", stats.Failures, want)
+	}
+
+	if want := int64(goroutines * (uploads - 1) * 10); stats.BytesUploaded != want {
+		t.Errorf("%d bytes uploaded, want %d", stats.BytesUploaded, want)
+	}
+
+	if n := len(fake.Objects("bucket")); n != goroutines*(uploads-1) {
+		t.Errorf("%d objects stored, want %d", n, goroutines*(uploads-1))
+	}
+}
@@ -0,0 +1,216 @@
+package gcsenhancer
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/storage"
+)
+
+// Storage is the part of the storage client the enhancer uses, so it can run
+// against another implementation, e.g. the in-memory fake of package gcstest.
+// NewGCSEnhancer wraps a *storage.Client.
+type Storage interface {
+	Bucket(name string) BucketHandle
+}
+
+// BucketHandle mirrors storage.BucketHandle.
+type BucketHandle interface {
+	Object(name string) ObjectHandle
+	Objects(ctx context.Context, q *storage.Query) ObjectIterator
+	Attrs(ctx context.Context) (*storage.BucketAttrs, error)
+	Update(ctx context.Context, uattrs storage.BucketAttrsToUpdate) (*storage.BucketAttrs, error)
+	If(conds storage.BucketConditions) BucketHandle
+	LockRetentionPolicy(ctx context.Context) error
+	Retryer(opts ...storage.RetryOption) BucketHandle
+
+	// IAMPolicy returns the IAM policy of the bucket, see storage.BucketHandle.IAM.
+	IAMPolicy(ctx context.Context) (*iam.Policy, error)
+
+	SignedURL(object string, opts *storage.SignedURLOptions) (string, error)
+	GenerateSignedPostPolicyV4(object string, opts *storage.PostPolicyV4Options) (*storage.PostPolicyV4, error)
+}
+
+// ObjectHandle mirrors storage.ObjectHandle.
+type ObjectHandle interface {
+	ObjectName() string
+	BucketName() string
+	Attrs(ctx context.Context) (*storage.ObjectAttrs, error)
+	Update(ctx context.Context, uattrs storage.ObjectAttrsToUpdate) (*storage.ObjectAttrs, error)
+	Delete(ctx context.Context) error
+	If(conds storage.Conditions) ObjectHandle
+	Generation(gen int64) ObjectHandle
+	ACL() ACLHandle
+	NewReader(ctx context.Context) (ObjectReader, error)
+	NewRangeReader(ctx context.Context, offset, length int64) (ObjectReader, error)
+	NewWriter(ctx context.Context) ObjectWriter
+	CopierFrom(src ObjectHandle) ObjectCopier
+	ComposerFrom(srcs ...ObjectHandle) ObjectComposer
+}
+
+// ACLHandle mirrors storage.ACLHandle.
+type ACLHandle interface {
+	Set(ctx context.Context, entity storage.ACLEntity, role storage.ACLRole) error
+	List(ctx context.Context) ([]storage.ACLRule, error)
+}
+
+// ObjectIterator mirrors storage.ObjectIterator.
+type ObjectIterator interface {
+	Next() (*storage.ObjectAttrs, error)
+}
+
+// ObjectReader mirrors storage.Reader.
+type ObjectReader interface {
+	io.ReadCloser
+	Attrs() storage.ReaderObjectAttrs
+}
+
+// ObjectWriter mirrors storage.Writer. The attributes and options of the
+// write are set on Settings before the first Write.
+type ObjectWriter interface {
+	io.WriteCloser
+	Settings() *storage.Writer
+}
+
+// ObjectCopier mirrors storage.Copier. The attributes of the copy are set on
+// Settings before Run.
+type ObjectCopier interface {
+	Settings() *storage.Copier
+	Run(ctx context.Context) (*storage.ObjectAttrs, error)
+}
+
+// ObjectComposer mirrors storage.Composer. The attributes of the composite
+// object are set on Settings before Run.
+type ObjectComposer interface {
+	Settings() *storage.Composer
+	Run(ctx context.Context) (*storage.ObjectAttrs, error)
+}
+
+// ------------------- adapters of the storage client -------------------
+
+type gcsStorage struct {
+	client *storage.Client
+}
+
+func (s gcsStorage) Bucket(name string) BucketHandle {
+	return gcsBucket{s.client.Bucket(name)}
+}
+
+type gcsBucket struct {
+	*storage.BucketHandle
+}
+
+func (b gcsBucket) Object(name string) ObjectHandle {
+	return gcsObject{b.BucketHandle.Object(name)}
+}
+
+func (b gcsBucket) Objects(ctx context.Context, q *storage.Query) ObjectIterator {
+	return b.BucketHandle.Objects(ctx, q)
+}
+
+func (b gcsBucket) If(conds storage.BucketConditions) BucketHandle {
+	return gcsBucket{b.BucketHandle.If(conds)}
+}
+
+func (b gcsBucket) Retryer(opts ...storage.RetryOption) BucketHandle {
+	return gcsBucket{b.BucketHandle.Retryer(opts...)}
+}
+
+func (b gcsBucket) IAMPolicy(ctx context.Context) (*iam.Policy, error) {
+	return b.BucketHandle.IAM().Policy(ctx)
+}
+
+type gcsObject struct {
+	*storage.ObjectHandle
+}
+
+func (o gcsObject) If(conds storage.Conditions) ObjectHandle {
+	return gcsObject{o.ObjectHandle.If(conds)}
+}
+
+func (o gcsObject) Generation(gen int64) ObjectHandle {
+	return gcsObject{o.ObjectHandle.Generation(gen)}
+}
+
+func (o gcsObject) ACL() ACLHandle {
+	return o.ObjectHandle.ACL()
+}
+
+func (o gcsObject) NewReader(ctx context.Context) (ObjectReader, error) {
+	r, err := o.ObjectHandle.NewReader(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gcsReader{r}, nil
+}
+
+func (o gcsObject) NewRangeReader(ctx context.Context, offset, length int64) (ObjectReader, error) {
+	r, err := o.ObjectHandle.NewRangeReader(ctx, offset, length)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return gcsReader{r}, nil
+}
+
+func (o gcsObject) NewWriter(ctx context.Context) ObjectWriter {
+	return gcsWriter{o.ObjectHandle.NewWriter(ctx)}
+}
+
+func (o gcsObject) CopierFrom(src ObjectHandle) ObjectCopier {
+	return gcsCopier{o.ObjectHandle.CopierFrom(src.(gcsObject).ObjectHandle)}
+}
+
+func (o gcsObject) ComposerFrom(srcs ...ObjectHandle) ObjectComposer {
+	handles := make([]*storage.ObjectHandle, len(srcs))
+
+	for i, src := range srcs {
+		handles[i] = src.(gcsObject).ObjectHandle
+	}
+
+	return gcsComposer{o.ObjectHandle.ComposerFrom(handles...)}
+}
+
+type gcsReader struct {
+	r *storage.Reader
+}
+
+func (r gcsReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (r gcsReader) Close() error {
+	return r.r.Close()
+}
+
+func (r gcsReader) Attrs() storage.ReaderObjectAttrs {
+	return r.r.Attrs
+}
+
+type gcsWriter struct {
+	*storage.Writer
+}
+
+func (w gcsWriter) Settings() *storage.Writer {
+	return w.Writer
+}
+
+type gcsCopier struct {
+	*storage.Copier
+}
+
+func (c gcsCopier) Settings() *storage.Copier {
+	return c.Copier
+}
+
+type gcsComposer struct {
+	*storage.Composer
+}
+
+func (c gcsComposer) Settings() *storage.Composer {
+	return c.Composer
+}
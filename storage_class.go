@@ -0,0 +1,70 @@
+package gcsenhancer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"cloud.google.com/go/storage"
+)
+
+// ChangeStorageClass moves every object under prefix to newClass, e.g.
+// "COLDLINE", and returns the number of objects moved. The storage class of
+// an object can only be changed by rewriting it, objects are thus copied onto
+// themselves in parallel, guarded by their generation so concurrent writes
+// are not overwritten. Objects already in newClass are skipped.
+//
+// Rewriting an object changes its generation and resets its age, which
+// lifecycle rules based on age rely on. On buckets without uniform
+// bucket-level access the rewritten objects get the default object ACL of
+// the bucket, publicly readable objects are kept public.
+func (e *GCSEnhancer) ChangeStorageClass(ctx context.Context, prefix, newClass string) (int, error) {
+	objects, err := e.listWithACL(ctx, prefix)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+
+	err = e.runBounded(ctx, len(objects), func(ctx context.Context, i int) error {
+		attr := objects[i]
+
+		if attr.StorageClass == newClass {
+			return nil
+		}
+
+		object := e.bucket(e.bucketName).Object(attr.Name)
+
+		copier := object.
+			If(storage.Conditions{GenerationMatch: attr.Generation}).
+			CopierFrom(object.Generation(attr.Generation))
+		copier.Settings().StorageClass = newClass
+		copier.Settings().PredefinedACL = rewriteACL(attr)
+
+		if _, err := copier.Run(ctx); err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&count, 1)
+
+		return nil
+	})
+
+	return int(count), err
+}
+
+// listWithACL lists the objects under prefix, soft deleted ones included,
+// along with their ACL.
+func (e *GCSEnhancer) listWithACL(ctx context.Context, prefix string) ([]*storage.ObjectAttrs, error) {
+	return e.list(ctx, &storage.Query{Prefix: prefix, Projection: storage.ProjectionFull}, true)
+}
+
+// rewriteACL is the predefined ACL keeping the object attr public when
+// rewritten, rewrites getting the default object ACL of the bucket.
+func rewriteACL(attr *storage.ObjectAttrs) string {
+	if hasPublicRead(attr.ACL) {
+		return PredefinedACLPublicRead
+	}
+
+	return ""
+}
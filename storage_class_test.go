@@ -0,0 +1,65 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+var publicRead = []storage.ACLRule{{Entity: storage.AllUsers, Role: storage.RoleReader}}
+
+func TestChangeStorageClass(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	fake.Put("bucket", "old/a.txt", []byte("a"), storage.ObjectAttrs{ContentType: "text/plain", ACL: publicRead})
+	fake.Put("bucket", "old/b.txt", []byte("b"), storage.ObjectAttrs{})
+	fake.Put("bucket", "old/c.txt", []byte("c"), storage.ObjectAttrs{StorageClass: "COLDLINE"})
+	fake.Put("bucket", "new/d.txt", []byte("d"), storage.ObjectAttrs{})
+
+	n, err := e.ChangeStorageClass(context.Background(), "old/", "COLDLINE")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("moved %d objects, want 2", n)
+	}
+
+	for name, class := range map[string]string{
+		"old/a.txt": "COLDLINE",
+		"old/b.txt": "COLDLINE",
+		"old/c.txt": "COLDLINE",
+		"new/d.txt": "STANDARD",
+	} {
+		obj, _ := fake.Object("bucket", name)
+
+		if obj.Attrs.StorageClass != class {
+			t.Errorf("%s in %s, want %s", name, obj.Attrs.StorageClass, class)
+		}
+	}
+
+	a, _ := fake.Object("bucket", "old/a.txt")
+
+	if string(a.Content) != "a" || a.Attrs.ContentType != "text/plain" {
+		t.Errorf("rewrite changed the object: %q %s", a.Content, a.Attrs.ContentType)
+	}
+
+	if len(a.Attrs.ACL) != 1 || a.Attrs.ACL[0].Entity != storage.AllUsers {
+		t.Errorf("ACL = %v, want public kept", a.Attrs.ACL)
+	}
+
+	if b, _ := fake.Object("bucket", "old/b.txt"); len(b.Attrs.ACL) != 0 {
+		t.Errorf("ACL = %v, want private kept", b.Attrs.ACL)
+	}
+
+	for _, c := range fake.CallsTo(gcstest.OpCopy) {
+		if c.Conditions == nil || c.Conditions.GenerationMatch == 0 {
+			t.Errorf("rewrite of %s not guarded by its generation", c.Object)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package gcsenhancer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// chunkGranularity is the size resumable chunks, but the last, are a
+// multiple of.
+const chunkGranularity = 256 << 10
+
+// DefaultStreamBuffer is the default bound of the bytes UploadStream buffers.
+const DefaultStreamBuffer = 8 << 20
+
+// StreamOptions are the options of UploadStream. Streams go through a
+// resumable session, only the options sessions support are available.
+type StreamOptions struct {
+	// ContentType, ContentTypeFromExt, PredefinedACL and PublicAccess are
+	// those of UploadOptions.
+	ContentType        string
+	ContentTypeFromExt bool
+	PredefinedACL      string
+	PublicAccess       bool
+
+	// MaxBuffer bounds the bytes held in memory, it is rounded down to a
+	// multiple of 256KiB. A chunk is sent whenever the buffer is full.
+	// Defaults to DefaultStreamBuffer.
+	MaxBuffer int
+
+	// FlushInterval, when positive, sends the buffered bytes once that long
+	// passed since the last chunk, provided at least 256KiB are buffered,
+	// so a slow producer doesn't keep the upload idle.
+	FlushInterval time.Duration
+}
+
+// UploadStream uploads the content of a slow or unbounded producer, e.g. a
+// log or a transcoder, through a resumable session, see StartResumableUpload.
+// Unlike storage.Writer, which holds a whole ChunkSize before sending it,
+// memory stays bounded by MaxBuffer and buffered bytes are flushed every
+// FlushInterval. The interval is checked as reads return, a blocked read
+// delays the flush.
+func (e *GCSEnhancer) UploadStream(ctx context.Context, r io.Reader, name string, opts StreamOptions) (*UploadedFileInfo, error) {
+	size := opts.MaxBuffer
+
+	if size <= 0 {
+		size = DefaultStreamBuffer
+	}
+
+	size -= size % chunkGranularity
+
+	if size < chunkGranularity {
+		size = chunkGranularity
+	}
+
+	sessionURI, err := e.StartResumableUpload(ctx, name, UploadOptions{
+		ContentType:        opts.ContentType,
+		ContentTypeFromExt: opts.ContentTypeFromExt,
+		PredefinedACL:      opts.PredefinedACL,
+		PublicAccess:       opts.PublicAccess,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := e.sessionClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		buf       = make([]byte, size)
+		buffered  int
+		offset    int64
+		lastFlush = time.Now()
+	)
+
+	for {
+		n, err := r.Read(buf[buffered:])
+		buffered += n
+
+		if err == io.EOF {
+			info, _, err := e.sendChunk(ctx, client, sessionURI, buf[:buffered], offset, true)
+
+			return info, err
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		due := opts.FlushInterval > 0 && time.Since(lastFlush) >= opts.FlushInterval
+
+		if buffered < len(buf) && (!due || buffered < chunkGranularity) {
+			continue
+		}
+
+		chunk := buffered - buffered%chunkGranularity
+
+		_, persisted, err := e.sendChunk(ctx, client, sessionURI, buf[:chunk], offset, false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sent := int(persisted - offset)
+
+		if sent <= 0 || sent > chunk {
+			return nil, fmt.Errorf("gcsenhancer: session persisted %d bytes out of %d", persisted, offset+int64(chunk))
+		}
+
+		// The bytes not persisted are kept and sent again.
+		buffered = copy(buf, buf[sent:buffered])
+		offset = persisted
+		lastFlush = time.Now()
+	}
+}
@@ -0,0 +1,93 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// slowReader returns at most n bytes per read, pausing before each.
+type slowReader struct {
+	r     io.Reader
+	n     int
+	pause time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.pause)
+
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+
+	return r.r.Read(p)
+}
+
+func TestUploadStreamBoundsBuffer(t *testing.T) {
+	fake := gcstest.New()
+	srv := newSessionServer(t, fake)
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithAuthorizedClient(srv.Client()))
+
+	const maxBuffer = 512 << 10
+
+	data := bytes.Repeat([]byte("x"), 3<<20+1000)
+
+	_, err := e.UploadStream(context.Background(), &slowReader{r: bytes.NewReader(data), n: 64 << 10}, "log.txt", gcsenhancer.StreamOptions{
+		ContentType: "text/plain",
+		MaxBuffer:   maxBuffer,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "log.txt")
+
+	if !bytes.Equal(obj.Content, data) {
+		t.Fatalf("content differs, %d bytes stored", len(obj.Content))
+	}
+
+	if obj.Attrs.ContentType != "text/plain" {
+		t.Errorf("content type = %q", obj.Attrs.ContentType)
+	}
+
+	for i, n := range srv.chunks {
+		if n > maxBuffer {
+			t.Errorf("chunk %d of %d bytes exceeds the buffer bound", i, n)
+		}
+
+		if i < len(srv.chunks)-1 && n%(256<<10) != 0 {
+			t.Errorf("chunk %d of %d bytes not a multiple of 256KiB", i, n)
+		}
+	}
+}
+
+func TestUploadStreamFlushInterval(t *testing.T) {
+	fake := gcstest.New()
+	srv := newSessionServer(t, fake)
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithAuthorizedClient(srv.Client()))
+
+	data := bytes.Repeat([]byte("x"), 1<<20)
+
+	_, err := e.UploadStream(context.Background(), &slowReader{r: bytes.NewReader(data), n: 100 << 10, pause: 5 * time.Millisecond}, "log.txt", gcsenhancer.StreamOptions{
+		FlushInterval: 10 * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The default buffer holds the whole content, only flushes split it.
+	if len(srv.chunks) < 2 {
+		t.Errorf("%d chunks sent, want the slow producer flushed periodically", len(srv.chunks))
+	}
+
+	if obj, _ := fake.Object("bucket", "log.txt"); !bytes.Equal(obj.Content, data) {
+		t.Errorf("content differs, %d bytes stored", len(obj.Content))
+	}
+}
@@ -0,0 +1,62 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// unchanged tells whether object already holds the rest of rs, comparing
+// sizes and checksums: the CRC32C, and the MD5 unless the object is
+// composite. rs is rewound. The attributes of the existing object are
+// returned when unchanged.
+func unchanged(ctx context.Context, object ObjectHandle, rs io.ReadSeeker) (*storage.ObjectAttrs, bool, error) {
+	attr, err := object.Attrs(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The stored bytes of gzipped objects differ from the source.
+	if attr.ContentEncoding == "gzip" {
+		return nil, false, nil
+	}
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	crc := crc32.New(crc32cTable)
+	sum := md5.New()
+
+	size, err := io.Copy(io.MultiWriter(crc, sum), rs)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+
+	if size != attr.Size || crc.Sum32() != attr.CRC32C {
+		return nil, false, nil
+	}
+
+	if len(attr.MD5) > 0 && !bytes.Equal(sum.Sum(nil), attr.MD5) {
+		return nil, false, nil
+	}
+
+	return attr, true, nil
+}
@@ -0,0 +1,54 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadSkipUnchanged(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+	opts := gcsenhancer.UploadOptions{SkipUnchanged: true}
+
+	first, err := e.Upload(ctx, strings.NewReader("hello"), "a.txt", opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ := fake.Object("bucket", "a.txt")
+	gen := obj.Attrs.Generation
+
+	second, err := e.Upload(ctx, strings.NewReader("hello"), "a.txt", opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obj, _ := fake.Object("bucket", "a.txt"); obj.Attrs.Generation != gen {
+		t.Errorf("generation = %d, want %d kept", obj.Attrs.Generation, gen)
+	}
+
+	if n := len(fake.CallsTo(gcstest.OpWrite)); n != 1 {
+		t.Errorf("%d writes, want the identical upload skipped", n)
+	}
+
+	if second.PublicLink != first.PublicLink {
+		t.Errorf("link = %q, want the existing %q", second.PublicLink, first.PublicLink)
+	}
+
+	if _, err := e.Upload(ctx, strings.NewReader("hellO"), "a.txt", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _ = fake.Object("bucket", "a.txt")
+
+	if obj.Attrs.Generation == gen || string(obj.Content) != "hellO" {
+		t.Errorf("changed content not written, generation %d, content %q", obj.Attrs.Generation, obj.Content)
+	}
+}
@@ -0,0 +1,119 @@
+package gcsenhancer
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WithSkipHiddenFiles makes UploadDir skip files and directories whose name
+// starts with a dot.
+func WithSkipHiddenFiles() Option {
+	return func(e *GCSEnhancer) {
+		e.skipHidden = true
+	}
+}
+
+// UploadDir mirrors the local directory tree into the bucket under destPrefix,
+// keyed by the path of each file relative to localDir. Content types are
+// derived from the file extensions. Paths matching the patterns of the
+// IgnoreFile in localDir, if any, or of WithExcludePatterns are skipped, as
+// is the IgnoreFile itself. It returns the links of the uploaded files in
+// walk order.
+func (e *GCSEnhancer) UploadDir(ctx context.Context, localDir, destPrefix string) ([]string, error) {
+	lines, err := readIgnoreFile(localDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := parseExcludePatterns(append(lines, e.excludePatterns...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	err = filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p != localDir {
+			rel, err := filepath.Rel(localDir, p)
+
+			if err != nil {
+				return err
+			}
+
+			if e.skipPath(filepath.ToSlash(rel), d, rules) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+		}
+
+		if d.Type().IsRegular() {
+			files = append(files, p)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]string, len(files))
+
+	err = e.runBounded(ctx, len(files), func(ctx context.Context, i int) error {
+		rel, err := filepath.Rel(localDir, files[i])
+
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(files[i])
+
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		key := path.Join(destPrefix, filepath.ToSlash(rel))
+
+		info, err := e.Upload(ctx, f, key, UploadOptions{
+			ContentType: ContentTypeByExtension(key),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		links[i] = info.PublicLink
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// skipPath tells whether UploadDir skips the path rel of the entry d.
+func (e *GCSEnhancer) skipPath(rel string, d fs.DirEntry, rules excludeRules) bool {
+	if e.skipHidden && strings.HasPrefix(d.Name(), ".") {
+		return true
+	}
+
+	return rel == IgnoreFile || rules.excluded(rel, d.IsDir())
+}
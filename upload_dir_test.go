@@ -0,0 +1,150 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// writeTree creates the files under dir, keyed by their slash separated path.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUploadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTree(t, dir, map[string]string{
+		"index.html":      "<html>",
+		"css/site.css":    "body{}",
+		"js/app/main.js":  "main()",
+		".env":            "SECRET=1",
+		".git/config":     "[core]",
+		"img/.keep":       "",
+		"img/logo.svg":    "<svg/>",
+		"docs/readme.txt": "hi",
+	})
+
+	for _, tt := range []struct {
+		name string
+		opts []gcsenhancer.Option
+		want []string
+	}{
+		{
+			name: "all files",
+			want: []string{
+				"site/.env", "site/.git/config", "site/css/site.css", "site/docs/readme.txt",
+				"site/img/.keep", "site/img/logo.svg", "site/index.html", "site/js/app/main.js",
+			},
+		},
+		{
+			name: "skip hidden",
+			opts: []gcsenhancer.Option{gcsenhancer.WithSkipHiddenFiles()},
+			want: []string{
+				"site/css/site.css", "site/docs/readme.txt", "site/img/logo.svg", "site/index.html", "site/js/app/main.js",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := gcstest.New()
+			e := gcsenhancer.NewWithStorage(fake, "bucket", append(tt.opts, gcsenhancer.WithConcurrency(3))...)
+
+			links, err := e.UploadDir(context.Background(), dir, "site")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fake.Objects("bucket"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+
+			if len(links) != len(tt.want) {
+				t.Errorf("%d links, want %d", len(links), len(tt.want))
+			}
+
+			for name, want := range map[string]string{
+				"site/index.html":   "text/html; charset=utf-8",
+				"site/css/site.css": "text/css; charset=utf-8",
+				"site/img/logo.svg": "image/svg+xml",
+			} {
+				if obj, _ := fake.Object("bucket", name); obj.Attrs.ContentType != want {
+					t.Errorf("%s stored as %q, want %q", name, obj.Attrs.ContentType, want)
+				}
+			}
+
+			if obj, _ := fake.Object("bucket", "site/js/app/main.js"); string(obj.Content) != "main()" {
+				t.Errorf("main.js content = %q", obj.Content)
+			}
+		})
+	}
+}
+
+func TestUploadDirExclusions(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTree(t, dir, map[string]string{
+		gcsenhancer.IgnoreFile:      "# build output\nnode_modules\n*.tmp\n\nbuild/*.map\n",
+		"index.html":                "<html>",
+		"node_modules/lib/index.js": "lib()",
+		"src/node_modules/x.js":     "x()",
+		"src/app.js":                "app()",
+		"src/app.js.tmp":            "draft",
+		"build/app.js":              "app()",
+		"build/app.js.map":          "{}",
+		"build/nested/app.js.map":   "{}",
+		".git/HEAD":                 "ref",
+		"logs/today.log":            "log",
+		"logs.txt":                  "not a directory",
+	})
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithExcludePatterns(".git", "logs/"))
+
+	if _, err := e.UploadDir(context.Background(), dir, "site"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"site/build/app.js", "site/build/nested/app.js.map", "site/index.html", "site/logs.txt", "site/src/app.js",
+	}
+
+	if got := fake.Objects("bucket"); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+}
+
+func TestUploadDirInvalidExcludePattern(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "a"})
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithExcludePatterns("[a-"))
+
+	if _, err := e.UploadDir(context.Background(), dir, "site"); !errors.Is(err, gcsenhancer.ErrInvalidExcludePattern) {
+		t.Errorf("err = %v, want ErrInvalidExcludePattern", err)
+	}
+
+	if n := len(fake.Objects("bucket")); n != 0 {
+		t.Errorf("%d objects stored, want none", n)
+	}
+}
@@ -0,0 +1,40 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUploadTo(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "primary")
+
+	info, err := e.UploadTo(context.Background(), "secondary", strings.NewReader("x"), "a.txt", gcsenhancer.UploadOptions{PublicAccess: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.Object("secondary", "a.txt"); !ok {
+		t.Fatal("object not stored in the secondary bucket")
+	}
+
+	if names := fake.Objects("primary"); len(names) != 0 {
+		t.Errorf("primary bucket holds %v, want nothing", names)
+	}
+
+	u, err := url.Parse(info.PublicLink)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bucket := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)[0]; bucket != "secondary" {
+		t.Errorf("link %s points to bucket %q, want secondary", info.PublicLink, bucket)
+	}
+}
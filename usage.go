@@ -0,0 +1,42 @@
+package gcsenhancer
+
+import (
+	"context"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// UsageBytes returns the total size of the objects under prefix, e.g. the
+// storage used by a tenant. Soft deleted objects are still stored, and
+// billed, thus counted. Listing is paginated by the iterator, the objects are
+// never held in memory as a whole.
+func (e *GCSEnhancer) UsageBytes(ctx context.Context, prefix string) (int64, error) {
+	query := &storage.Query{
+		Prefix: prefix,
+	}
+
+	if err := query.SetAttrSelection([]string{"Size"}); err != nil {
+		return 0, err
+	}
+
+	it := e.bucket(e.bucketName).Objects(ctx, query)
+
+	var total int64
+
+	for {
+		attr, err := it.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		total += attr.Size
+	}
+
+	return total, nil
+}
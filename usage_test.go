@@ -0,0 +1,47 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestUsageBytes(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+	ctx := context.Background()
+
+	var want int64
+
+	for name, content := range map[string]string{
+		"tenants/a/1.txt":     "hello",
+		"tenants/a/sub/2.txt": strings.Repeat("x", 1000),
+		"tenants/a/3.txt":     "",
+	} {
+		if _, err := e.Upload(ctx, strings.NewReader(content), name, gcsenhancer.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		want += int64(len(content))
+	}
+
+	fake.Put("bucket", "tenants/b/1.txt", []byte("not counted"), storage.ObjectAttrs{})
+
+	got, err := e.UsageBytes(ctx, "tenants/a/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != want {
+		t.Errorf("UsageBytes = %d, want %d", got, want)
+	}
+
+	if got, err := e.UsageBytes(ctx, "tenants/none/"); err != nil || got != 0 {
+		t.Errorf("UsageBytes of an empty prefix = %d, %v, want 0", got, err)
+	}
+}
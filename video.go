@@ -0,0 +1,120 @@
+package gcsenhancer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"strings"
+)
+
+var ErrNoFrameExtractor = errors.New("gcsenhancer: no frame extractor")
+
+// FrameExtractor extracts the first frame of a video, e.g. by piping it
+// through ffmpeg. The package doesn't decode any video format itself.
+type FrameExtractor interface {
+	FirstFrame(ctx context.Context, video []byte) (image.Image, error)
+}
+
+// WithFrameExtractor sets the extractor UploadVideo takes the poster of a
+// video from.
+func WithFrameExtractor(fx FrameExtractor) Option {
+	return func(e *GCSEnhancer) {
+		e.frameExtractor = fx
+	}
+}
+
+// VideoLinks are the links of a video and its poster.
+type VideoLinks struct {
+	Video  *UploadedFileInfo
+	Poster *UploadedFileInfo
+}
+
+// UploadVideo uploads the video along with a poster: its first frame,
+// thumbnailed like the images of UploadImages and stored as JPEG next to the
+// video, e.g. "clips/intro_poster.jpg" for "clips/intro.mp4". The poster is
+// uploaded with opts too, only its content type differs, and is stored next
+// to the video even if WithContentTypeFolders routes JPEGs elsewhere. The
+// frame is extracted before anything is uploaded, an extraction failure
+// leaves the bucket untouched, and the video is deleted again when its poster
+// fails to upload. Requires WithFrameExtractor.
+func (e *GCSEnhancer) UploadVideo(ctx context.Context, video []byte, name string, opts UploadOptions) (*VideoLinks, error) {
+	if e.frameExtractor == nil {
+		return nil, ErrNoFrameExtractor
+	}
+
+	frame, err := e.frameExtractor.FirstFrame(ctx, video)
+
+	if err != nil {
+		return nil, fmt.Errorf("extracting the first frame of %s: %w", name, err)
+	}
+
+	if opts.ContentType == "" {
+		opts.ContentType = ContentTypeByExtension(name)
+	}
+
+	videoInfo, err := e.Upload(ctx, bytes.NewReader(video), name, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The poster follows the name the video was actually stored under.
+	obj, err := e.imageObject(e.thumbnail(frame), "image/jpeg", Thumbnail, e.posterKey(videoInfo.Filename))
+
+	if err != nil {
+		e.discardVideo(videoInfo.Filename, opts)
+
+		return nil, err
+	}
+
+	posterInfo, _, err := e.uploadEncoded(ctx, obj, posterOptions(opts), false)
+
+	if err != nil {
+		e.discardVideo(videoInfo.Filename, opts)
+
+		return nil, err
+	}
+
+	return &VideoLinks{
+		Video:  videoInfo,
+		Poster: posterInfo,
+	}, nil
+}
+
+// posterOptions derives the options of a poster from the ones of its video.
+// Checksums describe the video, and the poster overwrites any stale one
+// under its key.
+func posterOptions(opts UploadOptions) UploadOptions {
+	opts.ContentType = "image/jpeg"
+	opts.ContentTypeFromExt = false
+	opts.SendCRC32C = false
+	opts.CRC32C = 0
+	opts.Collision = CollisionOverwrite
+
+	return opts
+}
+
+// discardVideo deletes the video stored under name, whose poster failed to
+// upload. With CollisionSkip the video may predate the call, it is kept then.
+// A fresh context is used since the one of the upload may be done.
+func (e *GCSEnhancer) discardVideo(name string, opts UploadOptions) {
+	if opts.Collision == CollisionSkip {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	if err := e.bucket(e.bucketName).Object(name).Delete(ctx); err != nil {
+		log.Printf("gcsenhancer: failed to delete %s after its poster failed: %v", name, err)
+	}
+}
+
+// posterKey derives the key of the poster of the video stored under name.
+func (e *GCSEnhancer) posterKey(name string) string {
+	return fmt.Sprintf("%s%sposter.jpg", strings.TrimSuffix(name, path.Ext(name)), e.keySeparator)
+}
@@ -0,0 +1,175 @@
+package gcsenhancer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+// stubExtractor returns frame, or err, for any video, recording the videos
+// it is given.
+type stubExtractor struct {
+	frame  image.Image
+	err    error
+	videos [][]byte
+}
+
+func (s *stubExtractor) FirstFrame(ctx context.Context, video []byte) (image.Image, error) {
+	s.videos = append(s.videos, video)
+
+	return s.frame, s.err
+}
+
+func TestUploadVideo(t *testing.T) {
+	video := []byte("\x00\x00\x00\x18ftypmp42 video")
+	fx := &stubExtractor{frame: image.NewRGBA(image.Rect(0, 0, 640, 360))}
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithFrameExtractor(fx), gcsenhancer.WithThumbnailSize(160, 160))
+
+	links, err := e.UploadVideo(context.Background(), video, "clips/intro.mp4", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fx.videos) != 1 || !bytes.Equal(fx.videos[0], video) {
+		t.Errorf("extractor given %q, want the video", fx.videos)
+	}
+
+	if want := []string{"clips/intro.mp4", "clips/intro_poster.jpg"}; !reflect.DeepEqual(fake.Objects("bucket"), want) {
+		t.Fatalf("objects = %v, want %v", fake.Objects("bucket"), want)
+	}
+
+	if links.Video.Filename != "clips/intro.mp4" || links.Poster.Filename != "clips/intro_poster.jpg" {
+		t.Errorf("links = %s and %s", links.Video.Filename, links.Poster.Filename)
+	}
+
+	obj, _ := fake.Object("bucket", "clips/intro.mp4")
+
+	if !bytes.Equal(obj.Content, video) || obj.Attrs.ContentType != "video/mp4" {
+		t.Errorf("video stored as %q of type %s", obj.Content, obj.Attrs.ContentType)
+	}
+
+	poster, _ := fake.Object("bucket", "clips/intro_poster.jpg")
+
+	if poster.Attrs.ContentType != "image/jpeg" {
+		t.Errorf("poster content type = %s, want image/jpeg", poster.Attrs.ContentType)
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(poster.Content))
+
+	if err != nil {
+		t.Fatalf("poster is not a JPEG: %v", err)
+	}
+
+	if cfg.Width != 160 || cfg.Height != 90 {
+		t.Errorf("poster is %dx%d, want the 160x90 thumbnail of the frame", cfg.Width, cfg.Height)
+	}
+}
+
+func TestUploadVideoExtractionFailure(t *testing.T) {
+	errCodec := errors.New("unknown codec")
+
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithFrameExtractor(&stubExtractor{err: errCodec}))
+
+	if _, err := e.UploadVideo(context.Background(), []byte("x"), "a.mp4", gcsenhancer.UploadOptions{}); !errors.Is(err, errCodec) {
+		t.Errorf("err = %v, want the extraction error", err)
+	}
+
+	if n := len(fake.Objects("bucket")); n != 0 {
+		t.Errorf("%d objects stored, want none", n)
+	}
+
+	e = gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if _, err := e.UploadVideo(context.Background(), []byte("x"), "a.mp4", gcsenhancer.UploadOptions{}); !errors.Is(err, gcsenhancer.ErrNoFrameExtractor) {
+		t.Errorf("err = %v, want ErrNoFrameExtractor", err)
+	}
+}
+
+func TestUploadVideoPosterOptions(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithFrameExtractor(&stubExtractor{frame: image.NewRGBA(image.Rect(0, 0, 64, 36))}))
+
+	opts := gcsenhancer.UploadOptions{
+		PublicAccess: true,
+		Metadata:     map[string]string{"owner": "42"},
+	}
+
+	if _, err := e.UploadVideo(context.Background(), []byte("video"), "intro.mp4", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"intro.mp4", "intro_poster.jpg"} {
+		obj, ok := fake.Object("bucket", name)
+
+		if !ok {
+			t.Fatalf("%s not stored", name)
+		}
+
+		if len(obj.Attrs.ACL) != 1 || obj.Attrs.ACL[0].Entity != storage.AllUsers {
+			t.Errorf("%s: ACL = %v, want AllUsers", name, obj.Attrs.ACL)
+		}
+
+		if obj.Attrs.Metadata["owner"] != "42" {
+			t.Errorf("%s: metadata = %v, want the one of the options", name, obj.Attrs.Metadata)
+		}
+	}
+}
+
+func TestUploadVideoContentTypeFolders(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket",
+		gcsenhancer.WithFrameExtractor(&stubExtractor{frame: image.NewRGBA(image.Rect(0, 0, 64, 36))}),
+		gcsenhancer.WithContentTypeFolders(map[string]string{
+			"image/*": "images/",
+			"video/*": "videos/",
+		}, ""))
+
+	links, err := e.UploadVideo(context.Background(), []byte("video"), "intro.mp4", gcsenhancer.UploadOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"videos/intro.mp4", "videos/intro_poster.jpg"}; !reflect.DeepEqual(fake.Objects("bucket"), want) {
+		t.Fatalf("objects = %v, want the poster next to the video", fake.Objects("bucket"))
+	}
+
+	if links.Poster.Filename != "videos/intro_poster.jpg" {
+		t.Errorf("poster link = %s", links.Poster.Filename)
+	}
+}
+
+func TestUploadVideoPosterFailure(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpWrite && c.Object == "intro_poster.jpg" {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithFrameExtractor(&stubExtractor{frame: image.NewRGBA(image.Rect(0, 0, 64, 36))}))
+
+	if _, err := e.UploadVideo(context.Background(), []byte("video"), "intro.mp4", gcsenhancer.UploadOptions{}); !errors.Is(err, errDenied) {
+		t.Fatalf("err = %v, want the poster failure", err)
+	}
+
+	if objs := fake.Objects("bucket"); len(objs) != 0 {
+		t.Errorf("objects = %v, want the video deleted", objs)
+	}
+}
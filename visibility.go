@@ -0,0 +1,23 @@
+package gcsenhancer
+
+import "context"
+
+type publicAccessKey struct{}
+
+// ContextWithPublicAccess returns a copy of ctx overriding whether uploads made
+// with it are publicly accessible, regardless of UploadOptions.PublicAccess.
+// It lets a single enhancer serve both public and private uploads, including
+// through methods that take no UploadOptions like UploadImages. A private
+// enhancer, see WithPublic, still never grants public access.
+func ContextWithPublicAccess(ctx context.Context, public bool) context.Context {
+	return context.WithValue(ctx, publicAccessKey{}, public)
+}
+
+// publicAccess tells whether an upload should be publicly accessible.
+func publicAccess(ctx context.Context, opts UploadOptions) bool {
+	if public, ok := ctx.Value(publicAccessKey{}).(bool); ok {
+		return public
+	}
+
+	return opts.PublicAccess
+}
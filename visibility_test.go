@@ -0,0 +1,69 @@
+package gcsenhancer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestContextWithPublicAccess(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	for _, tt := range []struct {
+		name   string
+		ctx    context.Context
+		opts   gcsenhancer.UploadOptions
+		public bool
+	}{
+		{"public.txt", gcsenhancer.ContextWithPublicAccess(context.Background(), true), gcsenhancer.UploadOptions{}, true},
+		{"private.txt", gcsenhancer.ContextWithPublicAccess(context.Background(), false), gcsenhancer.UploadOptions{PublicAccess: true}, false},
+		{"default.txt", context.Background(), gcsenhancer.UploadOptions{}, false},
+	} {
+		if _, err := e.Upload(tt.ctx, strings.NewReader("x"), tt.name, tt.opts); err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", tt.name)
+
+		if public := len(obj.Attrs.ACL) == 1; public != tt.public {
+			t.Errorf("%s: ACL %v, want public %v", tt.name, obj.Attrs.ACL, tt.public)
+		}
+	}
+}
+
+func TestUploadPublicOption(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	for name, public := range map[string]bool{"public.txt": true, "private.txt": false} {
+		if _, err := e.Upload(context.Background(), strings.NewReader("x"), name, gcsenhancer.UploadOptions{}, gcsenhancer.UploadPublic(public)); err != nil {
+			t.Fatal(err)
+		}
+
+		obj, _ := fake.Object("bucket", name)
+
+		if got := len(obj.Attrs.ACL) == 1; got != public {
+			t.Errorf("%s: ACL %v, want public %v", name, obj.Attrs.ACL, public)
+		}
+	}
+}
+
+func TestContextWithPublicAccessUploadImages(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket", gcsenhancer.WithStableKeys())
+	ctx := gcsenhancer.ContextWithPublicAccess(context.Background(), true)
+
+	if _, err := e.UploadImages(ctx, pngImages("a.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range fake.Objects("bucket") {
+		if obj, _ := fake.Object("bucket", name); len(obj.Attrs.ACL) != 1 {
+			t.Errorf("%s: ACL %v, want public", name, obj.Attrs.ACL)
+		}
+	}
+}
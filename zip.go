@@ -0,0 +1,65 @@
+package gcsenhancer
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"cloud.google.com/go/storage"
+)
+
+// ZipObjects streams a zip archive of the objects names to w, e.g. the
+// response of a "download all", reading one object at a time so nothing is
+// buffered as a whole. Entries are named after the objects. Content types
+// already compressed, like JPEG or zip, are stored rather than deflated.
+// Missing objects are skipped with a warning, since the archive has been
+// partially written already by then.
+func (e *GCSEnhancer) ZipObjects(ctx context.Context, names []string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for _, name := range names {
+		if err := e.zipObject(ctx, zw, name); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (e *GCSEnhancer) zipObject(ctx context.Context, zw *zip.Writer, name string) error {
+	r, err := e.bucket(e.bucketName).Object(name).NewReader(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		log.Printf("gcsenhancer: %s is missing, left out of the archive", name)
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	method := zip.Deflate
+
+	if !compressible(r.Attrs().ContentType) {
+		method = zip.Store
+	}
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: r.Attrs().LastModified,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, r)
+
+	return err
+}
@@ -0,0 +1,97 @@
+package gcsenhancer_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	gcsenhancer "github.com/huangc28/gcs_enhancer"
+	"github.com/huangc28/gcs_enhancer/gcstest"
+)
+
+func TestZipObjects(t *testing.T) {
+	fake := gcstest.New()
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	files := map[string]string{
+		"docs/readme.txt": "hello hello hello hello",
+		"img/photo.jpg":   "\xff\xd8\xff\xe0jpeg",
+	}
+
+	for name, content := range files {
+		fake.Put("bucket", name, []byte(content), storage.ObjectAttrs{ContentType: gcsenhancer.ContentTypeByExtension(name)})
+	}
+
+	var buf bytes.Buffer
+
+	if err := e.ZipObjects(context.Background(), []string{"docs/readme.txt", "missing.txt", "img/photo.jpg"}, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(zr.File) != len(files) {
+		t.Fatalf("%d entries, want %d without the missing object", len(zr.File), len(files))
+	}
+
+	for i, want := range []struct {
+		name   string
+		method uint16
+	}{
+		{"docs/readme.txt", zip.Deflate},
+		{"img/photo.jpg", zip.Store},
+	} {
+		f := zr.File[i]
+
+		if f.Name != want.name || f.Method != want.method {
+			t.Errorf("entry %d = %s with method %d, want %s with %d", i, f.Name, f.Method, want.name, want.method)
+
+			continue
+		}
+
+		rc, err := f.Open()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != files[f.Name] {
+			t.Errorf("%s = %q, want %q", f.Name, got, files[f.Name])
+		}
+	}
+}
+
+func TestZipObjectsReadFailure(t *testing.T) {
+	errDenied := errors.New("denied")
+
+	fake := gcstest.New()
+	fake.Put("bucket", "a.txt", []byte("x"), storage.ObjectAttrs{})
+	fake.Intercept(func(c gcstest.Call) error {
+		if c.Op == gcstest.OpRead {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	e := gcsenhancer.NewWithStorage(fake, "bucket")
+
+	if err := e.ZipObjects(context.Background(), []string{"a.txt"}, ioutil.Discard); !errors.Is(err, errDenied) {
+		t.Errorf("err = %v, want the read error", err)
+	}
+}